@@ -1,6 +1,9 @@
+//go:build ignore
+
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,7 +13,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gen2brain/go-fitz"
 	"github.com/olekukonko/tablewriter"
+
+	"gorker/gorker"
+	"gorker/gorker/benchmark"
 )
 
 type FileStats struct {
@@ -43,16 +50,6 @@ func main() {
 		methods = append(methods, "nougat")
 	}
 
-	if *profileMemory {
-		startMemoryProfiling()
-	}
-
-	modelLst := loadAllModels()
-
-	if *profileMemory {
-		stopMemoryProfiling("model_load.pickle")
-	}
-
 	scores := make(map[string]map[string]float64)
 	times := make(map[string]map[string]float64)
 	pages := make(map[string]int)
@@ -73,12 +70,13 @@ func main() {
 			continue
 		}
 
-		doc, err := openPdfDocument(fname)
+		doc, err := fitz.New(fname)
 		if err != nil {
 			fmt.Printf("Error opening PDF %s: %v\n", fname, err)
 			continue
 		}
-		pages[fname] = getPageCount(doc)
+		pages[fname] = doc.NumPage()
+		doc.Close()
 
 		for _, method := range methods {
 			start := time.Now()
@@ -89,7 +87,10 @@ func main() {
 				if *profileMemory {
 					startMemoryProfiling()
 				}
-				fullText, _, _ = convertSinglePdf(fname, modelLst, *markerBatchMultiplier)
+				fullText, err = convertSinglePdf(fname, *markerBatchMultiplier)
+				if err != nil {
+					fmt.Printf("Error converting %s: %v\n", fname, err)
+				}
 				if *profileMemory {
 					stopMemoryProfiling(fmt.Sprintf("marker_memory_%d.pickle", idx))
 				}
@@ -106,7 +107,7 @@ func main() {
 			}
 			times[method][fname] = elapsed
 
-			score := scoreText(fullText, string(reference))
+			score := benchmark.ScoreText(fullText, string(reference))
 			if scores[method] == nil {
 				scores[method] = make(map[string]float64)
 			}
@@ -198,14 +199,21 @@ func printScoreTable(data map[string]MethodData, methods, files []string) {
 	table.Render()
 }
 
-// Placeholder functions - these would need to be implemented
-func startMemoryProfiling()                       {}
-func stopMemoryProfiling(string)                  {}
-func loadAllModels() []interface{}                { return nil }
-func openPdfDocument(string) (interface{}, error) { return nil, nil }
-func getPageCount(interface{}) int                { return 0 }
-func convertSinglePdf(string, []interface{}, int) (string, interface{}, interface{}) {
-	return "", nil, nil
+func convertSinglePdf(fname string, batchMultiplier int) (string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	result, err := gorker.Convert(context.Background(), f, gorker.Options{BatchMultiplier: batchMultiplier})
+	if err != nil {
+		return "", err
+	}
+	return result.Markdown, nil
 }
+
+// Placeholder functions - these would need to be implemented
+func startMemoryProfiling()               {}
+func stopMemoryProfiling(string)          {}
 func nougatPrediction(string, int) string { return "" }
-func scoreText(string, string) float64    { return 0 }
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -46,4 +48,4 @@ func main() {
 		fmt.Printf("Error executing shell script: %v\n", err)
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
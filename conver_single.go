@@ -1,41 +1,23 @@
+//go:build ignore
+
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
-)
 
-// Placeholder for the actual implementation
-func configurePyPDFium2() {
-	// This would be the Go equivalent of importing pypdfium2
-}
+	"gorker/gorker"
+)
 
 func configureLogging() {
 	// Implement logging configuration
 }
 
-func loadAllModels() []interface{} {
-	// Implement model loading
-	return nil
-}
-
-func convertSinglePDF(filename string, modelList []interface{}, maxPages, startPage int, langs []string, batchMultiplier int) (string, []interface{}, map[string]interface{}) {
-	// Implement PDF conversion
-	return "", nil, nil
-}
-
-func saveMarkdown(outputBase, filename, fullText string, images []interface{}, outMeta map[string]interface{}) string {
-	// Implement markdown saving
-	return ""
-}
-
 func main() {
-	// Set environment variable
-	os.Setenv("PYTORCH_ENABLE_MPS_FALLBACK", "1")
-
 	// Configure logging
 	configureLogging()
 
@@ -44,7 +26,7 @@ func main() {
 	output := flag.String("output", "", "Output base folder path")
 	maxPages := flag.Int("max_pages", 0, "Maximum number of pages to parse")
 	startPage := flag.Int("start_page", 0, "Page to start processing at")
-	langs := flag.String("langs", "", "Languages to use for OCR, comma separated")
+	langs := flag.String("langs", "", "Languages to use for OCR, comma separated. Detected from the text if empty")
 	batchMultiplier := flag.Int("batch_multiplier", 2, "How much to increase batch sizes")
 
 	flag.Parse()
@@ -61,15 +43,32 @@ func main() {
 		langSlice = strings.Split(*langs, ",")
 	}
 
-	// Load models
-	modelList := loadAllModels()
+	f, err := os.Open(*filename)
+	if err != nil {
+		fmt.Printf("Error opening %s: %v\n", *filename, err)
+		os.Exit(1)
+	}
+	defer f.Close()
 
 	// Convert PDF
-	fullText, images, outMeta := convertSinglePDF(*filename, modelList, *maxPages, *startPage, langSlice, *batchMultiplier)
+	result, err := gorker.Convert(context.Background(), f, gorker.Options{
+		MaxPages:        *maxPages,
+		StartPage:       *startPage,
+		Langs:           langSlice,
+		BatchMultiplier: *batchMultiplier,
+	})
+	if err != nil {
+		fmt.Printf("Error converting %s: %v\n", *filename, err)
+		os.Exit(1)
+	}
 
 	// Save markdown
 	baseFilename := filepath.Base(*filename)
-	subfolderPath := saveMarkdown(*output, baseFilename, fullText, images, outMeta)
+	subfolderPath, err := gorker.SaveMarkdown(*output, baseFilename, result)
+	if err != nil {
+		fmt.Printf("Error saving markdown: %v\n", err)
+		os.Exit(1)
+	}
 
 	fmt.Printf("Saved markdown to the %s folder\n", subfolderPath)
 }
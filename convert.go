@@ -1,80 +1,79 @@
+//go:build ignore
+
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
-	"runtime"
 	"sync"
 
 	"github.com/schollz/progressbar/v3"
-)
-
-// Global variables
-var modelRefs interface{}
-
-// Settings struct to hold configuration
-type Settings struct {
-	CUDA               bool
-	INFERENCE_RAM      int
-	VRAM_PER_TASK      int
-	TORCH_DEVICE       string
-	TORCH_DEVICE_MODEL string
-}
 
-var settings = Settings{
-	CUDA:               true,
-	INFERENCE_RAM:      8000,
-	VRAM_PER_TASK:      1000,
-	TORCH_DEVICE:       "cuda",
-	TORCH_DEVICE_MODEL: "cuda",
-}
+	"gorker/gorker"
+)
 
-func workerInit(sharedModel interface{}) {
-	if sharedModel == nil {
-		sharedModel = loadAllModels()
+func processSinglePDF(fpath, outFolder string, metadata map[string]interface{}, minLength int) error {
+	fname := filepath.Base(fpath)
+	if gorker.MarkdownExists(outFolder, fname) {
+		return nil
 	}
-	modelRefs = sharedModel
-}
 
-func workerExit() {
-	modelRefs = nil
-}
-
-func processSinglePDF(filepath, outFolder string, metadata map[string]interface{}, minLength int) {
-	fname := filepath.Base(filepath)
-	if markdownExists(outFolder, fname) {
-		return
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return err
 	}
 
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("Error converting %s: %v\n", filepath, r)
-		}
-	}()
-
 	if minLength > 0 {
-		filetype := findFiletype(filepath)
-		if filetype == "other" {
-			return
+		if gorker.FindFiletype(data) == "other" {
+			return nil
 		}
 
-		length := getLengthOfText(filepath)
+		length, err := gorker.GetLengthOfText(data)
+		if err != nil {
+			return err
+		}
 		if length < minLength {
-			return
+			return nil
 		}
 	}
 
-	fullText, images, outMetadata := convertSinglePDF(filepath, modelRefs, metadata)
-	if len(fullText) > 0 {
-		saveMarkdown(outFolder, fname, fullText, images, outMetadata)
-	} else {
-		fmt.Printf("Empty file: %s. Could not convert.\n", filepath)
+	result, err := gorker.Convert(context.Background(), bytes.NewReader(data), gorker.Options{Langs: fileLangs(metadata, fname)})
+	if errors.Is(err, gorker.ErrNoText) {
+		fmt.Printf("Empty file: %s. Could not convert.\n", fpath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = gorker.SaveMarkdown(outFolder, fname, result)
+	return err
+}
+
+// fileLangs looks up the languages listed for fname in the metadata file.
+func fileLangs(metadata map[string]interface{}, fname string) []string {
+	fileMetadata, ok := metadata[fname].(map[string]interface{})
+	if !ok {
+		return nil
 	}
+	values, ok := fileMetadata["languages"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var langs []string
+	for _, value := range values {
+		if lang, ok := value.(string); ok {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
 }
 
 func main() {
@@ -95,8 +94,8 @@ func main() {
 		os.Exit(1)
 	}
 
-	inFolder, _ = filepath.Abs(*inFolder)
-	outFolder, _ = filepath.Abs(*outFolder)
+	*inFolder, _ = filepath.Abs(*inFolder)
+	*outFolder, _ = filepath.Abs(*outFolder)
 	os.MkdirAll(*outFolder, os.ModePerm)
 
 	files, err := ioutil.ReadDir(*inFolder)
@@ -108,7 +107,7 @@ func main() {
 	var filesToConvert []string
 	for _, file := range files {
 		if !file.IsDir() {
-			filesToConvert = append(filesToConvert, filepath.Join(inFolder, file.Name()))
+			filesToConvert = append(filesToConvert, filepath.Join(*inFolder, file.Name()))
 		}
 	}
 
@@ -137,24 +136,10 @@ func main() {
 	}
 
 	totalProcesses := *workers
-	if settings.CUDA {
-		tasksPerGPU := settings.INFERENCE_RAM / settings.VRAM_PER_TASK
-		if tasksPerGPU < totalProcesses {
-			totalProcesses = tasksPerGPU
-		}
-	}
-
 	if totalProcesses > len(filesToConvert) {
 		totalProcesses = len(filesToConvert)
 	}
 
-	if settings.TORCH_DEVICE == "mps" || settings.TORCH_DEVICE_MODEL == "mps" {
-		fmt.Println("Cannot use MPS with torch multiprocessing share_memory. This will make things less memory efficient. If you want to share memory, you have to use CUDA or CPU. Set the TORCH_DEVICE environment variable to change the device.")
-		modelRefs = nil
-	} else {
-		modelRefs = loadAllModels()
-	}
-
 	fmt.Printf("Converting %d pdfs in chunk %d/%d with %d processes, and storing in %s\n", len(filesToConvert), *chunkIdx+1, *numChunks, totalProcesses, *outFolder)
 
 	var wg sync.WaitGroup
@@ -167,25 +152,12 @@ func main() {
 		go func(file string) {
 			defer wg.Done()
 			defer func() { <-semaphore }()
-			processSinglePDF(file, *outFolder, metadata, *minLength)
+			if err := processSinglePDF(file, *outFolder, metadata, *minLength); err != nil {
+				fmt.Printf("Error converting %s: %v\n", file, err)
+			}
 			bar.Add(1)
 		}(file)
 	}
 
 	wg.Wait()
-
-	// Clean up
-	modelRefs = nil
-	runtime.GC()
-}
-
-// Placeholder functions - these would need to be implemented
-func loadAllModels() interface{}                  { return nil }
-func markdownExists(outFolder, fname string) bool { return false }
-func findFiletype(filepath string) string         { return "" }
-func getLengthOfText(filepath string) int         { return 0 }
-func convertSinglePDF(filepath string, modelRefs interface{}, metadata map[string]interface{}) (string, []interface{}, map[string]interface{}) {
-	return "", nil, nil
-}
-func saveMarkdown(outFolder, fname, fullText string, images []interface{}, outMetadata map[string]interface{}) {
 }
@@ -1,11 +1,10 @@
-package main
+package benchmark
 
 import (
-	"fmt"
 	"math"
 	"strings"
 
-	"github.com/sahilm/fuzzy"
+	"github.com/lithammer/fuzzysearch/fuzzy"
 )
 
 const CHUNK_MIN_CHARS = 25
@@ -38,9 +37,8 @@ func overlapScore(hypothesisChunks, referenceChunks []string) []float64 {
 
 		for j := chunkRangeStart; j < chunkRangeEnd; j++ {
 			refChunk := referenceChunks[j]
-			score := fuzzy.RatioForStrings([]rune(hypChunk), []rune(refChunk), fuzzy.DefaultOptions)
-			if score > 30 {
-				score = float64(score) / 100
+			score := ratio(hypChunk, refChunk)
+			if score > 0.3 {
 				if score > maxScore {
 					maxScore = score
 				}
@@ -51,6 +49,16 @@ func overlapScore(hypothesisChunks, referenceChunks []string) []float64 {
 	return chunkScores
 }
 
+// ratio scores the similarity of two strings between 0 and 1 from their edit
+// distance.
+func ratio(a, b string) float64 {
+	maxLen := math.Max(float64(len([]rune(a))), float64(len([]rune(b))))
+	if maxLen == 0 {
+		return 1
+	}
+	return 1 - float64(fuzzy.LevenshteinDistance(a, b))/maxLen
+}
+
 func mean(numbers []float64) float64 {
 	sum := 0.0
 	for _, num := range numbers {
@@ -59,16 +67,11 @@ func mean(numbers []float64) float64 {
 	return sum / float64(len(numbers))
 }
 
-func scoreText(hypothesis, reference string) float64 {
+// ScoreText measures how well hypothesis aligns with reference, chunk by
+// chunk, between 0 and 1.
+func ScoreText(hypothesis, reference string) float64 {
 	hypothesisChunks := chunkText(hypothesis, 500)
 	referenceChunks := chunkText(reference, 500)
 	chunkScores := overlapScore(hypothesisChunks, referenceChunks)
 	return mean(chunkScores)
 }
-
-func main() {
-	hypothesis := "Your hypothesis text here"
-	reference := "Your reference text here"
-	score := scoreText(hypothesis, reference)
-	fmt.Printf("Alignment score: %f\n", score)
-}
@@ -1,4 +1,4 @@
-package main
+package cleaners
 
 import (
 	"fmt"
@@ -6,33 +6,10 @@ import (
 	"regexp"
 	"sort"
 	"strings"
-)
-
-// Structs to represent the document structure
-type Span struct {
-	Text       string
-	BBox       []float64
-	SpanID     string
-	Font       string
-	FontWeight string
-	FontSize   float64
-}
-
-type Line struct {
-	Spans      []Span
-	BBox       []float64
-	PrelimText string
-}
-
-type Block struct {
-	BlockType string
-	Lines     []Line
-	BBox      []float64
-}
 
-type Page struct {
-	Blocks []Block
-}
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
 
 // Helper functions
 func mean(nums []float64) float64 {
@@ -51,11 +28,11 @@ func median(nums []float64) float64 {
 	return nums[len(nums)/2]
 }
 
-func isCodeLinelen(lines []Line, thresh float64) bool {
+func isCodeLinelen(lines []schema.Line, thresh float64) bool {
 	re := regexp.MustCompile(`\w`)
 	totalAlnumChars := 0
 	for _, line := range lines {
-		totalAlnumChars += len(re.FindAllString(line.PrelimText, -1))
+		totalAlnumChars += len(re.FindAllString(line.PrelimText(), -1))
 	}
 	totalNewlines := math.Max(float64(len(lines)-1), 1)
 
@@ -67,24 +44,24 @@ func isCodeLinelen(lines []Line, thresh float64) bool {
 	return ratio < thresh
 }
 
-func commentCount(lines []Line) int {
+func commentCount(lines []schema.Line) int {
 	pattern := regexp.MustCompile(`^(//|#|'|--|/\*|'''|"""|--\[\[|<!--|%|%{|\(\*)`)
 	count := 0
 	for _, line := range lines {
-		if pattern.MatchString(line.PrelimText) {
+		if pattern.MatchString(line.PrelimText()) {
 			count++
 		}
 	}
 	return count
 }
 
-func identifyCodeBlocks(pages []Page) int {
+func IdentifyCodeBlocks(pages []schema.Page) int {
 	codeBlockCount := 0
 	var fontSizes, lineHeights []float64
 
 	for _, page := range pages {
-		fontSizes = append(fontSizes, page.getFontSizes()...)
-		lineHeights = append(lineHeights, page.getLineHeights()...)
+		fontSizes = append(fontSizes, page.FontSizes()...)
+		lineHeights = append(lineHeights, page.LineHeights()...)
 	}
 
 	var avgFontSize, avgLineHeight float64
@@ -104,7 +81,7 @@ func identifyCodeBlocks(pages []Page) int {
 				continue
 			}
 
-			minStart := block.getMinLineStart()
+			minStart := block.MinLineStart()
 
 			var isIndent []bool
 			var lineFonts []string
@@ -115,9 +92,9 @@ func identifyCodeBlocks(pages []Page) int {
 					lineFonts = append(lineFonts, span.Font)
 					lineFontSizes = append(lineFontSizes, span.FontSize)
 				}
-				blockLineHeights = append(blockLineHeights, line.BBox[3]-line.BBox[1])
+				blockLineHeights = append(blockLineHeights, line.Bbox.Height())
 
-				isIndent = append(isIndent, line.BBox[0] > minStart)
+				isIndent = append(isIndent, line.Bbox[0] > minStart)
 			}
 
 			commentLines := commentCount(block.Lines)
@@ -145,7 +122,7 @@ func identifyCodeBlocks(pages []Page) int {
 	return codeBlockCount
 }
 
-func indentBlocks(pages []Page) {
+func IndentBlocks(pages []schema.Page) {
 	spanCounter := 0
 	for _, page := range pages {
 		for i := range page.Blocks {
@@ -155,7 +132,7 @@ func indentBlocks(pages []Page) {
 			}
 
 			var lines []struct {
-				BBox []float64
+				Bbox geometry.Bbox
 				Text string
 			}
 			minLeft := 1000.0
@@ -163,17 +140,17 @@ func indentBlocks(pages []Page) {
 
 			for _, line := range block.Lines {
 				text := ""
-				minLeft = math.Min(line.BBox[0], minLeft)
+				minLeft = math.Min(line.Bbox[0], minLeft)
 				for _, span := range line.Spans {
 					if colWidth == 0 && len(span.Text) > 0 {
-						colWidth = (span.BBox[2] - span.BBox[0]) / float64(len(span.Text))
+						colWidth = span.Bbox.Width() / float64(len(span.Text))
 					}
 					text += span.Text
 				}
 				lines = append(lines, struct {
-					BBox []float64
+					Bbox geometry.Bbox
 					Text string
-				}{line.BBox, text})
+				}{line.Bbox, text})
 			}
 
 			blockText := ""
@@ -184,7 +161,7 @@ func indentBlocks(pages []Page) {
 				if colWidth == 0 {
 					prefix = ""
 				} else {
-					prefix = strings.Repeat(" ", int((line.BBox[0]-minLeft)/colWidth))
+					prefix = strings.Repeat(" ", int((line.Bbox[0]-minLeft)/colWidth))
 				}
 				currentLineBlank := len(strings.TrimSpace(text)) == 0
 				if blankLine && currentLineBlank {
@@ -195,16 +172,16 @@ func indentBlocks(pages []Page) {
 				blankLine = currentLineBlank
 			}
 
-			newSpan := Span{
+			newSpan := schema.Span{
 				Text:       blockText,
-				BBox:       block.BBox,
+				Bbox:       block.Bbox,
 				SpanID:     fmt.Sprintf("%d_fix_code", spanCounter),
 				Font:       block.Lines[0].Spans[0].Font,
 				FontWeight: block.Lines[0].Spans[0].FontWeight,
 				FontSize:   block.Lines[0].Spans[0].FontSize,
 			}
 			spanCounter++
-			block.Lines = []Line{{Spans: []Span{newSpan}, BBox: block.BBox}}
+			block.Lines = []schema.Line{{Spans: []schema.Span{newSpan}, Bbox: block.Bbox}}
 		}
 	}
 }
@@ -228,39 +205,3 @@ func all(bools []bool) bool {
 	}
 	return true
 }
-
-// Methods for Page struct
-func (p Page) getFontSizes() []float64 {
-	var sizes []float64
-	for _, block := range p.Blocks {
-		for _, line := range block.Lines {
-			for _, span := range line.Spans {
-				sizes = append(sizes, span.FontSize)
-			}
-		}
-	}
-	return sizes
-}
-
-func (p Page) getLineHeights() []float64 {
-	var heights []float64
-	for _, block := range p.Blocks {
-		for _, line := range block.Lines {
-			heights = append(heights, line.BBox[3]-line.BBox[1])
-		}
-	}
-	return heights
-}
-
-// Method for Block struct
-func (b Block) getMinLineStart() float64 {
-	minStart := math.Inf(1)
-	for _, line := range b.Lines {
-		minStart = math.Min(minStart, line.BBox[0])
-	}
-	return minStart
-}
-
-func main() {
-	// Your main code here
-}
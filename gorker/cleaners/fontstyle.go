@@ -1,32 +1,22 @@
-package main
+package cleaners
 
 import (
 	"strings"
-)
-
-// Assuming these structs are defined elsewhere in your project
-type Span struct {
-	Font       string
-	FontWeight int
-	Bold       bool
-	Italic     bool
-}
-
-type Line struct {
-	Spans []Span
-}
 
-type Block struct {
-	BlockType string
-	Lines     []Line
-}
+	"gorker/gorker/schema"
+)
 
-type Page struct {
-	Blocks []Block
+// FontStats describes the body text of a document.
+type FontStats struct {
+	BodySize   float64
+	BodyWeight float64
 }
 
-func findBoldItalic(pages []Page, boldMinWeight int) {
-	var fontWeights []int
+// FindBoldItalic marks the bold and italic spans of every page, from their
+// font names and weights. It returns the median size and weight of the text
+// outside headings.
+func FindBoldItalic(pages []schema.Page, boldMinWeight float64) FontStats {
+	var fontWeights, fontSizes []float64
 
 	// First pass: collect font weights and set bold/italic based on font name
 	for _, page := range pages {
@@ -45,13 +35,16 @@ func findBoldItalic(pages []Page, boldMinWeight int) {
 						span.Italic = true
 					}
 					fontWeights = append(fontWeights, span.FontWeight)
+					if span.FontSize > 0 {
+						fontSizes = append(fontSizes, span.FontSize)
+					}
 				}
 			}
 		}
 	}
 
 	if len(fontWeights) == 0 {
-		return
+		return FontStats{}
 	}
 
 	// Second pass: set bold based on font weight
@@ -67,12 +60,10 @@ func findBoldItalic(pages []Page, boldMinWeight int) {
 			}
 		}
 	}
-}
 
-func main() {
-	// Example usage
-	pages := []Page{
-		// Initialize your pages here
+	stats := FontStats{BodyWeight: median(fontWeights)}
+	if len(fontSizes) > 0 {
+		stats.BodySize = median(fontSizes)
 	}
-	findBoldItalic(pages, 600)
+	return stats
 }
@@ -1,84 +1,192 @@
-package main
+package cleaners
 
 import (
+	"fmt"
 	"math"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/lithammer/fuzzysearch/fuzzy" // for fuzzy string matching
+
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
 )
 
-type Span struct {
-	Text   string
-	SpanID string
-}
+const (
+	// headerBand is the share of the page height at the top and at the bottom
+	// searched for running headers and footers.
+	headerBand = 0.12
+	// headerMatchRatio is how alike the text of two lines must be, with page
+	// numbers blanked out, to be the same header.
+	headerMatchRatio = 0.8
+	// headerWindow is how many pages either side of a page it is compared
+	// with, as running headers change from chapter to chapter.
+	headerWindow = 8
+	// headerRepeatShare is the share of the pages compared with that must
+	// repeat a line for it to be a header or footer.
+	headerRepeatShare = 0.5
+)
 
-type Line struct {
-	Spans []Span
+// bandLine is a line near the top or bottom edge of a page.
+type bandLine struct {
+	line schema.Line
+	// text is the line's text with page numbers blanked out
+	text string
+	top  bool
+	// offset is the distance from the edge the line is near
+	offset float64
 }
 
-type Block struct {
-	BlockType string
-	Text      string
+// matches reports whether two lines are the same header. Scanned pages sit
+// a little differently on each page, so the lines may be a couple of line
+// heights apart.
+func (a bandLine) matches(b bandLine) bool {
+	return a.top == b.top && math.Abs(a.offset-b.offset) <= 2*math.Max(a.line.Bbox.Height(), b.line.Bbox.Height()) &&
+		stringRatio(a.text, b.text) >= headerMatchRatio
 }
 
-type Page struct {
-	Blocks []Block
-}
+// pageBandLines returns the first and last maxSelectedLines lines of a page
+// that lie in its top and bottom bands.
+func pageBandLines(page schema.Page, maxSelectedLines int) []bandLine {
+	lines := page.NonblankLines()
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Bbox.Y0() < lines[j].Bbox.Y0()
+	})
+	band := page.Bbox.Height() * headerBand
 
-func filterCommonElements(lines []Line, pageCount int, threshold float64) []string {
-	if pageCount < 3 {
-		return []string{}
+	var selected []bandLine
+	for i := 0; i < len(lines) && i < maxSelectedLines; i++ {
+		if lines[i].Bbox.Y1() > page.Bbox.Y0()+band {
+			break
+		}
+		selected = append(selected, bandLine{line: lines[i], top: true, offset: lines[i].Bbox.Y0() - page.Bbox.Y0()})
 	}
-
-	text := []string{}
-	for _, line := range lines {
-		for _, span := range line.Spans {
-			if len(span.Text) > 4 {
-				text = append(text, span.Text)
-			}
+	for i := len(lines) - 1; i >= len(selected) && i >= len(lines)-maxSelectedLines; i-- {
+		if lines[i].Bbox.Y0() < page.Bbox.Y1()-band {
+			break
 		}
+		selected = append(selected, bandLine{line: lines[i], offset: page.Bbox.Y1() - lines[i].Bbox.Y1()})
 	}
+	for i := range selected {
+		text := strings.Join(strings.Fields(strings.ToLower(selected[i].line.PrelimText())), " ")
+		if romanValue(text) > 0 {
+			text = "#"
+		}
+		selected[i].text = replaceLeadingTrailingDigits(text, "#")
+	}
+	return selected
+}
 
-	counter := make(map[string]int)
-	for _, t := range text {
-		counter[t]++
+// FilterHeaderFooter finds the running headers and footers of a document.
+// These are among the first and last maxSelectedLines lines of a page, near
+// its top or bottom edge, and repeat at about the same height on most of the
+// nearby pages, or on most of the nearby pages of the same side, as books
+// alternate them between left and right pages. Page numbers are blanked out
+// before comparing text. It returns the ids of the spans to remove, and the
+// page numbers printed in them by page.
+func FilterHeaderFooter(pages []schema.Page, maxSelectedLines int) ([]string, map[int]string) {
+	badSpanIDs := []string{}
+	pageLabels := map[int]string{}
+	if len(pages) < 3 {
+		return badSpanIDs, pageLabels
 	}
 
-	common := []string{}
-	for k, v := range counter {
-		if float64(v) > float64(pageCount)*threshold {
-			common = append(common, k)
-		}
+	bandLines := make([][]bandLine, len(pages))
+	for i, page := range pages {
+		bandLines[i] = pageBandLines(page, maxSelectedLines)
 	}
 
-	badSpanIDs := []string{}
-	for _, line := range lines {
-		for _, span := range line.Spans {
-			for _, c := range common {
-				if span.Text == c {
-					badSpanIDs = append(badSpanIDs, span.SpanID)
+	for i := range pages {
+		for _, candidate := range bandLines[i] {
+			neighbors, sameSide, matched, matchedSameSide := 0, 0, 0, 0
+			for j := max(0, i-headerWindow); j <= min(len(pages)-1, i+headerWindow); j++ {
+				if j == i {
+					continue
+				}
+				same := (j-i)%2 == 0
+				neighbors++
+				if same {
+					sameSide++
+				}
+				for _, other := range bandLines[j] {
+					if candidate.matches(other) {
+						matched++
+						if same {
+							matchedSameSide++
+						}
+						break
+					}
+				}
+			}
+			repeated := matched >= 2 && float64(matched) >= float64(neighbors)*headerRepeatShare ||
+				matchedSameSide >= 2 && float64(matchedSameSide) >= float64(sameSide)*headerRepeatShare
+			if !repeated {
+				continue
+			}
+
+			for _, span := range candidate.line.Spans {
+				badSpanIDs = append(badSpanIDs, span.SpanID)
+			}
+			if _, ok := pageLabels[pages[i].Pnum]; !ok {
+				if label := pageNumberLabel(candidate.line.PrelimText()); label != "" {
+					pageLabels[pages[i].Pnum] = label
 				}
 			}
 		}
 	}
-
-	return badSpanIDs
+	return badSpanIDs, consistentPageLabels(pageLabels)
 }
 
-func filterHeaderFooter(allPageBlocks []Page, maxSelectedLines int) []string {
-	var firstLines, lastLines []Line
+var (
+	leadingNumberRe  = regexp.MustCompile(`^\d+\b`)
+	trailingNumberRe = regexp.MustCompile(`\b\d+$`)
+)
 
-	for _, page := range allPageBlocks {
-		nonblankLines := getNonblankLines(page)
-		firstLines = append(firstLines, nonblankLines[:int(math.Min(float64(maxSelectedLines), float64(len(nonblankLines))))]...)
-		lastLines = append(lastLines, nonblankLines[len(nonblankLines)-int(math.Min(float64(maxSelectedLines), float64(len(nonblankLines)))):])
+// pageNumberLabel returns the page number at the start or end of a header
+// line, or the line itself if it is a roman numeral.
+func pageNumberLabel(text string) string {
+	text = strings.TrimSpace(text)
+	if romanValue(text) > 0 {
+		return text
+	}
+	if n := leadingNumberRe.FindString(text); n != "" {
+		return n
 	}
+	return trailingNumberRe.FindString(text)
+}
 
-	badSpanIDs := filterCommonElements(firstLines, len(allPageBlocks), 0.6)
-	badSpanIDs = append(badSpanIDs, filterCommonElements(lastLines, len(allPageBlocks), 0.6)...)
+// consistentPageLabels keeps the page numbers that count up with the pages
+// along with at least one other, dropping years and other numbers that
+// happen to end a header.
+func consistentPageLabels(labels map[int]string) map[int]string {
+	type run struct {
+		roman  bool
+		offset int
+	}
+	runs := make(map[int]run, len(labels))
+	sizes := make(map[run]int)
+	for pnum, label := range labels {
+		r := run{offset: -pnum}
+		if n, err := strconv.Atoi(label); err == nil {
+			r.offset += n
+		} else {
+			r.roman = true
+			r.offset += romanValue(label)
+		}
+		runs[pnum] = r
+		sizes[r]++
+	}
 
-	return badSpanIDs
+	consistent := make(map[int]string)
+	for pnum, label := range labels {
+		if sizes[runs[pnum]] >= 2 {
+			consistent[pnum] = label
+		}
+	}
+	return consistent
 }
 
 func replaceLeadingTrailingDigits(s, replacement string) string {
@@ -91,82 +199,129 @@ func replaceLeadingTrailingDigits(s, replacement string) string {
 	return s
 }
 
-func findOverlapElements(lst []struct {
-	str string
-	id  int
-}, stringMatchThresh, minOverlap float64) []int {
-	result := []int{}
-	titles := make([]string, len(lst))
-	for i, item := range lst {
-		titles[i] = item.str
-	}
-
-	for i, item := range lst {
-		overlapCount := 0
-		for j, str2 := range titles {
-			if i != j && fuzzy.RatioNormalized(item.str, str2) >= stringMatchThresh {
-				overlapCount++
-			}
-		}
-		if float64(overlapCount) >= math.Max(3.0, float64(len(lst))*minOverlap) {
-			result = append(result, item.id)
-		}
-	}
+// DroppedTitle is a heading removed because it repeats, such as a chapter
+// title running in the page headers of a book.
+type DroppedTitle struct {
+	Text string `json:"text"`
+	// Matches is how many other headings are alike enough to it.
+	Matches int `json:"matches"`
+	// Reason says what the heading was matched on.
+	Reason string `json:"reason"`
+}
 
-	return result
+// titleGroup is the headings sharing one normalized text.
+type titleGroup struct {
+	text   string
+	runes  int
+	blocks []int
+	// similar is how many other headings are alike enough to these
+	similar int
+	// example is the text of another group the headings matched
+	example string
 }
 
-func filterCommonTitles(mergedBlocks []Block) []Block {
-	titles := []struct {
-		str string
-		id  int
-	}{}
+// normalizeTitle returns the text of a heading with its markdown and page
+// numbers stripped, for comparing with other headings.
+func normalizeTitle(text string) string {
+	text = strings.TrimLeft(strings.TrimSpace(text), "#")
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	return strings.TrimSpace(replaceLeadingTrailingDigits(text, ""))
+}
 
+// FilterCommonTitles drops the headings that repeat through a document. A
+// heading repeats when its text, without page numbers, is at least
+// settings.CommonTitleMatchThresh alike to that of more than
+// settings.CommonTitleMinShare of the headings, and at least 3 of them. Equal
+// texts are compared once, and only texts close enough in length to be alike
+// are compared, so long books stay fast. It returns the blocks left and the
+// headings dropped.
+func FilterCommonTitles(mergedBlocks []schema.FullyMergedBlock) ([]schema.FullyMergedBlock, []DroppedTitle) {
+	groupIndex := make(map[string]int)
+	var groups []*titleGroup
+	titleCount := 0
 	for i, block := range mergedBlocks {
-		if block.BlockType == "Title" || block.BlockType == "Section-header" {
-			text := block.Text
-			if strings.TrimSpace(text)[0] == '#' {
-				text = regexp.MustCompile(`^#+`).ReplaceAllString(text, "")
+		if block.BlockType != "Title" && block.BlockType != "Section-header" {
+			continue
+		}
+		text := normalizeTitle(block.Text)
+		if text == "" {
+			continue
+		}
+		titleCount++
+		g, ok := groupIndex[text]
+		if !ok {
+			g = len(groups)
+			groupIndex[text] = g
+			groups = append(groups, &titleGroup{text: text, runes: utf8.RuneCountInString(text)})
+		}
+		groups[g].blocks = append(groups[g].blocks, i)
+	}
+
+	thresh := settings.CommonTitleMatchThresh
+	byLength := append([]*titleGroup{}, groups...)
+	sort.Slice(byLength, func(i, j int) bool { return byLength[i].runes < byLength[j].runes })
+	for _, g := range groups {
+		g.similar = len(g.blocks) - 1
+		if g.similar > 0 {
+			g.example = g.text
+		}
+	}
+	for i, a := range byLength {
+		for _, b := range byLength[i+1:] {
+			// Texts differing in length by more than this can't be alike
+			if float64(b.runes-a.runes) > (1-thresh)*float64(b.runes) {
+				break
+			}
+			if stringRatio(a.text, b.text) >= thresh {
+				a.similar += len(b.blocks)
+				b.similar += len(a.blocks)
+				if a.example == "" || a.example == a.text {
+					a.example = b.text
+				}
+				if b.example == "" || b.example == b.text {
+					b.example = a.text
+				}
 			}
-			text = strings.TrimSpace(text)
-			text = replaceLeadingTrailingDigits(text, "")
-			text = strings.TrimSpace(text)
-			titles = append(titles, struct {
-				str string
-				id  int
-			}{text, i})
 		}
 	}
 
-	badBlockIDs := findOverlapElements(titles, 0.9, 0.05)
+	minMatches := math.Max(3, float64(titleCount)*settings.CommonTitleMinShare)
+	bad := make(map[int]bool)
+	var dropped []DroppedTitle
+	for _, g := range groups {
+		if float64(g.similar) < minMatches {
+			continue
+		}
+		reason := fmt.Sprintf("repeated %d times", len(g.blocks))
+		if g.example != g.text {
+			reason = fmt.Sprintf("%d%% alike to %q", int(stringRatio(g.text, g.example)*100), g.example)
+			if len(g.blocks) > 1 {
+				reason = fmt.Sprintf("repeated %d times, %s", len(g.blocks), reason)
+			}
+		}
+		for _, i := range g.blocks {
+			bad[i] = true
+			dropped = append(dropped, DroppedTitle{Text: strings.TrimSpace(mergedBlocks[i].Text), Matches: g.similar, Reason: reason})
+		}
+	}
 
-	newBlocks := []Block{}
+	newBlocks := []schema.FullyMergedBlock{}
 	for i, block := range mergedBlocks {
-		if !contains(badBlockIDs, i) {
+		if !bad[i] {
 			newBlocks = append(newBlocks, block)
 		}
 	}
-
-	return newBlocks
+	return newBlocks, dropped
 }
 
 // Helper functions
 
-func getNonblankLines(page Page) []Line {
-	// Implement this function based on your Page structure
-	return []Line{}
-}
-
-func contains(slice []int, item int) bool {
-	for _, a := range slice {
-		if a == item {
-			return true
-		}
+// stringRatio scores the similarity of two strings between 0 and 1 from their
+// edit distance.
+func stringRatio(a, b string) float64 {
+	maxLen := math.Max(float64(len([]rune(a))), float64(len([]rune(b))))
+	if maxLen == 0 {
+		return 1
 	}
-	return false
-}
-
-func main() {
-	// Example usage
-	// Initialize your data structures and call the functions here
+	return 1 - float64(fuzzy.LevenshteinDistance(a, b))/maxLen
 }
@@ -0,0 +1,166 @@
+package cleaners
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// placedText is a line of text at a height on the page.
+type placedText struct {
+	y    float64
+	text string
+}
+
+// bandPage returns a page with the given lines, each with a span id naming
+// its page and text.
+func bandPage(pnum int, lines ...placedText) schema.Page {
+	page := schema.Page{Pnum: pnum, Bbox: geometry.Bbox{0, 0, 600, 800}}
+	for _, l := range lines {
+		line := textLine(l.text, 72, l.y)
+		line.Spans[0].SpanID = fmt.Sprintf("%d_%s", pnum, l.text)
+		page.Blocks = append(page.Blocks, textBlock("Text", line))
+	}
+	return page
+}
+
+func TestFilterHeaderFooter(t *testing.T) {
+	var numbered, alternating, yearly, unique []schema.Page
+	for i := 0; i < 6; i++ {
+		numbered = append(numbered, bandPage(i,
+			placedText{20, "Chapter 1: Introduction"},
+			placedText{300, fmt.Sprintf("Body text of page %d", i)},
+			placedText{770, fmt.Sprint(i + 1)},
+		))
+		// Books put the title on left pages and the chapter on right ones
+		header := "The Book of Things"
+		if i%2 == 1 {
+			header = "Chapter Two"
+		}
+		alternating = append(alternating, bandPage(i,
+			placedText{20, header},
+			placedText{300, fmt.Sprintf("Body text of page %d", i)},
+		))
+		yearly = append(yearly, bandPage(i,
+			placedText{20, "Annual report 2023"},
+			placedText{300, "Results for the year"},
+		))
+		unique = append(unique, bandPage(i,
+			placedText{20, []string{"Introduction", "Related work", "Our method", "Experiments", "Discussion", "Conclusions"}[i]},
+			placedText{300, "Body text"},
+		))
+	}
+
+	tests := []struct {
+		name     string
+		pages    []schema.Page
+		maxLines int
+		wantIDs  []string
+		wantNums map[int]string
+	}{
+		{
+			name:     "running header and page numbers",
+			pages:    numbered,
+			maxLines: 2,
+			wantIDs: []string{
+				"0_Chapter 1: Introduction", "0_1", "1_Chapter 1: Introduction", "1_2", "2_Chapter 1: Introduction", "2_3",
+				"3_Chapter 1: Introduction", "3_4", "4_Chapter 1: Introduction", "4_5", "5_Chapter 1: Introduction", "5_6",
+			},
+			wantNums: map[int]string{0: "1", 1: "2", 2: "3", 3: "4", 4: "5", 5: "6"},
+		},
+		{
+			name:     "headers alternating between sides",
+			pages:    alternating,
+			maxLines: 2,
+			wantIDs: []string{
+				"0_The Book of Things", "1_Chapter Two", "2_The Book of Things",
+				"3_Chapter Two", "4_The Book of Things", "5_Chapter Two",
+			},
+			wantNums: map[int]string{},
+		},
+		{
+			// The year is the same on every page, so it isn't a page number
+			name:     "number that doesn't count up",
+			pages:    yearly,
+			maxLines: 2,
+			wantIDs: []string{
+				"0_Annual report 2023", "1_Annual report 2023", "2_Annual report 2023",
+				"3_Annual report 2023", "4_Annual report 2023", "5_Annual report 2023",
+			},
+			wantNums: map[int]string{},
+		},
+		{
+			name:     "lines that don't repeat",
+			pages:    unique,
+			maxLines: 2,
+			wantIDs:  []string{},
+			wantNums: map[int]string{},
+		},
+		{
+			name:     "too few pages to tell",
+			pages:    numbered[:2],
+			maxLines: 2,
+			wantIDs:  []string{},
+			wantNums: map[int]string{},
+		},
+		{
+			name:     "no lines looked at",
+			pages:    numbered,
+			maxLines: 0,
+			wantIDs:  []string{},
+			wantNums: map[int]string{},
+		},
+	}
+	for _, tt := range tests {
+		ids, nums := FilterHeaderFooter(tt.pages, tt.maxLines)
+		slices.Sort(ids)
+		want := slices.Clone(tt.wantIDs)
+		slices.Sort(want)
+		if !slices.Equal(ids, want) {
+			t.Errorf("%s: removed %q, want %q", tt.name, ids, want)
+		}
+		if !maps.Equal(nums, tt.wantNums) {
+			t.Errorf("%s: page numbers %v, want %v", tt.name, nums, tt.wantNums)
+		}
+	}
+}
+
+func TestFilterHeaderFooterMaxLines(t *testing.T) {
+	var pages []schema.Page
+	for i := 0; i < 4; i++ {
+		pages = append(pages, bandPage(i,
+			placedText{20, "Journal of Examples"},
+			placedText{40, "Volume 3"},
+			placedText{300, "Body text"},
+		))
+	}
+
+	// Only the first line of the top band is looked at
+	ids, _ := FilterHeaderFooter(pages, 1)
+	want := []string{"0_Journal of Examples", "1_Journal of Examples", "2_Journal of Examples", "3_Journal of Examples"}
+	slices.Sort(ids)
+	if !slices.Equal(ids, want) {
+		t.Errorf("removed %q, want %q", ids, want)
+	}
+}
+
+func TestReplaceLeadingTrailingDigits(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"12 chapter one", "# chapter one"},
+		{"chapter one 12", "chapter one #"},
+		{"3 of 10", "# of #"},
+		{"chapter 1 intro", "chapter 1 intro"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := replaceLeadingTrailingDigits(tt.text, "#"); got != tt.want {
+			t.Errorf("replaceLeadingTrailingDigits(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
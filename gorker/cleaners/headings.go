@@ -1,74 +1,40 @@
-package main
+package cleaners
 
-// Assuming these types are defined elsewhere in your project
-type BBox struct {
-	// Define BBox fields
-}
-
-type Line struct {
-	// Define Line fields
-}
-
-type Block struct {
-	BlockType string
-	Lines     []Line
-	BBox      BBox
-}
-
-type Page struct {
-	Blocks []Block
-	Layout Layout
-	BBox   BBox
-}
-
-type Layout struct {
-	BBoxes    []LayoutBBox
-	ImageBBox BBox
-}
-
-type LayoutBBox struct {
-	BBox  BBox
-	Label string
-}
-
-// Assuming these functions are defined elsewhere
-func rescaleBBox(imageBBox, pageBBox, bbox BBox) BBox {
-	// Implementation of rescaleBBox
-}
-
-func bboxFromLines(lines []Line) BBox {
-	// Implementation of bboxFromLines
-}
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
-func (l Line) intersectionPct(bbox BBox) float64 {
-	// Implementation of intersection percentage calculation
-}
-
-func (b Block) copy() Block {
-	// Implementation of block copy
-}
-
-const BBoxIntersectionThresh = 0.5 // Assuming this is defined in settings
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
 
-func splitHeadingBlocks(pages []Page) {
+func SplitHeadingBlocks(pages []schema.Page) {
 	for i := range pages {
 		page := &pages[i]
+		if page.Layout == nil {
+			continue
+		}
+
 		var pageHeadingBoxes []struct {
-			bbox  BBox
+			bbox  geometry.Bbox
 			label string
 		}
 
-		for _, b := range page.Layout.BBoxes {
+		for _, b := range page.Layout.Bboxes {
 			if b.Label == "Title" || b.Label == "Section-header" {
-				rescaledBBox := rescaleBBox(page.Layout.ImageBBox, page.BBox, b.BBox)
+				rescaledBBox := geometry.RescaleBbox(page.Layout.ImageBbox, page.Bbox, b.Bbox)
 				pageHeadingBoxes = append(pageHeadingBoxes, struct {
-					bbox  BBox
+					bbox  geometry.Bbox
 					label string
 				}{rescaledBBox, b.Label})
 			}
 		}
 
-		var newBlocks []Block
+		var newBlocks []schema.Block
 		for _, block := range page.Blocks {
 			if block.BlockType != "Text" {
 				newBlocks = append(newBlocks, block)
@@ -82,7 +48,7 @@ func splitHeadingBlocks(pages []Page) {
 
 			for lineIdx, line := range block.Lines {
 				for _, headingBox := range pageHeadingBoxes {
-					if line.intersectionPct(headingBox.bbox) > BBoxIntersectionThresh {
+					if line.IntersectionPct(headingBox.bbox) > settings.BboxIntersectionThresh {
 						headingLines = append(headingLines, struct {
 							index int
 							label string
@@ -100,16 +66,16 @@ func splitHeadingBlocks(pages []Page) {
 			start := 0
 			for _, headingLine := range headingLines {
 				if start < headingLine.index {
-					copiedBlock := block.copy()
+					copiedBlock := block.Copy()
 					copiedBlock.Lines = block.Lines[start:headingLine.index]
-					copiedBlock.BBox = bboxFromLines(copiedBlock.Lines)
+					copiedBlock.Bbox = schema.BboxFromLines(copiedBlock.Lines)
 					newBlocks = append(newBlocks, copiedBlock)
 				}
 
-				copiedBlock := block.copy()
+				copiedBlock := block.Copy()
 				copiedBlock.Lines = block.Lines[headingLine.index : headingLine.index+1]
 				copiedBlock.BlockType = headingLine.label
-				copiedBlock.BBox = bboxFromLines(copiedBlock.Lines)
+				copiedBlock.Bbox = schema.BboxFromLines(copiedBlock.Lines)
 				newBlocks = append(newBlocks, copiedBlock)
 
 				start = headingLine.index + 1
@@ -119,9 +85,9 @@ func splitHeadingBlocks(pages []Page) {
 			}
 
 			if start < len(block.Lines) {
-				copiedBlock := block.copy()
+				copiedBlock := block.Copy()
 				copiedBlock.Lines = block.Lines[start:]
-				copiedBlock.BBox = bboxFromLines(copiedBlock.Lines)
+				copiedBlock.Bbox = schema.BboxFromLines(copiedBlock.Lines)
 				newBlocks = append(newBlocks, copiedBlock)
 			}
 		}
@@ -130,9 +96,155 @@ func splitHeadingBlocks(pages []Page) {
 	}
 }
 
-func main() {
-	// Example usage
-	var pages []Page
-	// Initialize pages
-	splitHeadingBlocks(pages)
+// headingNumberRe matches a section number such as "3", "3.2.1" or "A.1" at
+// the start of a heading.
+var headingNumberRe = regexp.MustCompile(`^\s*((?:\d{1,2}|[A-Z])(?:\.\d{1,2})+|\d{1,2})\.?\s+\S`)
+
+const maxHeadingLevel = 6
+
+type headingStyle struct {
+	// size is the index of the heading's font size among the sizes used by
+	// headings, largest first
+	size int
+	bold bool
+}
+
+// InferHeadingLevels sets the level of every heading. Titles are level 1,
+// and section headers are ranked below them by font size, with bold before
+// regular at the same size. Numbered sections like "3.2.1" take their level
+// from the depth of the number instead, and unnumbered headings set like
+// them get the same level.
+func InferHeadingLevels(pages []schema.Page, stats FontStats) {
+	var headings []*schema.Block
+	hasTitle := false
+	for i := range pages {
+		for j := range pages[i].Blocks {
+			block := &pages[i].Blocks[j]
+			switch block.BlockType {
+			case "Title":
+				block.HeadingLevel = 1
+				hasTitle = true
+			case "Section-header":
+				headings = append(headings, block)
+			}
+		}
+	}
+	if len(headings) == 0 {
+		return
+	}
+
+	// Sizes a fraction of a point apart come from the same style in
+	// different fonts
+	sizes := make([]float64, len(headings))
+	bold := make([]bool, len(headings))
+	for i, block := range headings {
+		sizes[i], bold[i] = blockFontStyle(*block, stats)
+	}
+	sorted := append([]float64{}, sizes...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+	tol := math.Max(0.5, stats.BodySize*0.05)
+	var clusterTops []float64
+	for _, size := range sorted {
+		if len(clusterTops) == 0 || clusterTops[len(clusterTops)-1]-size > tol {
+			clusterTops = append(clusterTops, size)
+		}
+	}
+	styles := make([]headingStyle, len(headings))
+	for i, size := range sizes {
+		cluster := len(clusterTops) - 1
+		for cluster > 0 && clusterTops[cluster] < size {
+			cluster--
+		}
+		styles[i] = headingStyle{size: cluster, bold: bold[i]}
+	}
+
+	ranked := make(map[headingStyle]bool)
+	for _, style := range styles {
+		ranked[style] = true
+	}
+	order := make([]headingStyle, 0, len(ranked))
+	for style := range ranked {
+		order = append(order, style)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].size != order[j].size {
+			return order[i].size < order[j].size
+		}
+		return order[i].bold && !order[j].bold
+	})
+	depths := make([]int, len(headings))
+	minDepth := math.MaxInt
+	styleDepths := make(map[headingStyle]map[int]int)
+	for i, block := range headings {
+		depths[i] = sectionDepth(block.PrelimText())
+		if depths[i] == 0 {
+			continue
+		}
+		minDepth = min(minDepth, depths[i])
+		if styleDepths[styles[i]] == nil {
+			styleDepths[styles[i]] = make(map[int]int)
+		}
+		styleDepths[styles[i]][depths[i]]++
+	}
+
+	// The shallowest numbered sections sit right below the title
+	top := 1
+	if hasTitle {
+		top = 2
+	}
+	base := top - minDepth
+
+	// Styles used by numbered sections take the depth most of them have, so
+	// that unnumbered headings like "References" match them, and the other
+	// styles go one level below the style above them
+	styleLevel := make(map[headingStyle]int, len(order))
+	level := top - 1
+	for _, style := range order {
+		if counts := styleDepths[style]; counts != nil {
+			common := 0
+			for depth, count := range counts {
+				if common == 0 || count > counts[common] || count == counts[common] && depth < common {
+					common = depth
+				}
+			}
+			level = base + common
+		} else {
+			level++
+		}
+		styleLevel[style] = level
+	}
+
+	for i, block := range headings {
+		level := styleLevel[styles[i]]
+		if depths[i] > 0 {
+			level = base + depths[i]
+		}
+		block.HeadingLevel = min(level, maxHeadingLevel)
+	}
+}
+
+// sectionDepth returns how many parts the section number at the start of a
+// heading has, or 0 if it isn't numbered.
+func sectionDepth(text string) int {
+	m := headingNumberRe.FindStringSubmatch(text)
+	if m == nil {
+		return 0
+	}
+	return strings.Count(m[1], ".") + 1
+}
+
+// blockFontStyle returns the font size of the longest span of a block and
+// whether it is bold. Bold says nothing when the body text is bold too.
+func blockFontStyle(block schema.Block, stats FontStats) (float64, bool) {
+	var longest schema.Span
+	longestLen := -1
+	for _, line := range block.Lines {
+		for _, span := range line.Spans {
+			if n := utf8.RuneCountInString(strings.TrimSpace(span.Text)); n > longestLen {
+				longest, longestLen = span, n
+			}
+		}
+	}
+	bold := longest.Bold || strings.Contains(strings.ToLower(longest.Font), "bold")
+	return longest.FontSize, bold && stats.BodyWeight < 600
 }
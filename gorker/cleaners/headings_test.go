@@ -0,0 +1,167 @@
+package cleaners
+
+import (
+	"testing"
+
+	"gorker/gorker/schema"
+)
+
+// styledBlock returns a block of one line set in font at size.
+func styledBlock(blockType, text, font string, size float64) schema.Block {
+	line := textLine(text, 72, 100)
+	line.Spans[0].Font, line.Spans[0].FontSize = font, size
+	return textBlock(blockType, line)
+}
+
+func TestInferHeadingLevels(t *testing.T) {
+	body := FontStats{BodySize: 10, BodyWeight: 400}
+	tests := []struct {
+		name   string
+		blocks []schema.Block
+		want   []int
+	}{
+		{
+			name: "section numbers set the level",
+			blocks: []schema.Block{
+				styledBlock("Section-header", "1 Introduction", "Times", 14),
+				styledBlock("Section-header", "1.1 Background", "Times", 12),
+				styledBlock("Section-header", "1.1.1 Prior work", "Times", 11),
+				styledBlock("Section-header", "2. Methods", "Times", 14),
+			},
+			want: []int{1, 2, 3, 1},
+		},
+		{
+			name: "numbered sections sit below the title",
+			blocks: []schema.Block{
+				styledBlock("Title", "A Study of Things", "Times", 20),
+				styledBlock("Section-header", "3 Results", "Times", 14),
+				styledBlock("Section-header", "3.2 Errors", "Times", 12),
+				styledBlock("Section-header", "A.1 Proofs", "Times", 12),
+			},
+			want: []int{1, 2, 3, 3},
+		},
+		{
+			name: "unnumbered headings match numbered ones in their style",
+			blocks: []schema.Block{
+				styledBlock("Section-header", "1 Introduction", "Times", 14),
+				styledBlock("Section-header", "1.1 Background", "Times", 12),
+				styledBlock("Section-header", "References", "Times", 14),
+				styledBlock("Section-header", "Notation", "Times", 12),
+			},
+			want: []int{1, 2, 1, 2},
+		},
+		{
+			name: "levels from font size",
+			blocks: []schema.Block{
+				styledBlock("Section-header", "Overview", "Times", 18),
+				styledBlock("Section-header", "Details", "Times", 12),
+				styledBlock("Section-header", "Scope", "Times", 14),
+				// A fraction of a point off is the same size
+				styledBlock("Section-header", "Goals", "Times", 14.3),
+			},
+			want: []int{1, 3, 2, 2},
+		},
+		{
+			name: "bold ranks above regular at the same size",
+			blocks: []schema.Block{
+				styledBlock("Section-header", "Plain", "Times", 12),
+				styledBlock("Section-header", "Strong", "Times-Bold", 12),
+			},
+			want: []int{2, 1},
+		},
+		{
+			name:   "default level",
+			blocks: []schema.Block{styledBlock("Section-header", "Summary", "Times", 12)},
+			want:   []int{1},
+		},
+		{
+			name: "default level under a title",
+			blocks: []schema.Block{
+				styledBlock("Title", "Report", "Times", 20),
+				styledBlock("Section-header", "Summary", "Times", 12),
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "deep numbers stop at the last markdown level",
+			blocks: []schema.Block{
+				styledBlock("Section-header", "1 Top", "Times", 12),
+				styledBlock("Section-header", "1.2.3.4.5.6.7 Bottom", "Times", 12),
+			},
+			want: []int{1, 6},
+		},
+		{
+			name: "text blocks get no level",
+			blocks: []schema.Block{
+				styledBlock("Text", "1 Introduction to the text", "Times", 10),
+				styledBlock("Section-header", "Summary", "Times", 12),
+			},
+			want: []int{0, 1},
+		},
+	}
+	for _, tt := range tests {
+		pages := []schema.Page{{Blocks: tt.blocks}}
+		InferHeadingLevels(pages, body)
+		for i, want := range tt.want {
+			block := pages[0].Blocks[i]
+			if block.HeadingLevel != want {
+				t.Errorf("%s: %q has level %d, want %d", tt.name, block.PrelimText(), block.HeadingLevel, want)
+			}
+		}
+	}
+}
+
+func TestSectionDepth(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"3 Results", 1},
+		{"3. Results", 1},
+		{"3.2.1 Errors", 3},
+		{"A.1 Proofs", 2},
+		{"Results", 0},
+		{"2024 was a year", 0},
+		{"3.2", 0},
+		{"A Study", 0},
+	}
+	for _, tt := range tests {
+		if got := sectionDepth(tt.text); got != tt.want {
+			t.Errorf("sectionDepth(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFindBoldItalic(t *testing.T) {
+	weighted := func(text, font string, size, weight float64) schema.Block {
+		block := styledBlock("Text", text, font, size)
+		block.Lines[0].Spans[0].FontWeight = weight
+		return block
+	}
+	pages := []schema.Page{{Blocks: []schema.Block{
+		weighted("Body text", "Times", 10, 400),
+		weighted("More body text", "Times", 10, 400),
+		weighted("Emphasis", "Times-Italic", 10, 400),
+		weighted("Heavy", "Times", 10, 700),
+		weighted("Named bold", "Times-Bold", 11, 400),
+		// Headings don't count towards the body text
+		{Lines: styledBlock("", "Heading", "Times", 24).Lines, BlockType: "Section-header"},
+		{Lines: styledBlock("", "Title", "Times", 30).Lines, BlockType: "Title"},
+	}}}
+
+	stats := FindBoldItalic(pages, 600)
+	if stats.BodySize != 10 || stats.BodyWeight != 400 {
+		t.Errorf("stats = %+v, want a body size of 10 and weight of 400", stats)
+	}
+	want := []struct{ bold, italic bool }{{false, false}, {false, false}, {false, true}, {true, false}, {true, false}}
+	for i, w := range want {
+		span := pages[0].Blocks[i].Lines[0].Spans[0]
+		if span.Bold != w.bold || span.Italic != w.italic {
+			t.Errorf("%q: bold %v italic %v, want %v %v", span.Text, span.Bold, span.Italic, w.bold, w.italic)
+		}
+	}
+
+	if stats := FindBoldItalic(nil, 600); stats != (FontStats{}) {
+		t.Errorf("stats without text = %+v, want none", stats)
+	}
+}
@@ -0,0 +1,358 @@
+package cleaners
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gorker/gorker/schema"
+)
+
+// listIndentTol is how far, in points, the markers of items at the same
+// nesting level may stray from each other.
+const listIndentTol = 4
+
+// Bullet glyphs often sit in their own span with no space after them, so only
+// the ASCII ones need one.
+var listMarkerRe = regexp.MustCompile(`^\s*(?:([•●○■□▪▫◦‣–—·])\s*|([-*+])\s+|\(?(\d{1,3})[.)]\s+|\(?([a-zA-Z])[.)]\s+|\(?([ivxl]{1,6}|[IVXL]{1,6})[.)]\s+)`)
+
+type listMarker struct {
+	length int
+	// number is the item's number, or 0 for a bullet
+	number int
+	roman  bool
+	// letter is a single letter marker that could also be a roman numeral
+	letter string
+	// dash is a dash or dot marker, which also starts ordinary lines
+	dash string
+}
+
+// dashMarkers are bullets that only mark an item on an indented line, or when
+// several lines start with them.
+const dashMarkers = "–—·"
+
+// parseListMarker reads the marker at the start of a line, if there is one.
+func parseListMarker(text string) (listMarker, bool) {
+	m := listMarkerRe.FindStringSubmatchIndex(text)
+	if m == nil || strings.TrimSpace(text[m[1]:]) == "" {
+		return listMarker{}, false
+	}
+	marker := listMarker{length: m[1]}
+	group := func(i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return text[m[2*i]:m[2*i+1]]
+	}
+	switch {
+	case strings.Contains(dashMarkers, group(1)) && group(1) != "":
+		marker.dash = group(1)
+	case group(3) != "":
+		marker.number, _ = strconv.Atoi(group(3))
+	case group(4) != "":
+		marker.letter = group(4)
+		marker.number = int(unicode.ToLower(rune(marker.letter[0]))-'a') + 1
+	case group(5) != "":
+		marker.number = romanValue(group(5))
+		marker.roman = marker.number > 0
+		if !marker.roman {
+			return listMarker{}, false
+		}
+	}
+	return marker, true
+}
+
+// romanValue returns the value of a roman numeral, or 0 if it isn't one.
+func romanValue(s string) int {
+	values := map[rune]int{'i': 1, 'v': 5, 'x': 10, 'l': 50}
+	runes := []rune(strings.ToLower(s))
+	total := 0
+	for i, r := range runes {
+		v := values[r]
+		if i+1 < len(runes) && v < values[runes[i+1]] {
+			total -= v
+		} else {
+			total += v
+		}
+	}
+	// Reject letter runs like "vix" that only look like numerals
+	if total <= 0 || total > 50 || strings.ToLower(toRoman(total)) != string(runes) {
+		return 0
+	}
+	return total
+}
+
+func toRoman(n int) string {
+	numerals := []struct {
+		value int
+		text  string
+	}{{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"}}
+	var sb strings.Builder
+	for _, numeral := range numerals {
+		for n >= numeral.value {
+			sb.WriteString(numeral.text)
+			n -= numeral.value
+		}
+	}
+	return sb.String()
+}
+
+// listLevel is an open list at one nesting level.
+type listLevel struct {
+	x      float64
+	number int
+	// indent is the width of the text before the items' content, which
+	// items nested under them are indented by.
+	indent int
+	roman  bool
+}
+
+// FormatLists rewrites each run of list item blocks as a markdown list. Items
+// start at lines with a bullet or a number, letter or roman numeral, the
+// lines after them are joined onto the item, and items are nested by how far
+// their marker is indented. Each item becomes a single line. It returns the
+// number of lists.
+func FormatLists(pages []schema.Page) int {
+	listCount := 0
+	for i := range pages {
+		page := &pages[i]
+		var newBlocks []schema.Block
+		for start := 0; start < len(page.Blocks); {
+			if page.Blocks[start].BlockType != "List-item" {
+				newBlocks = append(newBlocks, page.Blocks[start])
+				start++
+				continue
+			}
+			end := start
+			var lines []schema.Line
+			markerX := math.Inf(1)
+			for end < len(page.Blocks) {
+				block := page.Blocks[end]
+				if block.BlockType != "List-item" && (block.BlockType != "Text" || !wrapsItem(lines, markerX, block)) {
+					break
+				}
+				blockLines := joinMarkerLines(block.Lines)
+				for _, line := range blockLines {
+					if _, ok := parseListMarker(line.PrelimText()); ok {
+						markerX = line.Bbox.X0()
+					}
+				}
+				lines = append(lines, blockLines...)
+				end++
+			}
+
+			// Lines before the first marker aren't part of an item
+			indents, dashes := lineIndents(lines), countDashMarkers(lines)
+			first := 0
+			for first < len(lines) {
+				if marker, ok := parseListMarker(lines[first].PrelimText()); ok && marksItem(marker, indents[first], dashes) {
+					break
+				}
+				first++
+			}
+			if first > 0 {
+				newBlocks = append(newBlocks, schema.Block{Lines: lines[:first], Bbox: schema.BboxFromLines(lines[:first]), Pnum: page.Pnum, BlockType: "Text"})
+			}
+			if first < len(lines) {
+				items := formatListItems(lines[first:])
+				newBlocks = append(newBlocks, schema.Block{Lines: items, Bbox: schema.BboxFromLines(items), Pnum: page.Pnum, BlockType: "List-item"})
+				listCount++
+			}
+			start = end
+		}
+		page.Blocks = newBlocks
+	}
+	return listCount
+}
+
+// joinMarkerLines joins markers that were read as lines of their own to the
+// text beside them.
+func joinMarkerLines(lines []schema.Line) []schema.Line {
+	var joined []schema.Line
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		text := line.PrelimText()
+		if i+1 < len(lines) && strings.TrimSpace(text) != "" && len(listMarkerRe.FindString(text+" ")) == len(text)+1 {
+			next := lines[i+1]
+			if next.Bbox.X0() >= line.Bbox.X1() && next.Bbox.OverlapYPct(line.Bbox) > 0.5 {
+				spans := append([]schema.Span{}, line.Spans...)
+				spans[len(spans)-1].Text += " "
+				joined = append(joined, schema.Line{Spans: append(spans, next.Spans...), Bbox: line.Bbox.Union(next.Bbox)})
+				i++
+				continue
+			}
+		}
+		joined = append(joined, line)
+	}
+	return joined
+}
+
+// wrapsItem reports whether a text block starts with the wrapped lines of the
+// last item, which happens when the item's lines were split into another
+// block. They are indented past the item's marker and follow it closely.
+func wrapsItem(lines []schema.Line, markerX float64, block schema.Block) bool {
+	if len(lines) == 0 || len(block.Lines) == 0 {
+		return false
+	}
+	last, next := lines[len(lines)-1].Bbox, block.Lines[0].Bbox
+	return next.X0() > markerX+listIndentTol && next.X0() < last.X1() && next.Y0() > last.Y0() && next.Y0()-last.Y1() <= last.Height()
+}
+
+// lineIndents returns how far each line is indented from the left of its
+// column. Indents are measured per column, as a list can run on into the
+// next one.
+func lineIndents(lines []schema.Line) []float64 {
+	indents := make([]float64, len(lines))
+	for start := 0; start < len(lines); {
+		end, left := start+1, lines[start].Bbox.X0()
+		for end < len(lines) && lines[end].Bbox.Y0() > lines[end-1].Bbox.Y0() {
+			left = math.Min(left, lines[end].Bbox.X0())
+			end++
+		}
+		for i := start; i < end; i++ {
+			indents[i] = lines[i].Bbox.X0() - left
+		}
+		start = end
+	}
+	return indents
+}
+
+// countDashMarkers counts the lines starting with each dash marker.
+func countDashMarkers(lines []schema.Line) map[string]int {
+	counts := make(map[string]int)
+	for _, line := range lines {
+		if marker, ok := parseListMarker(line.PrelimText()); ok && marker.dash != "" {
+			counts[marker.dash]++
+		}
+	}
+	return counts
+}
+
+// marksItem reports whether a marker starts a list item. A dash does when its
+// line is indented or other lines start with the same dash, so a line of
+// dialogue or an attribution isn't made a list.
+func marksItem(marker listMarker, indent float64, dashes map[string]int) bool {
+	return marker.dash == "" || indent > listIndentTol || dashes[marker.dash] > 1
+}
+
+func formatListItems(lines []schema.Line) []schema.Line {
+	indents, dashes := lineIndents(lines), countDashMarkers(lines)
+
+	var items []schema.Line
+	var levels []listLevel
+	for i, line := range lines {
+		x := indents[i]
+		marker, ok := parseListMarker(line.PrelimText())
+		if ok && len(items) > 0 && (!marksItem(marker, x, dashes) || !startsItem(marker, x, levels)) {
+			ok = false
+		}
+		if !ok && len(items) > 0 {
+			// A wrapped line of the item above
+			item := &items[len(items)-1]
+			item.Spans = joinWrapped(item.Spans, line.Spans)
+			item.Bbox = item.Bbox.Union(line.Bbox)
+			continue
+		}
+
+		for len(levels) > 0 && levels[len(levels)-1].x > x+listIndentTol {
+			levels = levels[:len(levels)-1]
+		}
+		sibling, siblingRoman := false, false
+		if n := len(levels); n > 0 && levels[n-1].x >= x-listIndentTol {
+			sibling, siblingRoman = true, levels[n-1].roman
+			levels = levels[:n-1]
+		}
+
+		// A lone letter that is also a numeral is one when it starts a list
+		// with i or follows numerals, as in "ii." and "iii."
+		if marker.letter != "" {
+			lower := strings.ToLower(marker.letter)
+			if sibling && siblingRoman && romanValue(lower) > 0 || !sibling && lower == "i" {
+				marker.number = romanValue(lower)
+				marker.roman = true
+			}
+		}
+
+		indent := 0
+		if len(levels) > 0 {
+			indent = levels[len(levels)-1].indent
+		}
+		prefix := "-"
+		if marker.number > 0 {
+			prefix = strconv.Itoa(marker.number) + "."
+		}
+		prefix = strings.Repeat(" ", indent) + prefix + " "
+		levels = append(levels, listLevel{x: x, number: marker.number, indent: len(prefix), roman: marker.roman})
+
+		spans := trimSpans(line.Spans, marker.length)
+		if len(spans) == 0 {
+			continue
+		}
+		markerSpan := spans[0]
+		markerSpan.Text = prefix
+		markerSpan.SpanID = fmt.Sprintf("%s_list", spans[0].SpanID)
+		items = append(items, schema.Line{Spans: append([]schema.Span{markerSpan}, spans...), Bbox: line.Bbox})
+	}
+	return items
+}
+
+// startsItem reports whether a numbered line starts an item rather than
+// being a wrapped line that happens to begin with a number. A nested list
+// starts at one and the items of a list count up.
+func startsItem(marker listMarker, x float64, levels []listLevel) bool {
+	if marker.number == 0 || marker.roman || marker.letter != "" && strings.ContainsAny(marker.letter, "iI") {
+		return true
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		switch {
+		case levels[i].x > x+listIndentTol:
+			continue
+		case levels[i].x >= x-listIndentTol:
+			return levels[i].number == 0 || marker.number == levels[i].number+1
+		default:
+			return marker.number == 1
+		}
+	}
+	// An item left of all the others, as when a list carries on from a
+	// nested item on the page before
+	return true
+}
+
+// trimSpans drops the first n bytes of text from the spans, removing spans
+// that are left empty.
+func trimSpans(spans []schema.Span, n int) []schema.Span {
+	var trimmed []schema.Span
+	for _, span := range spans {
+		if n >= len(span.Text) {
+			n -= len(span.Text)
+			continue
+		}
+		span.Text = span.Text[n:]
+		n = 0
+		trimmed = append(trimmed, span)
+	}
+	return trimmed
+}
+
+// joinWrapped appends the spans of a wrapped line to an item, removing the
+// line break hyphen of a split word or adding a space between them.
+func joinWrapped(item, next []schema.Span) []schema.Span {
+	if len(item) == 0 || len(next) == 0 {
+		return append(item, next...)
+	}
+	last := &item[len(item)-1]
+	text := strings.TrimRight(last.Text, " ")
+	nextText := strings.TrimLeft(next[0].Text, " ")
+	runes := []rune(text)
+	if n := len(runes); n >= 2 && runes[n-1] == '-' && unicode.IsLower(runes[n-2]) && strings.IndexFunc(nextText, unicode.IsLower) == 0 {
+		last.Text = string(runes[:n-1])
+	} else {
+		last.Text = text + " "
+	}
+	first := next[0]
+	first.Text = nextText
+	return append(append(item, first), next[1:]...)
+}
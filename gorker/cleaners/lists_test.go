@@ -0,0 +1,133 @@
+package cleaners
+
+import (
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// textLine returns a line of 10 point text at x, y, about as wide as its
+// text.
+func textLine(text string, x, y float64) schema.Line {
+	bbox := geometry.Bbox{x, y, x + 5*float64(len([]rune(text))), y + 10}
+	return schema.Line{
+		Spans: []schema.Span{{Text: text, Bbox: bbox, SpanID: "0_0", Font: "TimesNewRoman", FontSize: 10}},
+		Bbox:  bbox,
+	}
+}
+
+func textBlock(blockType string, lines ...schema.Line) schema.Block {
+	return schema.Block{Lines: lines, Bbox: schema.BboxFromLines(lines), BlockType: blockType}
+}
+
+func TestFormatLists(t *testing.T) {
+	type block struct {
+		blockType string
+		text      string
+	}
+	tests := []struct {
+		name   string
+		blocks []schema.Block
+		want   []block
+		lists  int
+	}{
+		{
+			name: "item lines split into a text block",
+			blocks: []schema.Block{
+				textBlock("List-item", textLine("• First item", 72, 100)),
+				textBlock("Text", textLine("continues here", 84, 112)),
+				textBlock("List-item", textLine("• Second item", 72, 124)),
+				textBlock("Text", textLine("A paragraph after the list.", 72, 160)),
+			},
+			want: []block{
+				{"List-item", "- First item continues here\n- Second item"},
+				{"Text", "A paragraph after the list."},
+			},
+			lists: 1,
+		},
+		{
+			name: "markers on lines of their own",
+			blocks: []schema.Block{
+				textBlock("List-item",
+					textLine("•", 72, 100), textLine("Alpha", 84, 100),
+					textLine("•", 72, 112), textLine("Beta", 84, 112)),
+			},
+			want:  []block{{"List-item", "- Alpha\n- Beta"}},
+			lists: 1,
+		},
+		{
+			name: "nested by indentation",
+			blocks: []schema.Block{
+				textBlock("List-item",
+					textLine("1. Top", 72, 100),
+					textLine("a) Under top", 90, 112),
+					textLine("b) Also under top", 90, 124),
+					textLine("• Deeper", 108, 136),
+					textLine("2. Next", 72, 148)),
+			},
+			want:  []block{{"List-item", "1. Top\n   1. Under top\n   2. Also under top\n      - Deeper\n2. Next"}},
+			lists: 1,
+		},
+		{
+			name: "number that continues a wrapped line",
+			blocks: []schema.Block{
+				textBlock("List-item",
+					textLine("1. Costs rose by", 72, 100),
+					textLine("12. percent", 72, 112),
+					textLine("2. Prices fell", 72, 124)),
+			},
+			want:  []block{{"List-item", "1. Costs rose by 12. percent\n2. Prices fell"}},
+			lists: 1,
+		},
+		{
+			name:   "lone dash is an attribution",
+			blocks: []schema.Block{textBlock("List-item", textLine("— Alan Kay", 72, 100))},
+			want:   []block{{"Text", "— Alan Kay"}},
+		},
+		{
+			name: "repeated dashes are a list",
+			blocks: []schema.Block{
+				textBlock("List-item", textLine("– one", 72, 100), textLine("– two", 72, 112)),
+			},
+			want:  []block{{"List-item", "- one\n- two"}},
+			lists: 1,
+		},
+		{
+			name: "indented dash is an item",
+			blocks: []schema.Block{
+				textBlock("List-item", textLine("Options are:", 72, 100), textLine("· verbose", 90, 112)),
+			},
+			want:  []block{{"Text", "Options are:"}, {"List-item", "- verbose"}},
+			lists: 1,
+		},
+		{
+			name: "dash starting a wrapped line",
+			blocks: []schema.Block{
+				textBlock("List-item",
+					textLine("• The answer came", 72, 100),
+					textLine("— as expected", 72, 112),
+					textLine("• Another item", 72, 124)),
+			},
+			want:  []block{{"List-item", "- The answer came — as expected\n- Another item"}},
+			lists: 1,
+		},
+	}
+	for _, tt := range tests {
+		pages := []schema.Page{{Blocks: tt.blocks}}
+		lists := FormatLists(pages)
+		if lists != tt.lists {
+			t.Errorf("%s: got %d lists, want %d", tt.name, lists, tt.lists)
+		}
+		got := pages[0].Blocks
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d blocks, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			if got[i].BlockType != w.blockType || got[i].PrelimText() != w.text {
+				t.Errorf("%s: block %d = %s %q, want %s %q", tt.name, i, got[i].BlockType, got[i].PrelimText(), w.blockType, w.text)
+			}
+		}
+	}
+}
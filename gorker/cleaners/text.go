@@ -1,11 +1,11 @@
-package main
+package cleaners
 
 import (
 	"regexp"
 	"strings"
 )
 
-func cleanupText(fullText string) string {
+func CleanupText(fullText string) string {
 	// Replace 3 or more newlines with 2 newlines
 	re := regexp.MustCompile(`\n{3,}`)
 	fullText = re.ReplaceAllString(fullText, "\n\n")
@@ -19,10 +19,3 @@ func cleanupText(fullText string) string {
 
 	return fullText
 }
-
-func main() {
-	// Example usage
-	text := "This is a\n\n\ntest\n \n \ntext with\u00A0non-breaking\u00A0spaces."
-	cleanedText := cleanupText(text)
-	println(cleanedText)
-}
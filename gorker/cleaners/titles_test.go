@@ -0,0 +1,151 @@
+package cleaners
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
+
+func heading(text string) schema.FullyMergedBlock {
+	return schema.FullyMergedBlock{Text: text, BlockType: "Section-header"}
+}
+
+// uniqueHeadings returns n headings unlike each other and the ones tests
+// repeat.
+func uniqueHeadings(n int) []schema.FullyMergedBlock {
+	words := []string{"Apples", "Bridges", "Compilers", "Deserts", "Engines", "Forests", "Glaciers", "Harbors", "Islands", "Jungles"}
+	var blocks []schema.FullyMergedBlock
+	for i := 0; i < n; i++ {
+		blocks = append(blocks, heading(fmt.Sprintf("## %s of %s", words[i%len(words)], words[(i*3+1)%len(words)])))
+	}
+	return blocks
+}
+
+func TestFilterCommonTitles(t *testing.T) {
+	defer func(thresh, share float64) {
+		settings.CommonTitleMatchThresh, settings.CommonTitleMinShare = thresh, share
+	}(settings.CommonTitleMatchThresh, settings.CommonTitleMinShare)
+	settings.CommonTitleMatchThresh, settings.CommonTitleMinShare = 0.9, 0.05
+
+	tests := []struct {
+		name   string
+		blocks []schema.FullyMergedBlock
+		want   []DroppedTitle
+		thresh float64
+	}{
+		{
+			name: "exact repeats with page numbers",
+			blocks: append(uniqueHeadings(10),
+				heading("## 12 Chapter 3: Results"), heading("## Chapter 3: Results 13"),
+				heading("## Chapter 3: Results"), heading("## chapter 3:  results")),
+			want: []DroppedTitle{
+				{"## 12 Chapter 3: Results", 3, "repeated 4 times"},
+				{"## Chapter 3: Results 13", 3, "repeated 4 times"},
+				{"## Chapter 3: Results", 3, "repeated 4 times"},
+				{"## chapter 3:  results", 3, "repeated 4 times"},
+			},
+		},
+		{
+			name: "near repeats",
+			blocks: append(uniqueHeadings(10),
+				heading("# The Theory of Everything"), heading("# The Theory of Everythin"),
+				heading("# The Theory of Everyth1ng"), heading("# The Theory of Every thing")),
+			want: []DroppedTitle{
+				{"# The Theory of Everything", 3, `95% alike to "the theory of everythin"`},
+				{"# The Theory of Everythin", 3, `95% alike to "the theory of everything"`},
+				{"# The Theory of Everyth1ng", 3, `91% alike to "the theory of everythin"`},
+				{"# The Theory of Every thing", 3, `92% alike to "the theory of everythin"`},
+			},
+		},
+		{
+			name: "near repeats below a stricter threshold",
+			blocks: append(uniqueHeadings(10),
+				heading("# The Theory of Everything"), heading("# The Theory of Everythin"),
+				heading("# The Theory of Everyth1ng"), heading("# The Theory of Every thing")),
+			thresh: 1,
+		},
+		{
+			name:   "too few repeats",
+			blocks: append(uniqueHeadings(10), heading("## Methods"), heading("## Methods"), heading("## Methods")),
+		},
+		{
+			name: "text blocks and empty headings",
+			blocks: []schema.FullyMergedBlock{
+				{Text: "Results", BlockType: "Text"}, {Text: "Results", BlockType: "Text"},
+				{Text: "Results", BlockType: "Text"}, {Text: "Results", BlockType: "Text"},
+				heading("##"), heading("## 12"), heading("   "),
+			},
+		},
+	}
+	for _, tt := range tests {
+		settings.CommonTitleMatchThresh = 0.9
+		if tt.thresh > 0 {
+			settings.CommonTitleMatchThresh = tt.thresh
+		}
+		kept, dropped := FilterCommonTitles(tt.blocks)
+		if !slices.Equal(dropped, tt.want) {
+			t.Errorf("%s: dropped %+v, want %+v", tt.name, dropped, tt.want)
+		}
+		if len(kept)+len(dropped) != len(tt.blocks) {
+			t.Errorf("%s: kept %d and dropped %d of %d blocks", tt.name, len(kept), len(dropped), len(tt.blocks))
+		}
+	}
+}
+
+// TestFilterCommonTitlesBuckets checks that only comparing texts of similar
+// length finds the same repeats as comparing every pair.
+func TestFilterCommonTitlesBuckets(t *testing.T) {
+	defer func(thresh, share float64) {
+		settings.CommonTitleMatchThresh, settings.CommonTitleMinShare = thresh, share
+	}(settings.CommonTitleMatchThresh, settings.CommonTitleMinShare)
+	settings.CommonTitleMatchThresh, settings.CommonTitleMinShare = 0.8, 0.01
+
+	// Running titles of many lengths, each with a few misspellings
+	var blocks []schema.FullyMergedBlock
+	titles := []string{"Part", "Part One", "Chapter Two", "Chapter Twelve", "The Long Road Home", "Appendix: Notes on the Sources", "Index"}
+	for i := 0; i < 300; i++ {
+		title := []rune(titles[i%len(titles)])
+		if i%3 == 1 {
+			title[i%len(title)] = 'x'
+		}
+		if i%5 == 2 {
+			title = title[:len(title)-1]
+		}
+		blocks = append(blocks, heading("# "+string(title)))
+	}
+	blocks = append(blocks, uniqueHeadings(10)...)
+
+	// Count the alike headings of every heading by comparing all of them
+	texts := make([]string, len(blocks))
+	for i, block := range blocks {
+		texts[i] = normalizeTitle(block.Text)
+	}
+	minMatches := math.Max(3, float64(len(blocks))*settings.CommonTitleMinShare)
+	var want []string
+	for i, a := range texts {
+		similar := 0
+		for j, b := range texts {
+			if i != j && stringRatio(a, b) >= settings.CommonTitleMatchThresh {
+				similar++
+			}
+		}
+		if float64(similar) >= minMatches {
+			want = append(want, blocks[i].Text)
+		}
+	}
+
+	_, dropped := FilterCommonTitles(blocks)
+	var got []string
+	for _, d := range dropped {
+		got = append(got, d.Text)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if len(want) == 0 || !slices.Equal(got, want) {
+		t.Errorf("dropped %d headings, want the %d found by comparing every pair", len(got), len(want))
+	}
+}
@@ -0,0 +1,240 @@
+// Package gorker converts PDFs and other documents into markdown.
+package gorker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/gen2brain/go-fitz"
+
+	"gorker/gorker/cleaners"
+	"gorker/gorker/equations"
+	"gorker/gorker/images"
+	"gorker/gorker/layout"
+	"gorker/gorker/markdown"
+	"gorker/gorker/ocr"
+	"gorker/gorker/pdf"
+	"gorker/gorker/settings"
+	"gorker/gorker/tables"
+)
+
+var (
+	ErrUnsupportedFiletype = errors.New("unsupported file type")
+	ErrNoText              = errors.New("could not extract any text blocks")
+)
+
+// Options controls a single conversion.
+type Options struct {
+	// MaxPages limits the number of pages converted. 0 converts all of them.
+	MaxPages int
+	// StartPage is the zero-based page to start converting at.
+	StartPage int
+	// Langs are the document languages, either as names ("English") or as
+	// OCR codes ("eng"). If empty they are detected from the text, see
+	// settings.LangDetect.
+	Langs []string
+	// BatchMultiplier scales the batch sizes of the detection and recognition
+	// steps. 0 is treated as 1.
+	BatchMultiplier int
+}
+
+// Result is a converted document.
+type Result struct {
+	Markdown string
+	// Images referenced from Markdown, keyed by filename.
+	Images map[string]image.Image
+	// Metadata describes the conversion. Its "errors" are the failures of
+	// steps the document was converted without, like layout detection.
+	Metadata map[string]interface{}
+}
+
+// Convert reads a document from r and converts it to markdown.
+func Convert(ctx context.Context, r io.Reader, opts Options) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading document: %w", err)
+	}
+
+	batchMultiplier := opts.BatchMultiplier
+	if batchMultiplier <= 0 {
+		batchMultiplier = 1
+	}
+
+	langs := ocr.ReplaceLangsWithCodes(opts.Langs)
+	if err := ocr.ValidateLangs(langs); err != nil {
+		return nil, err
+	}
+
+	filetype := FindFiletype(data)
+	if filetype == "other" {
+		return nil, ErrUnsupportedFiletype
+	}
+	outMeta := map[string]interface{}{
+		"filetype": filetype,
+	}
+	stepErrors := []string{}
+
+	doc, err := fitz.NewFromMemory(data)
+	if err != nil {
+		return nil, fmt.Errorf("opening document: %w", err)
+	}
+	defer doc.Close()
+
+	pages, toc, err := pdf.GetTextBlocks(doc, opts.MaxPages, opts.StartPage)
+	if err != nil {
+		return nil, err
+	}
+	outMeta["toc"] = toc
+	outMeta["pages"] = len(pages)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Pick the OCR languages from the text layer if we weren't given any
+	outMeta["languages_detected"] = false
+	if len(langs) == 0 && settings.LangDetect != "none" {
+		langs = ocr.DetectDocumentLanguages(pages)
+		outMeta["languages_detected"] = true
+		if settings.LangDetect == "page" {
+			ocr.DetectPageLanguages(pages)
+			pageLangs := make([][]string, len(pages))
+			for i, page := range pages {
+				pageLangs[i] = page.Langs
+			}
+			outMeta["page_languages"] = pageLangs
+		}
+	}
+	outMeta["languages"] = langs
+
+	engine, err := ocr.NewEngine(langs)
+	if err != nil {
+		return nil, err
+	}
+	if engine != nil {
+		defer engine.Close()
+
+		// Text line detection only feeds the OCR decision, so a page without
+		// it is still converted from its embedded text.
+		err := ocr.DetectTextLines(ctx, doc, pages, engine)
+		stepErrors = recordErrors(stepErrors, "detecting text lines", err)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var newEngine ocr.EngineFactory
+	if engine != nil {
+		newEngine = func(pageLangs []string) (ocr.OCREngine, error) {
+			if len(pageLangs) == 0 {
+				pageLangs = langs
+			}
+			return ocr.NewEngine(pageLangs)
+		}
+	}
+	pages, ocrStats, pageQuality, err := ocr.RunOCR(ctx, doc, pages, newEngine)
+	stepErrors = recordErrors(stepErrors, "running OCR", err)
+	outMeta["ocr_stats"] = ocrStats
+	outMeta["page_quality"] = pageQuality
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	blockCount := 0
+	for _, page := range pages {
+		blockCount += len(page.Blocks)
+	}
+	if blockCount == 0 {
+		return nil, ErrNoText
+	}
+
+	// Label the regions of each page
+	analyzer, err := layout.NewAnalyzer(pages, tables.FindTables)
+	if err != nil {
+		return nil, err
+	}
+	if analyzer != nil {
+		err := layout.DetectLayout(doc, pages, analyzer)
+		stepErrors = recordErrors(stepErrors, "detecting layout", err)
+		layout.AnnotateBlockTypes(pages)
+	}
+
+	// Find headers and footers
+	badSpanIDs, pageNumbers := cleaners.FilterHeaderFooter(pages, settings.HeaderFooterMaxLines)
+	blockStats := map[string]interface{}{"header_footer": len(badSpanIDs)}
+	outMeta["page_numbers"] = pageNumbers
+	outMeta["block_stats"] = blockStats
+
+	// Find reading order for blocks
+	layout.DetectOrder(pages)
+	layout.SortBlocksInReadingOrder(pages)
+
+	// Fix code blocks
+	blockStats["code"] = cleaners.IdentifyCodeBlocks(pages)
+	cleaners.IndentBlocks(pages)
+
+	badSpans := make(map[string]bool, len(badSpanIDs))
+	for _, spanID := range badSpanIDs {
+		badSpans[spanID] = true
+	}
+	for i := range pages {
+		for j := range pages[i].Blocks {
+			pages[i].Blocks[j].FilterSpans(badSpans)
+		}
+	}
+
+	// Rebuild tables from their rulings and text
+	blockStats["table"] = tables.FormatTables(pages)
+
+	recognizer, err := equations.NewRecognizer()
+	if err != nil {
+		return nil, err
+	}
+	pages, eqStats, err := equations.ReplaceEquations(ctx, doc, pages, recognizer, batchMultiplier)
+	blockStats["equations"] = eqStats
+	stepErrors = recordErrors(stepErrors, "replacing equations", err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Extract images and figures
+	if settings.ExtractImages {
+		err := images.ExtractImages(doc, pages)
+		stepErrors = recordErrors(stepErrors, "extracting images", err)
+	}
+
+	// Split out headers
+	cleaners.SplitHeadingBlocks(pages)
+	fontStats := cleaners.FindBoldItalic(pages, 600)
+	cleaners.InferHeadingLevels(pages, fontStats)
+
+	// Nest and number list items
+	blockStats["list"] = cleaners.FormatLists(pages)
+
+	fullText, droppedTitles := markdown.Render(pages)
+	outMeta["dropped_titles"] = droppedTitles
+	outMeta["errors"] = stepErrors
+
+	return &Result{
+		Markdown: fullText,
+		Images:   images.ImagesToDict(pages),
+		Metadata: outMeta,
+	}, nil
+}
+
+// recordErrors adds the failures of a step the conversion carried on without
+// to errs, one for each error joined in err.
+func recordErrors(errs []string, step string, err error) []string {
+	if err == nil {
+		return errs
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			errs = recordErrors(errs, step, e)
+		}
+		return errs
+	}
+	return append(errs, fmt.Sprintf("%s: %v", step, err))
+}
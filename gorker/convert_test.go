@@ -0,0 +1,28 @@
+package gorker
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestRecordErrors(t *testing.T) {
+	pageErr := errors.Join(errors.New("page 1 failed"), errors.New("page 2 failed"))
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{"no error", nil, []string{"earlier: failed"}},
+		{"single error", errors.New("failed"), []string{"earlier: failed", "step: failed"}},
+		{"joined errors", errors.Join(pageErr, errors.New("page 3 failed")), []string{"earlier: failed", "step: page 1 failed", "step: page 2 failed", "step: page 3 failed"}},
+		{"wrapped error", fmt.Errorf("page 4: %w", errors.New("failed")), []string{"earlier: failed", "step: page 4: failed"}},
+	}
+	for _, tt := range tests {
+		got := recordErrors([]string{"earlier: failed"}, "step", tt.err)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
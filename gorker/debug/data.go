@@ -1,4 +1,4 @@
-package main
+package debug
 
 import (
 	"bytes"
@@ -14,6 +14,8 @@ import (
 	"github.com/disintegration/imaging"
 	"github.com/kolesa-team/go-webp/encoder"
 	"github.com/kolesa-team/go-webp/webp"
+
+	"gorker/gorker/schema"
 )
 
 type Settings struct {
@@ -22,23 +24,9 @@ type Settings struct {
 	TexifyDPI       float64
 }
 
-type ConvertedSpan struct {
-	Text string
-	BBox []float64
-}
-
-type Page struct {
-	// Define your Page structure here
-}
-
-type Document struct {
-	Name  string
-	Pages []Page
-}
-
 var settings Settings
 
-func dumpEquationDebugData(doc Document, images []image.Image, convertedSpans []ConvertedSpan) {
+func dumpEquationDebugData(doc schema.Document, images []image.Image, convertedSpans []schema.Span) {
 	if settings.DebugDataFolder == "" || settings.DebugLevel == 0 {
 		return
 	}
@@ -70,12 +58,12 @@ func dumpEquationDebugData(doc Document, images []image.Image, convertedSpans []
 		dataLines = append(dataLines, map[string]interface{}{
 			"image": b64Image,
 			"text":  convertedSpans[idx].Text,
-			"bbox":  convertedSpans[idx].BBox,
+			"bbox":  convertedSpans[idx].Bbox,
 		})
 	}
 
 	// Remove extension from doc name
-	docBase := strings.TrimSuffix(filepath.Base(doc.Name), filepath.Ext(doc.Name))
+	docBase := strings.TrimSuffix(filepath.Base(doc.Filename), filepath.Ext(doc.Filename))
 	debugFile := filepath.Join(settings.DebugDataFolder, fmt.Sprintf("%s_equations.json", docBase))
 
 	jsonData, err := json.Marshal(dataLines)
@@ -90,7 +78,7 @@ func dumpEquationDebugData(doc Document, images []image.Image, convertedSpans []
 	}
 }
 
-func dumpBBoxDebugData(doc Document, fname string, blocks []Page) {
+func dumpBBoxDebugData(doc schema.Document, fname string, blocks []schema.Page) {
 	if settings.DebugDataFolder == "" || settings.DebugLevel < 2 {
 		return
 	}
@@ -139,23 +127,17 @@ func dumpBBoxDebugData(doc Document, fname string, blocks []Page) {
 }
 
 // Placeholder functions - you'll need to implement these
-func renderImage(page Page, dpi float64) image.Image {
+func renderImage(page schema.Page, dpi float64) image.Image {
 	// Implement this function based on your needs
 	return nil
 }
 
-func modelDump(page Page) map[string]interface{} {
-	// Implement this function based on your needs
-	return nil
-}
-
-func main() {
-	// Example usage
-	settings = Settings{
-		DebugDataFolder: "/path/to/debug/folder",
-		DebugLevel:      2,
-		TexifyDPI:       300,
+func modelDump(page schema.Page) map[string]interface{} {
+	var data map[string]interface{}
+	jsonData, err := json.Marshal(page)
+	if err != nil {
+		return map[string]interface{}{}
 	}
-
-	// Use the functions here
+	json.Unmarshal(jsonData, &data)
+	return data
 }
@@ -1,287 +1,289 @@
-package main
+package equations
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image"
 	"strings"
-)
-
-// Placeholder types and functions
-type Page struct {
-	Blocks []Block
-	Layout Layout
-	Bbox   Bbox
-}
-
-type Block struct {
-	Lines     []Line
-	Bbox      Bbox
-	BlockType string
-	Pnum      int
-}
-
-type Line struct {
-	Spans []Span
-	Bbox  Bbox
-}
-
-type Span struct {
-	Text       string
-	Bbox       Bbox
-	SpanID     string
-	Font       string
-	FontWeight int
-	FontSize   int
-}
 
-type Bbox struct{}
+	"github.com/gen2brain/go-fitz"
 
-type Layout struct {
-	Bboxes    []Bbox
-	ImageBbox Bbox
-}
+	"gorker/gorker/geometry"
+	"gorker/gorker/pdf"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
 
-// Placeholder functions
-func rescaleBbox(imageBbox, pageBbox, targetBbox Bbox) Bbox {
-	// Implementation omitted
-	return Bbox{}
+// insertPoint is a line of a page's blocks, as they were before any
+// equation was inserted.
+type insertPoint struct {
+	block, line int
 }
 
-func findInsertBlock(blocks []Block, region Bbox) int {
-	// Implementation omitted
-	return 0
+// EquationCandidate is a formula region of a page to be read as LaTeX.
+type EquationCandidate struct {
+	Bbox geometry.Bbox
+	// Text is the extracted text of the lines in the region, which the
+	// equation keeps if it can't be read.
+	Text   string
+	Tokens int
+	// Lines are the lines in the region, which the equation replaces.
+	Lines []insertPoint
+	// Insert is where the equation goes: before this line, or after the
+	// block's last line if the index is past it. Points refer to the blocks
+	// as they were found, so they stay valid however many equations go into
+	// the page.
+	Insert insertPoint
 }
 
-func getTotalTexifyTokens(text string, processor interface{}) int {
-	// Implementation omitted
-	return 0
-}
+func findEquationCandidates(page schema.Page) []EquationCandidate {
+	if page.Layout == nil {
+		return nil
+	}
 
-func findEquationBlocks(page Page, processor interface{}) [][]interface{} {
-	equationBlocks := [][]interface{}{}
-	equationRegions := []Bbox{}
+	var candidates []EquationCandidate
 	for _, l := range page.Layout.Bboxes {
-		if l.Label == "Formula" {
-			equationRegions = append(equationRegions, l)
+		if l.Label != "Formula" {
+			continue
 		}
-	}
-
-	for i, region := range equationRegions {
-		equationRegions[i] = rescaleBbox(page.Layout.ImageBbox, page.Bbox, region)
-	}
-
-	linesToRemove := make(map[int][][2]int)
-	insertPoints := make(map[int][2]int)
-	equationLines := make(map[int][]Line)
+		region := geometry.RescaleBbox(page.Layout.ImageBbox, page.Bbox, l.Bbox)
 
-	for regionIdx, region := range equationRegions {
+		candidate := EquationCandidate{Bbox: region}
+		var text strings.Builder
 		for blockIdx, block := range page.Blocks {
 			for lineIdx, line := range block.Lines {
 				if line.IntersectionPct(region) > settings.BboxIntersectionThresh {
-					linesToRemove[regionIdx] = append(linesToRemove[regionIdx], [2]int{blockIdx, lineIdx})
-					equationLines[regionIdx] = append(equationLines[regionIdx], line)
-
-					if _, exists := insertPoints[regionIdx]; !exists {
-						insertPoints[regionIdx] = [2]int{blockIdx, lineIdx}
-					}
+					candidate.Lines = append(candidate.Lines, insertPoint{blockIdx, lineIdx})
+					text.WriteString(line.PrelimText() + " ")
 				}
 			}
 		}
-	}
-
-	// Handle regions where lines were not detected
-	for regionIdx, region := range equationRegions {
-		if _, exists := insertPoints[regionIdx]; !exists {
-			insertPoints[regionIdx] = [2]int{findInsertBlock(page.Blocks, region), 0}
-		}
-	}
-
-	blockLinesToRemove := make(map[int]map[int]bool)
-	for regionIdx, equationRegion := range equationRegions {
-		var blockText string
-		var totalTokens int
-
-		if lines, exists := equationLines[regionIdx]; exists && len(lines) > 0 {
-			for _, line := range lines {
-				blockText += line.PrelimText + " "
-			}
-			totalTokens = getTotalTexifyTokens(blockText, processor)
-		}
 
-		equationInsert := insertPoints[regionIdx]
-		equationInsertLineIdx := equationInsert[1]
-		for _, item := range linesToRemove[regionIdx] {
-			if item[0] == equationInsert[0] && item[1] < equationInsert[1] {
-				equationInsertLineIdx--
-			}
+		if len(candidate.Lines) > 0 {
+			candidate.Insert = candidate.Lines[0]
+			candidate.Text = text.String()
+			candidate.Tokens = estimateTokens(candidate.Text)
+		} else {
+			// Handle regions where lines were not detected
+			candidate.Insert = insertPoint{schema.FindInsertBlock(page.Blocks, region), 0}
 		}
 
-		selectedBlocks := []interface{}{equationInsert[0], equationInsertLineIdx, totalTokens, blockText, equationRegion}
-		if totalTokens < settings.TexifyModelMax {
-			for _, item := range linesToRemove[regionIdx] {
-				if _, exists := blockLinesToRemove[item[0]]; !exists {
-					blockLinesToRemove[item[0]] = make(map[int]bool)
-				}
-				blockLinesToRemove[item[0]][item[1]] = true
-			}
-			equationBlocks = append(equationBlocks, selectedBlocks)
+		// Equations too long for the model keep their text
+		if candidate.Tokens < settings.TexifyModelMax {
+			candidates = append(candidates, candidate)
 		}
 	}
+	return candidates
+}
 
-	// Remove lines from blocks
-	for blockIdx, badLines := range blockLinesToRemove {
-		newLines := []Line{}
-		for idx, line := range page.Blocks[blockIdx].Lines {
-			if !badLines[idx] {
-				newLines = append(newLines, line)
-			}
+// recognized reports whether the LaTeX predicted for a candidate passes the
+// checks for a misread.
+func recognized(candidate EquationCandidate, latexText string) bool {
+	conditions := []bool{
+		estimateTokens(latexText) < settings.TexifyModelMax,
+		float64(len(latexText)) > float64(len(candidate.Text))*0.7,
+		len(strings.TrimSpace(latexText)) > 0,
+		ValidLatex(latexText),
+	}
+	for _, condition := range conditions {
+		if !condition {
+			return false
 		}
-		page.Blocks[blockIdx].Lines = newLines
 	}
-
-	return equationBlocks
+	return true
 }
 
-func incrementInsertPoints(pageEquationBlocks [][]interface{}, insertBlockIdx, insertCount int) {
-	for idx, block := range pageEquationBlocks {
-		if blockIdx, ok := block[0].(int); ok && blockIdx >= insertBlockIdx {
-			pageEquationBlocks[idx][0] = blockIdx + insertCount
-		}
+// displayMath wraps LaTeX in the dollar signs of a display equation.
+func displayMath(latex string) string {
+	// Recognizers return the bare LaTeX of a display equation
+	text := strings.TrimSpace(strings.ReplaceAll(latex, "\n", " "))
+	if !strings.HasPrefix(text, "$$") {
+		text = "$$" + text + "$$"
 	}
+	return text
 }
 
-func insertLatexBlock(pageBlocks *Page, pageEquationBlocks [][]interface{}, predictions []string, pnum int, processor interface{}) (int, int, []Span) {
-	convertedSpans := []Span{}
-	successCount := 0
-	failCount := 0
-
-	for blockNumber, blockData := range pageEquationBlocks {
-		insertBlockIdx := blockData[0].(int)
-		insertLineIdx := blockData[1].(int)
-		tokenCount := blockData[2].(int)
-		blockText := blockData[3].(string)
-		equationBbox := blockData[4].(Bbox)
+// equationBlock returns the block holding the text of an equation.
+func equationBlock(candidate EquationCandidate, text string, pnum, number int) schema.Block {
+	return schema.Block{
+		Lines: []schema.Line{{
+			Spans: []schema.Span{{
+				Text:   text,
+				Bbox:   candidate.Bbox,
+				SpanID: fmt.Sprintf("%d_%d_fixeq", pnum, number),
+				Font:   "Latex",
+			}},
+			Bbox: candidate.Bbox,
+		}},
+		Bbox:      candidate.Bbox,
+		BlockType: "Formula",
+		Pnum:      pnum,
+	}
+}
 
-		latexText := predictions[blockNumber]
-		conditions := []bool{
-			getTotalTexifyTokens(latexText, processor) < settings.TexifyModelMax,
-			float64(len(latexText)) > float64(len(blockText))*0.7,
-			len(strings.TrimSpace(latexText)) > 0,
+// insertEquations replaces the lines of the candidates with their blocks,
+// splitting the blocks they were in, in a single pass over the page. A
+// candidate whose block has no lines only has its lines removed.
+func insertEquations(page *schema.Page, candidates []EquationCandidate, eqBlocks []schema.Block) {
+	inserts := make(map[insertPoint][]int)
+	removed := make(map[insertPoint]bool)
+	for i, candidate := range candidates {
+		inserts[candidate.Insert] = append(inserts[candidate.Insert], i)
+		for _, line := range candidate.Lines {
+			removed[line] = true
 		}
+	}
 
-		newBlock := Block{
-			Lines: []Line{{
-				Spans: []Span{{
-					Text:       strings.ReplaceAll(blockText, "\n", " "),
-					Bbox:       equationBbox,
-					SpanID:     fmt.Sprintf("%d_%d_fixeq", pnum, blockNumber),
-					Font:       "Latex",
-					FontWeight: 0,
-					FontSize:   0,
-				}},
-				Bbox: equationBbox,
-			}},
-			Bbox:      equationBbox,
-			BlockType: "Formula",
-			Pnum:      pnum,
+	var newBlocks []schema.Block
+	for blockIdx, block := range page.Blocks {
+		var kept []schema.Line
+		split := false
+		flush := func() {
+			if len(kept) > 0 {
+				part := block
+				part.Lines, part.Bbox = kept, schema.BboxFromLines(kept)
+				newBlocks = append(newBlocks, part)
+				kept = nil
+			}
 		}
 
-		allTrue := true
-		for _, condition := range conditions {
-			if !condition {
-				allTrue = false
+		for lineIdx := 0; lineIdx <= len(block.Lines); lineIdx++ {
+			point := insertPoint{blockIdx, lineIdx}
+			for _, i := range inserts[point] {
+				if len(eqBlocks[i].Lines) == 0 {
+					continue
+				}
+				flush()
+				newBlocks = append(newBlocks, eqBlocks[i])
+				split = true
+			}
+			if lineIdx == len(block.Lines) {
 				break
 			}
+			if removed[point] {
+				split = true
+				continue
+			}
+			kept = append(kept, block.Lines[lineIdx])
 		}
 
-		if !allTrue {
-			failCount++
+		if split {
+			flush()
 		} else {
-			successCount++
-			newBlock.Lines[0].Spans[0].Text = strings.ReplaceAll(latexText, "\n", " ")
-			convertedSpans = append(convertedSpans, newBlock.Lines[0].Spans[0])
+			newBlocks = append(newBlocks, block)
 		}
+	}
 
-		// Insert the new LaTeX block
-		if insertLineIdx == 0 {
-			pageBlocks.Blocks = append(pageBlocks.Blocks[:insertBlockIdx], append([]Block{newBlock}, pageBlocks.Blocks[insertBlockIdx:]...)...)
-			incrementInsertPoints(pageEquationBlocks, insertBlockIdx, 1)
-		} else if insertLineIdx >= len(pageBlocks.Blocks[insertBlockIdx].Lines) {
-			pageBlocks.Blocks = append(pageBlocks.Blocks[:insertBlockIdx+1], append([]Block{newBlock}, pageBlocks.Blocks[insertBlockIdx+1:]...)...)
-			incrementInsertPoints(pageEquationBlocks, insertBlockIdx+1, 1)
-		} else {
-			newBlocks := []Block{}
-			for blockIdx, block := range pageBlocks.Blocks {
-				if blockIdx == insertBlockIdx {
-					splitBlock := splitBlockLines(block, insertLineIdx)
-					newBlocks = append(newBlocks, splitBlock[0], newBlock, splitBlock[1])
-					incrementInsertPoints(pageEquationBlocks, insertBlockIdx, 2)
-				} else {
-					newBlocks = append(newBlocks, block)
-				}
-			}
-			pageBlocks.Blocks = newBlocks
+	// Equations placed past the last block, as on a page without any
+	for i, candidate := range candidates {
+		if candidate.Insert.block >= len(page.Blocks) && len(eqBlocks[i].Lines) > 0 {
+			newBlocks = append(newBlocks, eqBlocks[i])
 		}
 	}
-
-	return successCount, failCount, convertedSpans
+	page.Blocks = newBlocks
 }
 
-func replaceEquations(doc interface{}, pages []Page, texifyModel interface{}, batchMultiplier int) ([]Page, map[string]int) {
+// ReplaceEquations replaces the lines of every formula region with a block
+// holding the equation's LaTeX, read by recognizer from the rendered region.
+// Equations that can't be read, or all of them if recognizer is nil, are
+// written as LaTeX from their extracted text, and keep the text if that
+// fails too. Without a recognizer nothing is rendered, and no equation counts
+// as unsuccessfully read. The math left in text lines is then written as inline LaTeX.
+// The returned error joins the failures of equations that kept their text
+// because of them.
+func ReplaceEquations(ctx context.Context, doc *fitz.Document, pages []schema.Page, recognizer EquationRecognizer, batchMultiplier int) ([]schema.Page, map[string]int, error) {
+	var errs []error
 	unsuccessfulOCR := 0
 	successfulOCR := 0
+	fallbackCount := 0
 
-	equationBlocks := [][]interface{}{}
-	for _, page := range pages {
-		equationBlocks = append(equationBlocks, findEquationBlocks(page, texifyModel))
-	}
-
+	candidates := make([][]EquationCandidate, len(pages))
 	eqCount := 0
-	for _, blocks := range equationBlocks {
-		eqCount += len(blocks)
+	for i, page := range pages {
+		candidates[i] = findEquationCandidates(page)
+		eqCount += len(candidates[i])
 	}
 
-	images := []interface{}{}
+	images := []image.Image{}
 	tokenCounts := []int{}
+	for pageIdx, pageCandidates := range candidates {
+		if recognizer == nil || len(pageCandidates) == 0 {
+			continue
+		}
+		// Every equation on the page is cut from one render of it
+		pnum := pages[pageIdx].Pnum
+		pageImage, err := pdf.RenderImage(doc, pnum, settings.TexifyDPI)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rendering equations on page %d: %w", pnum, err))
+		}
+		for _, candidate := range pageCandidates {
+			var eqImage image.Image
+			if pageImage != nil {
+				if eqImage, err = pdf.CropBboxImage(pageImage, pages[pageIdx], candidate.Bbox); err != nil {
+					errs = append(errs, fmt.Errorf("cropping equation on page %d: %w", pnum, err))
+				}
+			}
+			images = append(images, eqImage)
+			tokenCounts = append(tokenCounts, candidate.Tokens)
+		}
+	}
 
-	for pageIdx, pageEquationBlocks := range equationBlocks {
-		pageObj := doc.([]interface{})[pageIdx]
-		for _, blockData := range pageEquationBlocks {
-			equationBbox := blockData[4].(Bbox)
-			pngImage := renderBboxImage(pageObj, pages[pageIdx], equationBbox)
-			images = append(images, pngImage)
-			tokenCounts = append(tokenCounts, blockData[2].(int))
+	predictions := make([]string, eqCount)
+	if recognizer != nil {
+		var err error
+		if predictions, err = getLatexBatched(ctx, images, tokenCounts, recognizer, batchMultiplier); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	predictions := getLatexBatched(images, tokenCounts, texifyModel, batchMultiplier)
+	next := 0
+	for pageIdx, pageCandidates := range candidates {
+		page := pages[pageIdx]
+		eqBlocks := make([]schema.Block, len(pageCandidates))
+		var bars []geometry.Bbox
+		barsRead := false
+		for i, candidate := range pageCandidates {
+			text := predictions[next]
+			next++
+			if recognized(candidate, text) {
+				successfulOCR++
+				eqBlocks[i] = equationBlock(candidate, displayMath(text), page.Pnum, i)
+				continue
+			}
+			if recognizer != nil {
+				unsuccessfulOCR++
+			}
 
-	pageStart := 0
-	convertedSpans := []Span{}
-	for pageIdx, pageEquationBlocks := range equationBlocks {
-		pageEquationCount := len(pageEquationBlocks)
-		pagePredictions := predictions[pageStart : pageStart+pageEquationCount]
-		successCount, failCount, convertedSpan := insertLatexBlock(
-			&pages[pageIdx],
-			pageEquationBlocks,
-			pagePredictions,
-			pageIdx,
-			texifyModel,
-		)
-		convertedSpans = append(convertedSpans, convertedSpan...)
-		pageStart += pageEquationCount
-		successfulOCR += successCount
-		unsuccessfulOCR += failCount
+			if !barsRead {
+				bars, barsRead = fractionBars(page), true
+			}
+			lines := make([]schema.Line, 0, len(candidate.Lines))
+			for _, point := range candidate.Lines {
+				lines = append(lines, page.Blocks[point.block].Lines[point.line])
+			}
+			text = fallbackLatex(lines, bars)
+			if text != "" {
+				fallbackCount++
+			} else {
+				text = strings.ReplaceAll(candidate.Text, "\n", " ")
+			}
+			// A region without text gets no block, rather than an empty one
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			eqBlocks[i] = equationBlock(candidate, text, page.Pnum, i)
+		}
+		insertEquations(&pages[pageIdx], pageCandidates, eqBlocks)
 	}
 
-	// Debug mode data dump omitted
+	inlineCount := FormatInlineMath(pages)
 
 	return pages, map[string]int{
 		"successful_ocr":   successfulOCR,
 		"unsuccessful_ocr": unsuccessfulOCR,
+		"fallback_latex":   fallbackCount,
 		"equations":        eqCount,
-	}
-}
-
-func main() {
-	// Main function implementation omitted
+		"inline_math":      inlineCount,
+	}, errors.Join(errs...)
 }
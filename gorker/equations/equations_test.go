@@ -0,0 +1,71 @@
+package equations
+
+import (
+	"context"
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+func TestInsertEquations(t *testing.T) {
+	lines := []schema.Line{textLine("Consider"), textLine("x = 1"), textLine("which holds"), textLine("as shown")}
+	page := schema.Page{Blocks: []schema.Block{{Lines: lines, Bbox: schema.BboxFromLines(lines), BlockType: "Text"}}}
+
+	candidates := []EquationCandidate{
+		{Bbox: geometry.Bbox{72, 100, 97, 110}, Lines: []insertPoint{{0, 1}}, Insert: insertPoint{0, 1}},
+		// Read as nothing, from a region with no text
+		{Bbox: geometry.Bbox{72, 120, 97, 130}, Insert: insertPoint{0, 3}},
+		{Bbox: geometry.Bbox{72, 140, 97, 150}, Insert: insertPoint{1, 0}},
+	}
+	eqBlocks := []schema.Block{
+		equationBlock(candidates[0], "$$x = 1$$", 0, 0),
+		{},
+		{},
+	}
+	insertEquations(&page, candidates, eqBlocks)
+
+	want := []struct {
+		blockType string
+		text      string
+	}{
+		{"Text", "Consider"},
+		{"Formula", "$$x = 1$$"},
+		{"Text", "which holds\nas shown"},
+	}
+	if len(page.Blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(page.Blocks), len(want))
+	}
+	for i, w := range want {
+		block := page.Blocks[i]
+		if block.BlockType != w.blockType || block.PrelimText() != w.text {
+			t.Errorf("block %d = %s %q, want %s %q", i, block.BlockType, block.PrelimText(), w.blockType, w.text)
+		}
+	}
+}
+
+func TestReplaceEquationsWithoutRecognizer(t *testing.T) {
+	lines := []schema.Line{textLine("Consider"), textLine("x = 1")}
+	lines[1].Bbox = geometry.Bbox{72, 120, 97, 130}
+	lines[1].Spans[0].Bbox = lines[1].Bbox
+	page := schema.Page{
+		Bbox:   geometry.Bbox{0, 0, 600, 800},
+		Blocks: []schema.Block{{Lines: lines, Bbox: schema.BboxFromLines(lines), BlockType: "Text"}},
+		Layout: &schema.LayoutResult{
+			ImageBbox: geometry.Bbox{0, 0, 600, 800},
+			Bboxes:    []schema.LayoutBox{{Bbox: geometry.Bbox{70, 118, 100, 132}, Label: "Formula"}},
+		},
+	}
+
+	// Without a recognizer the document is never rendered
+	pages, stats, err := ReplaceEquations(context.Background(), nil, []schema.Page{page}, nil, 1)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if stats["equations"] != 1 || stats["successful_ocr"] != 0 || stats["unsuccessful_ocr"] != 0 {
+		t.Errorf("stats = %v, want 1 equation and none read", stats)
+	}
+	if len(pages[0].Blocks) != 2 || pages[0].Blocks[1].BlockType != "Formula" {
+		t.Fatalf("blocks = %+v, want the text and then the formula", pages[0].Blocks)
+	}
+}
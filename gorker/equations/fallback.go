@@ -0,0 +1,275 @@
+package equations
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// Stacked lines are a fraction when the narrower one is this much covered by
+// the other, and they are less than this share of a line height apart.
+const (
+	fractionOverlap = 0.5
+	fractionGap     = 0.5
+)
+
+// Items are on the same row when they overlap by this share of the shorter
+// one's height, which scripts set off the baseline still do.
+const rowOverlap = 0.3
+
+// functionRe matches the names of functions set upright in equations.
+var functionRe = regexp.MustCompile(`(^|[^\\a-zA-Z])(sin|cos|tan|cot|sinh|cosh|tanh|arcsin|arccos|arctan|log|ln|exp|lim|max|min|sup|inf|det|arg)\b`)
+
+// mathItem is a piece of an equation written as LaTeX.
+type mathItem struct {
+	bbox  geometry.Bbox
+	latex string
+}
+
+// fractionBars returns the thin horizontal rules drawn on a page, which
+// fraction bars are.
+func fractionBars(page schema.Page) []geometry.Bbox {
+	var bars []geometry.Bbox
+	for _, d := range page.Drawings {
+		switch {
+		case d.Image:
+		case d.Fill && d.Bbox.Height() <= 2 && d.Bbox.Width() > 3*math.Max(d.Bbox.Height(), 1):
+			bars = append(bars, d.Bbox)
+		case d.Stroke:
+			for _, s := range d.Segments {
+				if s.Horizontal(0.5) {
+					bars = append(bars, geometry.Bbox{math.Min(s.X0, s.X1), s.Y0, math.Max(s.X0, s.X1), s.Y1})
+				}
+			}
+		}
+	}
+	return bars
+}
+
+// fallbackLatex writes the lines of an equation that couldn't be recognized
+// as display LaTeX. Glyphs are replaced with their commands, text shifted
+// off the baseline becomes scripts, and lines stacked over a fraction bar,
+// or without one next to the rest of the equation, become fractions. It
+// returns an empty string if the result isn't valid LaTeX.
+func fallbackLatex(lines []schema.Line, bars []geometry.Bbox) string {
+	var items []mathItem
+	for _, line := range lines {
+		tokens := lineMathTokens(line)
+		for i := range tokens {
+			tokens[i].math = true
+		}
+		latex := functionRe.ReplaceAllString(tokensLatex(tokens), `$1\$2`)
+		if latex != "" {
+			items = append(items, mathItem{line.Bbox, latex})
+		}
+	}
+	if len(items) == 0 {
+		return ""
+	}
+
+	items = barFractions(items, bars)
+	items = stackedFractions(items)
+
+	var rows []string
+	for _, row := range mathRows(items) {
+		rows = append(rows, rowLatex(row))
+	}
+	latex := rows[0]
+	if len(rows) > 1 {
+		latex = `\begin{gathered} ` + strings.Join(rows, ` \\ `) + ` \end{gathered}`
+	}
+	if !ValidLatex(latex) {
+		return ""
+	}
+	return "$$" + latex + "$$"
+}
+
+// barFractions joins the items just above and below each fraction bar into
+// a fraction. Shorter bars go first, so nested fractions are built inside
+// out.
+func barFractions(items []mathItem, bars []geometry.Bbox) []mathItem {
+	bars = append([]geometry.Bbox{}, bars...)
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Width() < bars[j].Width() })
+
+	for _, bar := range bars {
+		y := (bar.Y0() + bar.Y1()) / 2
+		var num, den []int
+		for i, item := range items {
+			if item.bbox.OverlapX(bar) < item.bbox.Width()*fractionOverlap {
+				continue
+			}
+			center := (item.bbox.Y0() + item.bbox.Y1()) / 2
+			switch {
+			case center < y && y-item.bbox.Y1() < item.bbox.Height():
+				num = append(num, i)
+			case center > y && item.bbox.Y0()-y < item.bbox.Height():
+				den = append(den, i)
+			}
+		}
+		// Rules much wider than what they split, like those between rows of
+		// a table, aren't fraction bars
+		if len(num) > 0 && len(den) > 0 && bar.Width() <= math.Max(itemsWidth(items, num), itemsWidth(items, den))+2*items[num[0]].bbox.Height() {
+			items = joinFraction(items, num, den, bar)
+		}
+	}
+	return items
+}
+
+func itemsWidth(items []mathItem, indices []int) float64 {
+	bbox := items[indices[0]].bbox
+	for _, i := range indices[1:] {
+		bbox = bbox.Union(items[i].bbox)
+	}
+	return bbox.Width()
+}
+
+// stackedFractions finds fractions whose bar wasn't drawn as a rule: two
+// lines closely stacked with more of the equation beside them, between
+// their heights.
+func stackedFractions(items []mathItem) []mathItem {
+	for {
+		found := false
+		for i := 0; i < len(items) && !found; i++ {
+			for j := 0; j < len(items) && !found; j++ {
+				a, b := items[i].bbox, items[j].bbox
+				narrower := math.Min(a.Width(), b.Width())
+				if i == j || b.Y0() < a.Y1()-a.Height()*fractionGap || b.Y0()-a.Y1() > math.Min(a.Height(), b.Height())*fractionGap ||
+					a.OverlapX(b) < narrower*fractionOverlap {
+					continue
+				}
+				// The rest of the equation sits level with the bar, clear of the
+				// lines of the fraction, which tells it apart from a grid
+				stack := a.Union(b)
+				bar := (a.Y1() + b.Y0()) / 2
+				for k, item := range items {
+					center := (item.bbox.Y0() + item.bbox.Y1()) / 2
+					if k != i && k != j && item.bbox.OverlapX(stack) == 0 && math.Abs(center-bar) < item.bbox.Height()*0.25 &&
+						item.bbox.OverlapY(a) < item.bbox.Height()*0.5 && item.bbox.OverlapY(b) < item.bbox.Height()*0.5 {
+						found = true
+						break
+					}
+				}
+				if found {
+					items = joinFraction(items, []int{i}, []int{j}, stack)
+				}
+			}
+		}
+		if !found {
+			return items
+		}
+	}
+}
+
+// joinFraction replaces the numerator and denominator items with their
+// fraction.
+func joinFraction(items []mathItem, num, den []int, bar geometry.Bbox) []mathItem {
+	used := make(map[int]bool)
+	join := func(indices []int) string {
+		sort.Slice(indices, func(i, j int) bool { return items[indices[i]].bbox.X0() < items[indices[j]].bbox.X0() })
+		var parts []string
+		for _, i := range indices {
+			parts = append(parts, items[i].latex)
+			bar = bar.Union(items[i].bbox)
+			used[i] = true
+		}
+		return strings.Join(parts, " ")
+	}
+	fraction := mathItem{latex: `\frac{` + join(num) + `}{` + join(den) + `}`}
+	fraction.bbox = bar
+
+	joined := []mathItem{fraction}
+	for i, item := range items {
+		if !used[i] {
+			joined = append(joined, item)
+		}
+	}
+	return joined
+}
+
+// mathRows groups items into the rows of the equation, ordered top to
+// bottom and left to right.
+func mathRows(items []mathItem) [][]mathItem {
+	sort.Slice(items, func(i, j int) bool { return items[i].bbox.Y0() < items[j].bbox.Y0() })
+	var rows [][]mathItem
+	var rowBboxes []geometry.Bbox
+	for _, item := range items {
+		placed := false
+		for r, bbox := range rowBboxes {
+			if item.bbox.OverlapY(bbox) >= math.Min(item.bbox.Height(), bbox.Height())*rowOverlap {
+				rows[r] = append(rows[r], item)
+				rowBboxes[r] = bbox.Union(item.bbox)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			rows = append(rows, []mathItem{item})
+			rowBboxes = append(rowBboxes, item.bbox)
+		}
+	}
+	for _, row := range rows {
+		sort.Slice(row, func(i, j int) bool { return row[i].bbox.X0() < row[j].bbox.X0() })
+	}
+	return rows
+}
+
+// rowLatex joins the items of a row. Items set smaller than most and
+// shifted off the row's middle are scripts of the item before them.
+func rowLatex(row []mathItem) string {
+	heights := make([]float64, len(row))
+	for i, item := range row {
+		heights[i] = item.bbox.Height()
+	}
+	sort.Float64s(heights)
+	height := heights[len(heights)/2]
+	var middles []float64
+	for _, item := range row {
+		if item.bbox.Height() >= height*subscriptScale {
+			middles = append(middles, (item.bbox.Y0()+item.bbox.Y1())/2)
+		}
+	}
+	sort.Float64s(middles)
+	middle := middles[len(middles)/2]
+
+	var sb strings.Builder
+	var script strings.Builder
+	scriptKind := ""
+	flush := func() {
+		if scriptKind != "" {
+			sb.WriteString(scriptKind + "{" + script.String() + "}")
+			script.Reset()
+			scriptKind = ""
+		}
+	}
+	for i, item := range row {
+		kind := ""
+		if i > 0 && item.bbox.Height() < height*subscriptScale {
+			kind = "^"
+			if (item.bbox.Y0()+item.bbox.Y1())/2 > middle {
+				kind = "_"
+			}
+		}
+		if kind != scriptKind {
+			flush()
+		}
+		switch {
+		case kind == "":
+			if sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(item.latex)
+		case script.Len() > 0:
+			script.WriteString(" " + item.latex)
+			continue
+		default:
+			script.WriteString(item.latex)
+		}
+		scriptKind = kind
+	}
+	flush()
+	return sb.String()
+}
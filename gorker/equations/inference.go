@@ -1,94 +1,60 @@
-package main
+package equations
 
 import (
-	"math"
-	"os"
-)
-
-// Assuming these are defined elsewhere
-var settings struct {
-	TEXIFY_BATCH_SIZE   *int
-	TORCH_DEVICE_MODEL  string
-	TEXIFY_MODEL_MAX    int
-	TEXIFY_TOKEN_BUFFER int
-}
-
-type TexifyModel struct {
-	Processor Processor
-}
+	"context"
+	"fmt"
+	"image"
+	"regexp"
 
-type Processor struct {
-	Tokenizer Tokenizer
-}
-
-type Tokenizer interface {
-	Tokenize(text string) map[string][]int
-}
+	"gorker/gorker/settings"
+)
 
-func init() {
-	os.Setenv("TOKENIZERS_PARALLELISM", "false")
-}
+// tokenRe splits LaTeX and plain text roughly the way the recognition model's
+// tokenizer does: commands, words, digits and single symbols.
+var tokenRe = regexp.MustCompile(`\\[a-zA-Z]+|[a-zA-Z]+|\d|\S`)
 
 func getBatchSize() int {
-	if settings.TEXIFY_BATCH_SIZE != nil {
-		return *settings.TEXIFY_BATCH_SIZE
-	} else if settings.TORCH_DEVICE_MODEL == "cuda" {
+	if settings.TexifyBatchSize > 0 {
+		return settings.TexifyBatchSize
+	} else if settings.TorchDeviceModel == "cuda" {
 		return 6
-	} else if settings.TORCH_DEVICE_MODEL == "mps" {
+	} else if settings.TorchDeviceModel == "mps" {
 		return 6
 	}
 	return 2
 }
 
-func getLatexBatched(images []interface{}, tokenCounts []int, texifyModel *TexifyModel, batchMultiplier int) []string {
-	if len(images) == 0 {
-		return []string{}
-	}
-
+// getLatexBatched reads the equations in batches of the configured size. If
+// the recognizer fails, the equations not yet read are left empty so they
+// keep their extracted text, and the failure is returned.
+func getLatexBatched(ctx context.Context, images []image.Image, tokenCounts []int, recognizer EquationRecognizer, batchMultiplier int) ([]string, error) {
 	predictions := make([]string, len(images))
+	if recognizer == nil || len(images) == 0 {
+		return predictions, nil
+	}
 	batchSize := getBatchSize() * batchMultiplier
 
 	for i := 0; i < len(images); i += batchSize {
-		minIdx := i
-		maxIdx := int(math.Min(float64(minIdx+batchSize), float64(len(images))))
+		end := min(i+batchSize, len(images))
 
 		maxLength := 0
-		for j := minIdx; j < maxIdx; j++ {
-			if tokenCounts[j] > maxLength {
-				maxLength = tokenCounts[j]
-			}
+		for _, count := range tokenCounts[i:end] {
+			maxLength = max(maxLength, count)
 		}
+		maxLength = min(maxLength, settings.TexifyModelMax) + settings.TexifyTokenBuffer
 
-		maxLength = int(math.Min(float64(maxLength), float64(settings.TEXIFY_MODEL_MAX)))
-		maxLength += settings.TEXIFY_TOKEN_BUFFER
-
-		modelOutput := batchInference(images[minIdx:maxIdx], texifyModel, texifyModel.Processor, maxLength)
-
-		for j, output := range modelOutput {
-			tokenCount := getTotalTexifyTokens(output, texifyModel.Processor)
-			if tokenCount >= maxLength-1 {
-				output = ""
-			}
-			imageIdx := i + j
-			predictions[imageIdx] = output
+		batch, err := recognizer.Recognize(ctx, images[i:end], maxLength)
+		if err != nil {
+			return predictions, fmt.Errorf("recognizing equations %d to %d of %d: %w", i+1, end, len(images), err)
 		}
+		copy(predictions[i:end], batch)
 	}
 
-	return predictions
-}
-
-func getTotalTexifyTokens(text string, processor Processor) int {
-	tokenizer := processor.Tokenizer
-	tokens := tokenizer.Tokenize(text)
-	return len(tokens["input_ids"])
-}
-
-// Placeholder function for batch inference
-func batchInference(images []interface{}, model *TexifyModel, processor Processor, maxTokens int) []string {
-	// Implementation would go here
-	return []string{}
+	return predictions, nil
 }
 
-func main() {
-	// Main function implementation
+// estimateTokens estimates how many tokens the recognition model reads or
+// writes for text.
+func estimateTokens(text string) int {
+	return len(tokenRe.FindAllStringIndex(text, -1))
 }
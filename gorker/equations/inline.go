@@ -0,0 +1,519 @@
+package equations
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// inlineBlockTypes are the blocks whose lines can hold inline math. Headings
+// are left out because their text is recased.
+var inlineBlockTypes = map[string]bool{
+	"Text":      true,
+	"List-item": true,
+	"Caption":   true,
+	"Footnote":  true,
+}
+
+var (
+	mathFontRe = regexp.MustCompile(`(?i)^(cmmi|cmsy|cmex|cmbsy|msam|msbm|eufm|rsfs|mtmi|mtsy|mtex|txmi|txsy|pxmi|pxsy|rtxmi|euclid)|math|symbol`)
+	wordRe     = regexp.MustCompile(`\s+|\S+`)
+	numberRe   = regexp.MustCompile(`^\d+([.,]\d+)*$`)
+	// Text with Greek words is written in Greek, not math
+	greekWordRe = regexp.MustCompile(`\p{Greek}{2,}`)
+	// applicationRe matches a function applied to its arguments, as in f(x)
+	applicationRe = regexp.MustCompile(`^[a-zA-Z]{1,3}\d?\([^()\s]+\)$`)
+)
+
+// Glyphs set in math fonts that aren't math on their own: list bullets,
+// footnote marks, and the sharp sign of "C♯". ASCII punctuation like the
+// braces of code listings isn't either.
+const (
+	markGlyphs       = "•◦▪▫■□●○▶►▸‣∙·∗†‡§¶⋆★✓♯♭"
+	punctuationGlyph = "{}[]()\\|/,.;:!?*'\"`"
+)
+
+// Superscripts sit this far, as a share of their font size, above the top of
+// the line, and subscripts are set this much smaller than the line's text.
+const (
+	superscriptShift = 0.1
+	subscriptScale   = 0.85
+)
+
+type mathToken struct {
+	text  string
+	span  int
+	bbox  geometry.Bbox
+	space bool
+	math  bool
+	// operator is a math token that needs operands, such as "=" or "×"
+	operator bool
+	// weak is an operator of ordinary text, which is only math between
+	// operands
+	weak bool
+	// bridge is a word that reads as math between math tokens, such as a
+	// number or a single letter
+	bridge bool
+	// operand is a word that reads as math next to an operator, which
+	// variable names like "Kx" and "X2" and applications like "f(x)" do too
+	operand bool
+	// name is an operand that is also how ordinary text writes acronyms, as
+	// in "CPU + GPU", so it's only math in an expression with math glyphs
+	name bool
+	// script is "^" or "_" for text shifted off the baseline
+	script string
+}
+
+// FormatInlineMath rewrites the math in text lines as inline LaTeX between
+// single dollar signs. Math is found from spans in math fonts such as CMMI,
+// CMSY and Symbol, words made of math glyphs like Greek letters and
+// operators, and superscripts and subscripts next to them. It returns the
+// number of runs rewritten.
+func FormatInlineMath(pages []schema.Page) int {
+	count := 0
+	for i := range pages {
+		for j := range pages[i].Blocks {
+			block := &pages[i].Blocks[j]
+			if !inlineBlockTypes[block.BlockType] {
+				continue
+			}
+			for k := range block.Lines {
+				var n int
+				block.Lines[k].Spans, n = formatLineMath(block.Lines[k])
+				count += n
+			}
+		}
+	}
+	return count
+}
+
+func formatLineMath(line schema.Line) ([]schema.Span, int) {
+	tokens := lineMathTokens(line)
+	markMathRuns(tokens)
+
+	var spans []schema.Span
+	runs := 0
+	for start := 0; start < len(tokens); {
+		end := start + 1
+		if !tokens[start].math {
+			for end < len(tokens) && !tokens[end].math && tokens[end].span == tokens[start].span {
+				end++
+			}
+			spans = append(spans, tokenSpan(line.Spans, tokens[start:end], nil))
+			start = end
+			continue
+		}
+
+		// Spaces between math tokens are part of the run
+		last := start
+		for end < len(tokens) && (tokens[end].math || tokens[end].space) {
+			if tokens[end].math {
+				last = end
+			}
+			end++
+		}
+		end = last + 1
+		latex, after := inlineLatex(tokens[start:end])
+		span := tokenSpan(line.Spans, tokens[start:end], &latex)
+		span.SpanID = fmt.Sprintf("%s_math", span.SpanID)
+		spans = append(spans, span)
+		if after != "" {
+			afterSpan := line.Spans[tokens[last].span]
+			afterSpan.Text = after
+			afterSpan.Bbox = tokens[last].bbox
+			spans = append(spans, afterSpan)
+		}
+		runs++
+		start = end
+	}
+	if runs == 0 {
+		return line.Spans, 0
+	}
+	return spans, runs
+}
+
+// lineMathTokens splits the spans of a line into words and spaces, marking
+// the words that are math.
+func lineMathTokens(line schema.Line) []mathToken {
+	if len(line.Spans) == 0 {
+		return nil
+	}
+	// The line's text is in its longest span
+	main := line.Spans[0]
+	greekText := false
+	for _, span := range line.Spans {
+		if len(span.Text) > len(main.Text) {
+			main = span
+		}
+		if !isMathFont(span.Font) && greekWordRe.MatchString(span.Text) {
+			greekText = true
+		}
+	}
+
+	var tokens []mathToken
+	for i, span := range line.Spans {
+		script := ""
+		switch {
+		case span.Bbox.Y0() < main.Bbox.Y0()-span.FontSize*superscriptShift:
+			script = "^"
+		case main.FontSize > 0 && span.FontSize < main.FontSize*subscriptScale && !strings.Contains(strings.TrimSpace(span.Text), " "):
+			script = "_"
+		}
+		mathFont := isMathFont(span.Font)
+		first := len(tokens)
+
+		for _, text := range wordRe.FindAllString(span.Text, -1) {
+			if strings.TrimSpace(text) == "" {
+				tokens = append(tokens, mathToken{text: text, span: i, space: true})
+				continue
+			}
+			if mathFont && isMathFontWord(text) {
+				tokens = append(tokens, mathToken{text: text, span: i, math: true, operator: isOperator(text), script: script})
+				continue
+			}
+			// Punctuation around a word stays outside of the math
+			lead, word, trail := splitPunctuation(text)
+			if lead != "" {
+				tokens = append(tokens, mathToken{text: lead, span: i})
+			}
+			if word != "" {
+				tokens = append(tokens, mathToken{
+					text:     word,
+					span:     i,
+					math:     !greekText && isMathWord(word),
+					weak:     isASCIIOperator(word),
+					operator: isOperator(word),
+					bridge:   isBridge(word),
+					operand:  isOperand(word),
+					name:     isVariableName(word),
+					script:   script,
+				})
+			}
+			if trail != "" {
+				tokens = append(tokens, mathToken{text: trail, span: i})
+			}
+		}
+
+		parts := make([]string, 0, len(tokens)-first)
+		for _, t := range tokens[first:] {
+			parts = append(parts, t.text)
+		}
+		for j, bbox := range spanTokenBboxes(span, parts) {
+			tokens[first+j].bbox = bbox
+		}
+	}
+	return tokens
+}
+
+// markMathRuns extends the math tokens to the numbers, variables and
+// scripts around them that belong to the same expression.
+func markMathRuns(tokens []mathToken) {
+	// neighbor returns the index of the word next to tokens[i] in direction
+	// dir, or -1 if there isn't one
+	neighbor := func(i, dir int) int {
+		j := i + dir
+		if j >= 0 && j < len(tokens) && tokens[j].space {
+			j += dir
+		}
+		if j < 0 || j >= len(tokens) {
+			return -1
+		}
+		return j
+	}
+	operand := func(j int) bool {
+		return j >= 0 && (tokens[j].math || tokens[j].operand)
+	}
+	// glyphs reports whether the expression around tokens[i], its operands
+	// and operators, has a word in a math font or of math glyphs
+	strong := make([]bool, len(tokens))
+	for i, t := range tokens {
+		strong[i] = t.math
+	}
+	glyphs := func(i int) bool {
+		for _, dir := range []int{-1, 1} {
+			for j := i; j >= 0; j = neighbor(j, dir) {
+				if strong[j] {
+					return true
+				}
+				if !tokens[j].operand && !tokens[j].operator && !tokens[j].weak {
+					break
+				}
+			}
+		}
+		return false
+	}
+
+	// Operators of ordinary text need operands on both sides, and names
+	// only count as ones next to math glyphs
+	for i, t := range tokens {
+		if !t.weak {
+			continue
+		}
+		left, right := neighbor(i, -1), neighbor(i, 1)
+		tokens[i].math = operand(left) && operand(right) &&
+			(!tokens[left].name && !tokens[right].name || glyphs(i))
+	}
+
+	// Numbers and letters between math tokens, as in α + 2 β
+	prev := -1
+	for i, t := range tokens {
+		if !t.math {
+			continue
+		}
+		if prev >= 0 && i-prev > 1 && i-prev <= 4 {
+			bridged := true
+			for _, gap := range tokens[prev+1 : i] {
+				bridged = bridged && (gap.space || gap.bridge)
+			}
+			for j := prev + 1; bridged && j < i; j++ {
+				tokens[j].math = true
+			}
+		}
+		prev = i
+	}
+
+	// The operands of operators at the ends of a run, as in 8 × 8 or Ns = 1
+	for i, t := range tokens {
+		if !t.math || !t.operator {
+			continue
+		}
+		for _, dir := range []int{-1, 1} {
+			if j := neighbor(i, dir); operand(j) && !tokens[j].math {
+				for k := min(i, j); k <= max(i, j); k++ {
+					tokens[k].math = true
+				}
+			}
+		}
+	}
+
+	// Scripts attach to the token before them. Raised text after a word is
+	// a footnote mark unless the word is math or a single letter, as in x².
+	for i := 1; i < len(tokens); i++ {
+		t, base := &tokens[i], &tokens[i-1]
+		if t.script == "" || t.space || base.space || !t.operand && !t.math {
+			continue
+		}
+		switch {
+		case base.math:
+			t.math = true
+		case t.math && base.operand:
+			base.math = true
+		case t.script == "^" && base.bridge && !numberRe.MatchString(base.text):
+			t.math, base.math = true, true
+		}
+	}
+}
+
+// inlineLatex writes a run of math tokens as inline LaTeX. Punctuation
+// ending the run is returned separately to go after it.
+func inlineLatex(tokens []mathToken) (string, string) {
+	latex := tokensLatex(tokens)
+	trimmed := strings.TrimRight(latex, ".,;:")
+	// Commands like \, end in punctuation that belongs to them
+	if strings.HasSuffix(trimmed, `\`) {
+		trimmed = latex
+	}
+	return "$" + trimmed + "$", latex[len(trimmed):]
+}
+
+// tokensLatex writes math tokens as LaTeX, with the words that are shifted
+// off the baseline in scripts.
+func tokensLatex(tokens []mathToken) string {
+	var sb strings.Builder
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.space:
+			sb.WriteByte(' ')
+		case t.script != "":
+			// A script can be split into several words
+			var script strings.Builder
+			for ; i < len(tokens) && (tokens[i].script == t.script || tokens[i].space && i+1 < len(tokens) && tokens[i+1].script == t.script); i++ {
+				script.WriteString(UnicodeToLatex(tokens[i].text))
+			}
+			i--
+			sb.WriteString(t.script + "{" + strings.TrimSpace(script.String()) + "}")
+		default:
+			sb.WriteString(UnicodeToLatex(t.text))
+		}
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// tokenSpan makes a span for tokens of the line, holding text if given
+// and their own text otherwise.
+func tokenSpan(spans []schema.Span, tokens []mathToken, text *string) schema.Span {
+	span := spans[tokens[0].span]
+	bbox := tokens[0].bbox
+	var sb strings.Builder
+	for _, t := range tokens {
+		sb.WriteString(t.text)
+		bbox = bbox.Union(t.bbox)
+	}
+	span.Text = sb.String()
+	span.Bbox = bbox
+	if text != nil {
+		span.Text = *text
+		span.Font = "Latex"
+		span.Bold, span.Italic = false, false
+	}
+	return span
+}
+
+// spanTokenBboxes estimates the boxes of parts of a span's text from their
+// share of it.
+func spanTokenBboxes(span schema.Span, parts []string) []geometry.Bbox {
+	total := utf8.RuneCountInString(span.Text)
+	bboxes := make([]geometry.Bbox, len(parts))
+	offset := 0
+	for i, part := range parts {
+		n := utf8.RuneCountInString(part)
+		x0 := span.Bbox.X0() + span.Bbox.Width()*float64(offset)/float64(total)
+		x1 := span.Bbox.X0() + span.Bbox.Width()*float64(offset+n)/float64(total)
+		bboxes[i] = geometry.Bbox{x0, span.Bbox.Y0(), x1, span.Bbox.Y1()}
+		offset += n
+	}
+	return bboxes
+}
+
+func isMathFont(font string) bool {
+	return mathFontRe.MatchString(font)
+}
+
+// isMathFontWord reports whether a word in a math font is math. Marks and
+// punctuation on their own aren't, and neither are glyphs the PDF has no
+// characters for.
+func isMathFontWord(word string) bool {
+	for _, r := range word {
+		if r == utf8.RuneError || unicode.Is(unicode.Co, r) {
+			return false
+		}
+	}
+	return !onlyGlyphs(word, markGlyphs) && !onlyGlyphs(word, punctuationGlyph)
+}
+
+// onlyGlyphs reports whether text is made of glyphs and spaces only.
+func onlyGlyphs(text, glyphs string) bool {
+	return strings.TrimSpace(text) != "" && strings.Trim(text, glyphs+" \t") == ""
+}
+
+// isOperator reports whether a word is a single operator or relation.
+func isOperator(word string) bool {
+	runes := []rune(strings.TrimSpace(word))
+	return len(runes) == 1 && (unicode.Is(unicode.Sm, runes[0]) || latexSymbols[runes[0]] != "" && !unicode.IsLetter(runes[0]))
+}
+
+// isMathWord reports whether a word in ordinary text is math: it is made of
+// math glyphs, digits and lone letters, with at least one glyph that only
+// math uses.
+func isMathWord(word string) bool {
+	runes := []rune(word)
+	strong := false
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r):
+			// Runs of letters are words, unless they are styled math letters
+			if _, ok := mathAlphanumeric(r); ok {
+				strong = true
+			} else if i > 0 && unicode.IsLetter(runes[i-1]) {
+				return false
+			}
+			if unicode.Is(unicode.Greek, r) {
+				strong = true
+			}
+		case unicode.IsDigit(r) || strings.ContainsRune("()[]|/'′^_", r):
+		case superscripts[r] != 0 || subscripts[r] != 0:
+			strong = true
+		case strings.ContainsRune(markGlyphs, r):
+			return false
+		case r > unicode.MaxASCII && unicode.Is(unicode.Sm, r):
+			strong = true
+		default:
+			return false
+		}
+	}
+	return strong
+}
+
+// isASCIIOperator reports whether a word is an operator of ordinary text,
+// which is only math between operands, as in "a = b".
+func isASCIIOperator(word string) bool {
+	return len(word) == 1 && strings.Contains("=+<>", word)
+}
+
+// isBridge reports whether a word reads as math next to math, which numbers
+// and single letters do.
+func isBridge(word string) bool {
+	runes := []rune(word)
+	return numberRe.MatchString(word) || len(runes) == 1 && unicode.IsLetter(runes[0]) && runes[0] <= unicode.MaxASCII
+}
+
+// isOperand reports whether a word reads as math next to an operator: a
+// bridge, a function applied to its arguments like "f(x)", or a short
+// variable name.
+func isOperand(word string) bool {
+	return isBridge(word) || applicationRe.MatchString(word) || isVariableName(word)
+}
+
+// isVariableName reports whether a word is a short variable name like "Kx",
+// "X2" or "MCU".
+func isVariableName(word string) bool {
+	if isBridge(word) || len(word) > 4 || !unicode.IsUpper(rune(word[0])) || operandStopWords[word] {
+		return false
+	}
+	upper, digits := 0, 0
+	for _, r := range word {
+		switch {
+		case r > unicode.MaxASCII:
+			return false
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsDigit(r):
+			digits++
+		case !unicode.IsLetter(r):
+			return false
+		}
+	}
+	return digits > 0 || upper == len(word) || len(word) == 2
+}
+
+// operandStopWords are capitalized words that look like variable names.
+var operandStopWords = makeSet("An", "As", "At", "Be", "By", "Do", "Go", "He", "If", "In", "Is", "It", "Me", "My", "No", "Of", "On", "Or", "So", "To", "Up", "We", "OK")
+
+// splitPunctuation splits the sentence punctuation, quotes and unbalanced
+// brackets off both ends of a word.
+func splitPunctuation(text string) (string, string, string) {
+	runes := []rune(text)
+	start, end := 0, len(runes)
+	unbalanced := func(open, close rune) bool {
+		count := 0
+		for _, r := range runes[start:end] {
+			if r == open {
+				count++
+			} else if r == close {
+				count--
+			}
+		}
+		return count != 0
+	}
+	for start < end {
+		r := runes[start]
+		if !strings.ContainsRune("\"'“‘", r) && !(r == '(' && unbalanced('(', ')')) && !(r == '[' && unbalanced('[', ']')) {
+			break
+		}
+		start++
+	}
+	for end > start {
+		r := runes[end-1]
+		if !strings.ContainsRune(".,;:!?\"'”’", r) && !(r == ')' && unbalanced('(', ')')) && !(r == ']' && unbalanced('[', ']')) {
+			break
+		}
+		end--
+	}
+	return string(runes[:start]), string(runes[start:end]), string(runes[end:])
+}
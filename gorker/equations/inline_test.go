@@ -0,0 +1,66 @@
+package equations
+
+import (
+	"strings"
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+func textLine(text string) schema.Line {
+	bbox := geometry.Bbox{72, 100, 72 + 5*float64(len([]rune(text))), 110}
+	return schema.Line{
+		Spans: []schema.Span{{Text: text, Bbox: bbox, SpanID: "0_0", Font: "TimesNewRoman", FontSize: 10}},
+		Bbox:  bbox,
+	}
+}
+
+func TestFormatLineMath(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		// Acronyms joined by operators of ordinary text are prose
+		{"The CPU + GPU budget", "The CPU + GPU budget"},
+		{"the NATO + EU summit", "the NATO + EU summit"},
+		{"The USB + HDMI ports", "The USB + HDMI ports"},
+		{"I + II", "I + II"},
+		{"Costs went from $5 to $10", "Costs went from $5 to $10"},
+
+		{"where a = b holds", "where $a = b$ holds"},
+		{"Let f(x) = x² + 1", "Let $f(x) = x^{2} + 1$"},
+		{"so Kx = α here", "so $Kx = \\alpha$ here"},
+		{"for α + 2 β.", "for $\\alpha + 2 \\beta$."},
+	}
+	for _, tt := range tests {
+		spans, _ := formatLineMath(textLine(tt.text))
+		var got strings.Builder
+		for _, span := range spans {
+			got.WriteString(span.Text)
+		}
+		if got.String() != tt.want {
+			t.Errorf("formatLineMath(%q) = %q, want %q", tt.text, got.String(), tt.want)
+		}
+	}
+}
+
+func TestFormatLineMathTrailingPunctuation(t *testing.T) {
+	// Each character is 5 points wide
+	line := schema.Line{Spans: []schema.Span{
+		{Text: "so ", Bbox: geometry.Bbox{72, 100, 87, 110}, Font: "Times", FontSize: 10},
+		{Text: "α = β.", Bbox: geometry.Bbox{87, 100, 117, 110}, Font: "CMMI10", FontSize: 10},
+	}}
+	spans, runs := formatLineMath(line)
+	if runs != 1 || len(spans) != 3 {
+		t.Fatalf("got %d runs in spans %+v, want one run and the text around it", runs, spans)
+	}
+	math, after := spans[1], spans[2]
+	if want := (geometry.Bbox{87, 100, 117, 110}); math.Text != `$\alpha = \beta$` || math.Bbox != want {
+		t.Errorf("math span = %q %v, want %q %v", math.Text, math.Bbox, `$\alpha = \beta$`, want)
+	}
+	// The period keeps the box of the word it ended, not of the whole run
+	if want := (geometry.Bbox{107, 100, 117, 110}); after.Text != "." || after.Bbox != want {
+		t.Errorf("trailing span = %q %v, want %q %v", after.Text, after.Bbox, ".", want)
+	}
+}
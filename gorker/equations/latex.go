@@ -0,0 +1,235 @@
+package equations
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	latexCommandRe = regexp.MustCompile(`\\([a-zA-Z]+)`)
+	latexEnvRe     = regexp.MustCompile(`\\(begin|end)\s*\{([a-zA-Z*]+)\}`)
+)
+
+// knownCommands are the LaTeX commands equations are expected to use. A
+// command outside of them is most likely a misread.
+var knownCommands = makeSet(
+	// Greek letters
+	"alpha", "beta", "gamma", "delta", "epsilon", "varepsilon", "zeta", "eta", "theta", "vartheta",
+	"iota", "kappa", "varkappa", "lambda", "mu", "nu", "xi", "omicron", "pi", "varpi", "rho", "varrho",
+	"sigma", "varsigma", "tau", "upsilon", "phi", "varphi", "chi", "psi", "omega",
+	"Gamma", "Delta", "Theta", "Lambda", "Xi", "Pi", "Sigma", "Upsilon", "Phi", "Psi", "Omega",
+	"varGamma", "varDelta", "varTheta", "varLambda", "varXi", "varPi", "varSigma", "varUpsilon", "varPhi", "varPsi", "varOmega",
+	// Structure
+	"frac", "dfrac", "tfrac", "cfrac", "sqrt", "binom", "dbinom", "tbinom", "choose", "over", "atop",
+	"left", "right", "middle", "big", "Big", "bigg", "Bigg", "bigl", "bigr", "Bigl", "Bigr", "biggl", "biggr", "Biggl", "Biggr",
+	"begin", "end", "limits", "nolimits", "displaystyle", "textstyle", "scriptstyle", "scriptscriptstyle",
+	"overline", "underline", "overbrace", "underbrace", "overset", "underset", "stackrel", "substack",
+	"overrightarrow", "overleftarrow", "widehat", "widetilde", "boxed", "phantom", "hphantom", "vphantom",
+	"not", "operatorname", "mathop", "mathrel", "mathbin", "mathord", "tag", "label", "nonumber", "notag",
+	// Accents
+	"hat", "tilde", "bar", "vec", "dot", "ddot", "dddot", "acute", "grave", "breve", "check", "mathring",
+	// Fonts and text
+	"mathrm", "mathbf", "mathit", "mathsf", "mathtt", "mathcal", "mathbb", "mathfrak", "mathscr", "boldsymbol", "bm",
+	"text", "textrm", "textbf", "textit", "textsf", "texttt", "mbox", "rm", "bf", "it", "cal", "mathnormal",
+	"scriptsize", "footnotesize", "small", "normalsize", "large", "Large", "huge",
+	// Spacing
+	"quad", "qquad", "hspace", "vspace", "hfill", "space", "enspace", "thinspace", "negthinspace", "kern", "mkern", "mskip", "hskip",
+	"cdot", "cdots", "ldots", "dots", "vdots", "ddots", "dotsc", "dotsb", "dotsm", "newline", "hline", "cline", "noalign",
+	// Big operators
+	"sum", "prod", "coprod", "int", "iint", "iiint", "oint", "bigcup", "bigcap", "bigsqcup", "bigvee", "bigwedge",
+	"bigoplus", "bigotimes", "bigodot", "biguplus",
+	// Functions
+	"sin", "cos", "tan", "cot", "sec", "csc", "arcsin", "arccos", "arctan", "sinh", "cosh", "tanh", "coth",
+	"log", "ln", "lg", "exp", "lim", "liminf", "limsup", "sup", "inf", "max", "min", "arg", "det", "dim",
+	"gcd", "hom", "ker", "deg", "Pr", "mod", "bmod", "pmod",
+	// Binary operators
+	"pm", "mp", "times", "div", "ast", "star", "circ", "bullet", "oplus", "ominus", "otimes", "oslash", "odot",
+	"cup", "cap", "sqcup", "sqcap", "vee", "wedge", "lor", "land", "setminus", "wr", "diamond", "uplus", "amalg",
+	"dagger", "ddagger", "triangleleft", "triangleright", "bigtriangleup", "bigtriangledown", "cdotp",
+	// Relations
+	"leq", "le", "geq", "ge", "neq", "ne", "equiv", "approx", "sim", "simeq", "cong", "propto", "ll", "gg",
+	"subset", "supset", "subseteq", "supseteq", "sqsubset", "sqsupset", "sqsubseteq", "sqsupseteq",
+	"in", "ni", "notin", "perp", "parallel", "mid", "nmid", "asymp", "doteq", "models", "vdash", "dashv",
+	"prec", "succ", "preceq", "succeq", "leqslant", "geqslant", "lesssim", "gtrsim", "triangleq", "coloneqq",
+	// Arrows
+	"to", "gets", "rightarrow", "leftarrow", "leftrightarrow", "Rightarrow", "Leftarrow", "Leftrightarrow",
+	"longrightarrow", "longleftarrow", "longleftrightarrow", "Longrightarrow", "Longleftarrow", "Longleftrightarrow",
+	"mapsto", "longmapsto", "implies", "impliedby", "iff", "uparrow", "downarrow", "updownarrow", "Uparrow", "Downarrow",
+	"nearrow", "searrow", "swarrow", "nwarrow", "hookrightarrow", "hookleftarrow", "rightleftharpoons",
+	// Symbols
+	"infty", "partial", "nabla", "forall", "exists", "nexists", "neg", "lnot", "emptyset", "varnothing",
+	"aleph", "hbar", "ell", "wp", "Re", "Im", "prime", "angle", "triangle", "square", "Box", "surd", "top", "bot",
+	"therefore", "because", "checkmark", "degree", "circledast", "S", "P", "dag", "ddag",
+	// Delimiters
+	"langle", "rangle", "lceil", "rceil", "lfloor", "rfloor", "lvert", "rvert", "lVert", "rVert", "vert", "Vert",
+	"lbrace", "rbrace", "lbrack", "rbrack", "backslash",
+	// Arrays
+	"multicolumn", "multirow", "arraystretch", "color", "textcolor",
+)
+
+func makeSet(items ...string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
+
+// ValidLatex reports whether latex parses as an equation: its braces are
+// balanced, its environments are closed in order, every \left has a \right
+// and it only uses known commands.
+func ValidLatex(latex string) bool {
+	latex = strings.TrimSpace(latex)
+	latex = strings.TrimSuffix(strings.TrimPrefix(latex, "$$"), "$$")
+
+	// Escaped braces are literal ones
+	stripped := strings.NewReplacer(`\\`, "", `\{`, "", `\}`, "").Replace(latex)
+	depth := 0
+	for _, r := range stripped {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		if depth < 0 {
+			return false
+		}
+	}
+	if depth != 0 {
+		return false
+	}
+
+	var envs []string
+	for _, m := range latexEnvRe.FindAllStringSubmatch(latex, -1) {
+		if m[1] == "begin" {
+			envs = append(envs, m[2])
+			continue
+		}
+		if len(envs) == 0 || envs[len(envs)-1] != m[2] {
+			return false
+		}
+		envs = envs[:len(envs)-1]
+	}
+	if len(envs) > 0 {
+		return false
+	}
+
+	lefts, rights := 0, 0
+	for _, m := range latexCommandRe.FindAllStringSubmatch(stripped, -1) {
+		switch m[1] {
+		case "left":
+			lefts++
+		case "right":
+			rights++
+		}
+		if !knownCommands[m[1]] {
+			return false
+		}
+	}
+	return lefts == rights
+}
+
+// latexSymbols are the LaTeX commands for math glyphs in extracted text.
+var latexSymbols = map[rune]string{
+	'α': `\alpha`, 'β': `\beta`, 'γ': `\gamma`, 'δ': `\delta`, 'ε': `\varepsilon`, 'ϵ': `\epsilon`, 'ζ': `\zeta`,
+	'η': `\eta`, 'θ': `\theta`, 'ϑ': `\vartheta`, 'ι': `\iota`, 'κ': `\kappa`, 'λ': `\lambda`, 'μ': `\mu`, 'µ': `\mu`,
+	'ν': `\nu`, 'ξ': `\xi`, 'π': `\pi`, 'ϖ': `\varpi`, 'ρ': `\rho`, 'ϱ': `\varrho`, 'σ': `\sigma`, 'ς': `\varsigma`,
+	'τ': `\tau`, 'υ': `\upsilon`, 'φ': `\varphi`, 'ϕ': `\phi`, 'χ': `\chi`, 'ψ': `\psi`, 'ω': `\omega`,
+	'Γ': `\Gamma`, 'Δ': `\Delta`, 'Θ': `\Theta`, 'Λ': `\Lambda`, 'Ξ': `\Xi`, 'Π': `\Pi`, 'Σ': `\Sigma`,
+	'Υ': `\Upsilon`, 'Φ': `\Phi`, 'Ψ': `\Psi`, 'Ω': `\Omega`, '\u2126': `\Omega`,
+	'≤': `\leq`, '≥': `\geq`, '≦': `\leq`, '≧': `\geq`, '⩽': `\leqslant`, '⩾': `\geqslant`, '≠': `\neq`,
+	'≈': `\approx`, '≡': `\equiv`, '∼': `\sim`, '≃': `\simeq`, '≅': `\cong`, '∝': `\propto`, '≪': `\ll`, '≫': `\gg`,
+	'≺': `\prec`, '≻': `\succ`, '⪯': `\preceq`, '⪰': `\succeq`, '≜': `\triangleq`, '≔': `\coloneqq`, '≍': `\asymp`,
+	'∈': `\in`, '∉': `\notin`, '∋': `\ni`, '⊂': `\subset`, '⊃': `\supset`, '⊆': `\subseteq`, '⊇': `\supseteq`,
+	'∪': `\cup`, '∩': `\cap`, '⊔': `\sqcup`, '⊓': `\sqcap`, '∖': `\setminus`, '∅': `\emptyset`, '⊥': `\perp`,
+	'∥': `\parallel`, '∣': `\mid`, '⊢': `\vdash`, '⊨': `\models`,
+	'×': `\times`, '÷': `\div`, '±': `\pm`, '∓': `\mp`, '·': `\cdot`, '⋅': `\cdot`, '∙': `\bullet`, '∗': `\ast`,
+	'∘': `\circ`, '⊕': `\oplus`, '⊖': `\ominus`, '⊗': `\otimes`, '⊙': `\odot`, '⊘': `\oslash`, '∧': `\wedge`,
+	'∨': `\vee`, '¬': `\neg`, '†': `\dagger`, '‡': `\ddagger`, '⋆': `\star`, '−': `-`, '–': `-`, '∕': `/`,
+	'∑': `\sum`, '∏': `\prod`, '∐': `\coprod`, '∫': `\int`, '∬': `\iint`, '∭': `\iiint`, '∮': `\oint`,
+	'⋃': `\bigcup`, '⋂': `\bigcap`, '⋁': `\bigvee`, '⋀': `\bigwedge`, '⨁': `\bigoplus`, '⨂': `\bigotimes`,
+	'√': `\sqrt`, '∞': `\infty`, '∂': `\partial`, '∇': `\nabla`, '∀': `\forall`, '∃': `\exists`, '∄': `\nexists`,
+	'ℵ': `\aleph`, 'ℏ': `\hbar`, 'ℓ': `\ell`, '℘': `\wp`, 'ℜ': `\Re`, 'ℑ': `\Im`, '∠': `\angle`, '△': `\triangle`,
+	'∴': `\therefore`, '∵': `\because`, '′': `'`, '″': `''`, '°': `^{\circ}`, '…': `\ldots`, '⋯': `\cdots`,
+	'⋮': `\vdots`, '⋱': `\ddots`,
+	'→': `\to`, '←': `\leftarrow`, '↔': `\leftrightarrow`, '⇒': `\Rightarrow`, '⇐': `\Leftarrow`, '⇔': `\Leftrightarrow`,
+	'⟶': `\longrightarrow`, '⟵': `\longleftarrow`, '⟹': `\Longrightarrow`, '⟺': `\Longleftrightarrow`, '↦': `\mapsto`,
+	'↑': `\uparrow`, '↓': `\downarrow`, '⇑': `\Uparrow`, '⇓': `\Downarrow`, '↗': `\nearrow`, '↘': `\searrow`,
+	'↪': `\hookrightarrow`, '⇌': `\rightleftharpoons`,
+	'⟨': `\langle`, '⟩': `\rangle`, '〈': `\langle`, '〉': `\rangle`, '⌈': `\lceil`, '⌉': `\rceil`, '⌊': `\lfloor`,
+	'⌋': `\rfloor`, '‖': `\|`, '{': `\{`, '}': `\}`, '\\': `\backslash`, '%': `\%`, '#': `\#`, '&': `\&`, '$': `\$`,
+	'ℝ': `\mathbb{R}`, 'ℕ': `\mathbb{N}`, 'ℤ': `\mathbb{Z}`, 'ℚ': `\mathbb{Q}`, 'ℂ': `\mathbb{C}`,
+}
+
+// Superscript and subscript characters, and what they are written as.
+var (
+	superscripts = map[rune]rune{
+		'⁰': '0', '¹': '1', '²': '2', '³': '3', '⁴': '4', '⁵': '5', '⁶': '6', '⁷': '7', '⁸': '8', '⁹': '9',
+		'⁺': '+', '⁻': '-', '⁼': '=', '⁽': '(', '⁾': ')', 'ⁿ': 'n', 'ⁱ': 'i',
+	}
+	subscripts = map[rune]rune{
+		'₀': '0', '₁': '1', '₂': '2', '₃': '3', '₄': '4', '₅': '5', '₆': '6', '₇': '7', '₈': '8', '₉': '9',
+		'₊': '+', '₋': '-', '₌': '=', '₍': '(', '₎': ')',
+	}
+)
+
+// mathAlphanumeric returns the plain letter or digit a character of the
+// Mathematical Alphanumeric Symbols block is styled from, such as x for 𝑥.
+func mathAlphanumeric(r rune) (rune, bool) {
+	switch {
+	case r >= 0x1D400 && r <= 0x1D6A3:
+		i := (r - 0x1D400) % 52
+		if i < 26 {
+			return 'A' + i, true
+		}
+		return 'a' + i - 26, true
+	case r >= 0x1D7CE && r <= 0x1D7FF:
+		return '0' + (r-0x1D7CE)%10, true
+	}
+	return 0, false
+}
+
+// UnicodeToLatex writes extracted math text as LaTeX, replacing glyphs with
+// their commands and superscript and subscript characters with scripts.
+func UnicodeToLatex(text string) string {
+	runes := []rune(text)
+	var sb strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if _, ok := superscripts[r]; ok {
+			sb.WriteString("^{")
+			for ; i < len(runes) && superscripts[runes[i]] != 0; i++ {
+				sb.WriteRune(superscripts[runes[i]])
+			}
+			sb.WriteString("}")
+			i--
+			continue
+		}
+		if _, ok := subscripts[r]; ok {
+			sb.WriteString("_{")
+			for ; i < len(runes) && subscripts[runes[i]] != 0; i++ {
+				sb.WriteRune(subscripts[runes[i]])
+			}
+			sb.WriteString("}")
+			i--
+			continue
+		}
+		if plain, ok := mathAlphanumeric(r); ok {
+			sb.WriteRune(plain)
+			continue
+		}
+		command, ok := latexSymbols[r]
+		if !ok {
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteString(command)
+		// Keep a command from running into the letters after it
+		if i+1 < len(runes) && unicode.IsLetter(runes[i+1]) && latexCommandRe.MatchString(command) && unicode.IsLetter(rune(command[len(command)-1])) {
+			sb.WriteByte(' ')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,151 @@
+package equations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorker/gorker/settings"
+)
+
+// EquationRecognizer reads the LaTeX of rendered equations. The results line
+// up with images, and an empty result is an equation that couldn't be read,
+// such as a nil image. maxTokens bounds the length of each prediction, and
+// results that reach it were cut off and come back empty too.
+type EquationRecognizer interface {
+	Recognize(ctx context.Context, images []image.Image, maxTokens int) ([]string, error)
+}
+
+// NewRecognizer creates the recognizer selected by settings.EquationEngine,
+// or nil if equation recognition is turned off.
+func NewRecognizer() (EquationRecognizer, error) {
+	switch settings.EquationEngine {
+	case "server":
+		return NewServerRecognizer(settings.TexifyServerURL), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown equation engine %q", settings.EquationEngine)
+	}
+}
+
+// ServerRecognizer sends equations to a LaTeX-OCR server running locally,
+// such as the one started by "python -m pix2tex.api.run". Each image is
+// posted as a PNG in the "file" field of a multipart form, along with the
+// token limit in the "max_tokens" field for servers that bound their
+// prediction by it, and the server answers with the LaTeX as a JSON string.
+// The images of a call are sent at the same time.
+type ServerRecognizer struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewServerRecognizer creates a recognizer for the server at url, waiting
+// settings.TexifyTimeout seconds for each equation.
+func NewServerRecognizer(url string) *ServerRecognizer {
+	return &ServerRecognizer{
+		URL:    url,
+		Client: &http.Client{Timeout: time.Duration(settings.TexifyTimeout) * time.Second},
+	}
+}
+
+// Recognize reads the equations in images. An equation the server fails on
+// comes back empty, and an error is only returned when every equation
+// failed, which usually means the server can't be reached.
+func (r *ServerRecognizer) Recognize(ctx context.Context, images []image.Image, maxTokens int) ([]string, error) {
+	results := make([]string, len(images))
+	errs := make([]error, len(images))
+	sent := 0
+	var wg sync.WaitGroup
+	for i, img := range images {
+		if img == nil {
+			continue
+		}
+		sent++
+		wg.Add(1)
+		go func(i int, img image.Image) {
+			defer wg.Done()
+			results[i], errs[i] = r.recognize(ctx, img, maxTokens)
+		}(i, img)
+	}
+	wg.Wait()
+
+	failed := 0
+	var firstErr error
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		// Servers that ignore the limit stop generating at their own, so a
+		// result this long was cut off either way
+		if estimateTokens(results[i]) >= maxTokens-1 {
+			results[i] = ""
+		}
+	}
+	if failed > 0 && failed == sent {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+func (r *ServerRecognizer) recognize(ctx context.Context, img image.Image, maxTokens int) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("max_tokens", strconv.Itoa(maxTokens)); err != nil {
+		return "", err
+	}
+	part, err := form.CreateFormFile("file", "equation.png")
+	if err != nil {
+		return "", err
+	}
+	if err := png.Encode(part, img); err != nil {
+		return "", fmt.Errorf("encoding equation image: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("equation server returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var latex string
+	if err := json.Unmarshal(data, &latex); err != nil {
+		var syntaxErr *json.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			return "", fmt.Errorf("reading equation server response: %w", err)
+		}
+		// Plain text responses hold the LaTeX as is
+		latex = string(data)
+	}
+	return strings.TrimSpace(latex), nil
+}
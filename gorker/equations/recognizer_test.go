@@ -0,0 +1,182 @@
+package equations
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"gorker/gorker/settings"
+)
+
+// equationImage returns an image whose width tells the stub server which
+// answer to give.
+func equationImage(width int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, 4))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.White)
+	}
+	return img
+}
+
+// stubServer answers like a LaTeX-OCR server, picking the response from the
+// width of the posted image. It counts the images it was sent.
+func stubServer(t *testing.T, requests *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "no file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		img, err := png.Decode(file)
+		if err != nil {
+			http.Error(w, "not a png", http.StatusBadRequest)
+			return
+		}
+		switch img.Bounds().Dx() {
+		case 1:
+			w.Write([]byte(`"x^{2} + 1"`))
+		case 2:
+			w.Write([]byte(`\frac{a}{b}`))
+		default:
+			http.Error(w, "model crashed", http.StatusInternalServerError)
+		}
+	}))
+}
+
+func TestServerRecognizer(t *testing.T) {
+	tests := []struct {
+		name     string
+		images   []image.Image
+		want     []string
+		requests int32
+		wantErr  bool
+	}{
+		{"json string", []image.Image{equationImage(1)}, []string{"x^{2} + 1"}, 1, false},
+		{"plain text", []image.Image{equationImage(2)}, []string{`\frac{a}{b}`}, 1, false},
+		{"failed equation comes back empty", []image.Image{equationImage(1), equationImage(3)}, []string{"x^{2} + 1", ""}, 2, false},
+		{"nil images aren't sent", []image.Image{nil, equationImage(2), nil}, []string{"", `\frac{a}{b}`, ""}, 1, false},
+		{"only nil images", []image.Image{nil, nil}, []string{"", ""}, 0, false},
+		{"every equation failed", []image.Image{equationImage(3), equationImage(3)}, nil, 2, true},
+	}
+	for _, tt := range tests {
+		var requests int32
+		server := stubServer(t, &requests)
+		recognizer := NewServerRecognizer(server.URL)
+
+		got, err := recognizer.Recognize(context.Background(), tt.images, 100)
+		server.Close()
+
+		if requests != tt.requests {
+			t.Errorf("%s: sent %d requests, want %d", tt.name, requests, tt.requests)
+		}
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestServerRecognizerUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	_, err := NewServerRecognizer(url).Recognize(context.Background(), []image.Image{equationImage(1)}, 100)
+	if err == nil {
+		t.Error("got no error from a server that isn't running")
+	}
+}
+
+func TestServerRecognizerSendsTokenLimit(t *testing.T) {
+	var limit atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit.Store(r.FormValue("max_tokens"))
+		w.Write([]byte(`"x"`))
+	}))
+	defer server.Close()
+
+	if _, err := NewServerRecognizer(server.URL).Recognize(context.Background(), []image.Image{equationImage(1)}, 42); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := limit.Load(); got != "42" {
+		t.Errorf("server was sent a token limit of %q, want %q", got, "42")
+	}
+}
+
+// batchRecognizer records the batches it is asked to read, and fails on the
+// batch numbered failAt.
+type batchRecognizer struct {
+	batches []int
+	failAt  int
+}
+
+func (r *batchRecognizer) Recognize(ctx context.Context, images []image.Image, maxTokens int) ([]string, error) {
+	r.batches = append(r.batches, len(images))
+	if len(r.batches) == r.failAt {
+		return nil, errors.New("server went away")
+	}
+	results := make([]string, len(images))
+	for i := range results {
+		results[i] = "x"
+	}
+	return results, nil
+}
+
+func TestGetLatexBatched(t *testing.T) {
+	defer func(size int) { settings.TexifyBatchSize = size }(settings.TexifyBatchSize)
+	settings.TexifyBatchSize = 2
+
+	images := make([]image.Image, 5)
+	tokens := make([]int, 5)
+
+	recognizer := &batchRecognizer{}
+	predictions, err := getLatexBatched(context.Background(), images, tokens, recognizer, 1)
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if want := []int{2, 2, 1}; !slices.Equal(recognizer.batches, want) {
+		t.Errorf("batches = %v, want %v", recognizer.batches, want)
+	}
+	for i, p := range predictions {
+		if p != "x" {
+			t.Errorf("prediction %d = %q, want %q", i, p, "x")
+		}
+	}
+
+	recognizer = &batchRecognizer{}
+	if _, err := getLatexBatched(context.Background(), images, tokens, recognizer, 2); err != nil {
+		t.Errorf("unexpected error with a multiplier of 2: %v", err)
+	}
+	if want := []int{4, 1}; !slices.Equal(recognizer.batches, want) {
+		t.Errorf("batches with a multiplier of 2 = %v, want %v", recognizer.batches, want)
+	}
+
+	// Equations after a failed batch keep their text
+	recognizer = &batchRecognizer{failAt: 2}
+	predictions, err = getLatexBatched(context.Background(), images, tokens, recognizer, 1)
+	if err == nil {
+		t.Error("got no error from a failed batch")
+	}
+	if want := []string{"x", "x", "", "", ""}; !slices.Equal(predictions, want) {
+		t.Errorf("predictions after a failure = %q, want %q", predictions, want)
+	}
+}
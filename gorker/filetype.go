@@ -0,0 +1,47 @@
+package gorker
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gen2brain/go-fitz"
+
+	"gorker/gorker/pdf"
+)
+
+// FindFiletype sniffs the document formats MuPDF can convert, returning
+// "other" for anything else.
+func FindFiletype(data []byte) string {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+
+	switch {
+	case bytes.Contains(head, []byte("%PDF-")):
+		return "pdf"
+	case len(data) >= 68 && string(data[60:68]) == "BOOKMOBI":
+		return "mobi"
+	case bytes.Contains(head, []byte("<FictionBook")):
+		return "fb2"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		if bytes.Contains(head, []byte("mimetypeapplication/epub+zip")) {
+			return "epub"
+		}
+		if bytes.Contains(data, []byte("FixedDocumentSequence")) {
+			return "xps"
+		}
+	}
+	return "other"
+}
+
+// GetLengthOfText returns the number of characters in the embedded text of a
+// document, without converting it.
+func GetLengthOfText(data []byte) (int, error) {
+	doc, err := fitz.NewFromMemory(data)
+	if err != nil {
+		return 0, fmt.Errorf("opening document: %w", err)
+	}
+	defer doc.Close()
+	return pdf.GetLengthOfText(doc)
+}
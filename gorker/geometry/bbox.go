@@ -0,0 +1,164 @@
+package geometry
+
+import "math"
+
+// Bbox is an axis aligned box stored as x0, y0, x1, y1 with the origin in the
+// top left corner. Boxes are in PDF point space unless noted otherwise.
+type Bbox [4]float64
+
+func (b Bbox) X0() float64 { return b[0] }
+func (b Bbox) Y0() float64 { return b[1] }
+func (b Bbox) X1() float64 { return b[2] }
+func (b Bbox) Y1() float64 { return b[3] }
+
+func (b Bbox) Width() float64 {
+	return b[2] - b[0]
+}
+
+func (b Bbox) Height() float64 {
+	return b[3] - b[1]
+}
+
+func (b Bbox) Area() float64 {
+	if b.Width() <= 0 || b.Height() <= 0 {
+		return 0
+	}
+	return b.Width() * b.Height()
+}
+
+type Point struct {
+	X float64
+	Y float64
+}
+
+func (b Bbox) Center() Point {
+	return Point{(b[0] + b[2]) / 2, (b[1] + b[3]) / 2}
+}
+
+// Intersection returns the overlapping region of b and other. Boxes that do
+// not overlap give an empty box with zero area.
+func (b Bbox) Intersection(other Bbox) Bbox {
+	inter := Bbox{
+		math.Max(b[0], other[0]),
+		math.Max(b[1], other[1]),
+		math.Min(b[2], other[2]),
+		math.Min(b[3], other[3]),
+	}
+	if inter[2] < inter[0] || inter[3] < inter[1] {
+		return Bbox{}
+	}
+	return inter
+}
+
+func (b Bbox) IntersectionArea(other Bbox) float64 {
+	return b.Intersection(other).Area()
+}
+
+// IntersectionPct is the fraction of b's area covered by other. It is the
+// measure compared against settings.BboxIntersectionThresh everywhere.
+func (b Bbox) IntersectionPct(other Bbox) float64 {
+	area := b.Area()
+	if area == 0 {
+		return 0
+	}
+	return b.IntersectionArea(other) / area
+}
+
+// OverlapX is the length of the shared horizontal extent of two boxes.
+func (b Bbox) OverlapX(other Bbox) float64 {
+	return math.Max(0, math.Min(b[2], other[2])-math.Max(b[0], other[0]))
+}
+
+// OverlapY is the length of the shared vertical extent of two boxes.
+func (b Bbox) OverlapY(other Bbox) float64 {
+	return math.Max(0, math.Min(b[3], other[3])-math.Max(b[1], other[1]))
+}
+
+// OverlapXPct is the fraction of b's width shared with other.
+func (b Bbox) OverlapXPct(other Bbox) float64 {
+	if b.Width() <= 0 {
+		return 0
+	}
+	return b.OverlapX(other) / b.Width()
+}
+
+// OverlapYPct is the fraction of b's height shared with other.
+func (b Bbox) OverlapYPct(other Bbox) float64 {
+	if b.Height() <= 0 {
+		return 0
+	}
+	return b.OverlapY(other) / b.Height()
+}
+
+func (b Bbox) Contains(other Bbox) bool {
+	return other[0] >= b[0] && other[1] >= b[1] && other[2] <= b[2] && other[3] <= b[3]
+}
+
+func (b Bbox) ContainsPoint(p Point) bool {
+	return p.X >= b[0] && p.X <= b[2] && p.Y >= b[1] && p.Y <= b[3]
+}
+
+// Distance is the gap between the closest edges of two boxes, or zero if they
+// touch or overlap.
+func (b Bbox) Distance(other Bbox) float64 {
+	dx := math.Max(0, math.Max(b[0]-other[2], other[0]-b[2]))
+	dy := math.Max(0, math.Max(b[1]-other[3], other[1]-b[3]))
+	return math.Hypot(dx, dy)
+}
+
+// MergeBboxes returns the smallest box containing every box in bboxes.
+func MergeBboxes(bboxes []Bbox) Bbox {
+	if len(bboxes) == 0 {
+		return Bbox{}
+	}
+	merged := bboxes[0]
+	for _, b := range bboxes[1:] {
+		merged = merged.Union(b)
+	}
+	return merged
+}
+
+// Union returns the smallest box containing both boxes.
+func (b Bbox) Union(other Bbox) Bbox {
+	return Bbox{
+		math.Min(b[0], other[0]),
+		math.Min(b[1], other[1]),
+		math.Max(b[2], other[2]),
+		math.Max(b[3], other[3]),
+	}
+}
+
+// RescaleBbox maps bbox from the coordinate space of origDim, usually a
+// rendered page image, into the space of newDim, usually the PDF page.
+func RescaleBbox(origDim, newDim, bbox Bbox) Bbox {
+	if origDim.Width() == 0 || origDim.Height() == 0 {
+		return bbox
+	}
+	widthScaler := newDim.Width() / origDim.Width()
+	heightScaler := newDim.Height() / origDim.Height()
+	return Bbox{
+		(bbox[0]-origDim[0])*widthScaler + newDim[0],
+		(bbox[1]-origDim[1])*heightScaler + newDim[1],
+		(bbox[2]-origDim[0])*widthScaler + newDim[0],
+		(bbox[3]-origDim[1])*heightScaler + newDim[1],
+	}
+}
+
+// NearestBbox returns the index of the candidate closest to target, preferring
+// the candidate with the largest overlap when several touch it. It returns -1
+// if there are no candidates.
+func NearestBbox(target Bbox, candidates []Bbox) int {
+	nearest := -1
+	nearestDist := math.Inf(1)
+	nearestOverlap := 0.0
+	for i, candidate := range candidates {
+		dist := candidate.Distance(target)
+		overlap := candidate.IntersectionArea(target)
+		if dist < nearestDist || (dist == 0 && overlap > nearestOverlap) {
+			nearest = i
+			nearestDist = dist
+			nearestOverlap = overlap
+		}
+	}
+	return nearest
+}
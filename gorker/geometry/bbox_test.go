@@ -0,0 +1,90 @@
+package geometry
+
+import (
+	"math"
+	"testing"
+)
+
+const tolerance = 1e-9
+
+func closeBbox(a, b Bbox) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIntersectionPct(t *testing.T) {
+	tests := []struct {
+		name        string
+		b, other    Bbox
+		pct, otherP float64
+	}{
+		{"same box", Bbox{0, 0, 10, 10}, Bbox{0, 0, 10, 10}, 1, 1},
+		{"half covered", Bbox{0, 0, 10, 10}, Bbox{5, 0, 20, 10}, 0.5, 1.0 / 3},
+		{"inside", Bbox{2, 2, 4, 4}, Bbox{0, 0, 10, 10}, 1, 0.04},
+		{"apart", Bbox{0, 0, 10, 10}, Bbox{20, 20, 30, 30}, 0, 0},
+		{"touching edges", Bbox{0, 0, 10, 10}, Bbox{10, 0, 20, 10}, 0, 0},
+		{"empty box", Bbox{5, 5, 5, 5}, Bbox{0, 0, 10, 10}, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.b.IntersectionPct(tt.other); math.Abs(got-tt.pct) > tolerance {
+			t.Errorf("%s: IntersectionPct = %v, want %v", tt.name, got, tt.pct)
+		}
+		if got := tt.other.IntersectionPct(tt.b); math.Abs(got-tt.otherP) > tolerance {
+			t.Errorf("%s: reversed IntersectionPct = %v, want %v", tt.name, got, tt.otherP)
+		}
+	}
+}
+
+func TestRescaleBbox(t *testing.T) {
+	tests := []struct {
+		name            string
+		orig, new, bbox Bbox
+		want            Bbox
+	}{
+		{"image to page", Bbox{0, 0, 1000, 2000}, Bbox{0, 0, 500, 1000}, Bbox{100, 200, 300, 400}, Bbox{50, 100, 150, 200}},
+		{"offset spaces", Bbox{10, 10, 110, 60}, Bbox{0, 0, 200, 100}, Bbox{10, 10, 60, 35}, Bbox{0, 0, 100, 50}},
+		{"same space", Bbox{0, 0, 612, 792}, Bbox{0, 0, 612, 792}, Bbox{72, 72, 540, 720}, Bbox{72, 72, 540, 720}},
+		{"empty space", Bbox{0, 0, 0, 100}, Bbox{0, 0, 612, 792}, Bbox{1, 2, 3, 4}, Bbox{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		got := RescaleBbox(tt.orig, tt.new, tt.bbox)
+		if !closeBbox(got, tt.want) {
+			t.Errorf("%s: RescaleBbox = %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.orig.Width() == 0 {
+			continue
+		}
+		if back := RescaleBbox(tt.new, tt.orig, got); !closeBbox(back, tt.bbox) {
+			t.Errorf("%s: rescaling back gave %v, want %v", tt.name, back, tt.bbox)
+		}
+	}
+}
+
+func TestNearestBbox(t *testing.T) {
+	candidates := []Bbox{
+		{0, 0, 10, 10},
+		{20, 0, 30, 10},
+		{0, 20, 30, 30},
+		{25, 5, 40, 15},
+	}
+	tests := []struct {
+		name       string
+		target     Bbox
+		candidates []Bbox
+		want       int
+	}{
+		{"closest edge", Bbox{12, 2, 14, 4}, candidates, 0},
+		{"below", Bbox{10, 35, 12, 40}, candidates, 2},
+		{"largest overlap of those touching", Bbox{26, 6, 32, 9}, candidates, 3},
+		{"no candidates", Bbox{0, 0, 1, 1}, nil, -1},
+	}
+	for _, tt := range tests {
+		if got := NearestBbox(tt.target, tt.candidates); got != tt.want {
+			t.Errorf("%s: NearestBbox = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
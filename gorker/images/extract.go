@@ -1,93 +1,24 @@
-package main
+package images
 
 import (
+	"errors"
 	"fmt"
-)
-
-// Placeholder for settings
-var settings struct {
-	BBOX_INTERSECTION_THRESH float64
-}
-
-// Placeholder structs and types
-type Bbox struct {
-	// Define bbox properties
-}
-
-type Block struct {
-	Lines []Line
-}
-
-type Line struct {
-	Spans []Span
-	Bbox  Bbox
-}
-
-type Span struct {
-	Bbox       Bbox
-	Text       string
-	Font       string
-	Rotation   int
-	FontWeight int
-	FontSize   int
-	Image      bool
-	SpanID     string
-}
-
-type Page struct {
-	Blocks []Block
-	Images []Image
-	Bbox   Bbox
-	Layout struct {
-		Bboxes []struct {
-			Bbox  Bbox
-			Label string
-		}
-		ImageBbox Bbox
-	}
-}
-
-type Image struct {
-	// Define image properties
-}
-
-type PageObj struct {
-	// Define page object properties
-}
-
-type Doc struct {
-	// Define document properties
-}
-
-// Placeholder functions
-func rescaleBbox(imageBbox, pageBbox, b Bbox) Bbox {
-	// Implement bbox rescaling
-	return Bbox{}
-}
-
-func (l Line) IntersectionPct(region Bbox) float64 {
-	// Implement intersection percentage calculation
-	return 0
-}
-
-func findInsertBlock(blocks []Block, region Bbox) int {
-	// Implement find insert block logic
-	return 0
-}
+	"image"
 
-func renderBboxImage(pageObj PageObj, page Page, bbox Bbox) Image {
-	// Implement image rendering
-	return Image{}
-}
+	"github.com/gen2brain/go-fitz"
 
-func getImageFilename(page Page, imageIdx int) string {
-	// Implement image filename generation
-	return fmt.Sprintf("image_%d.png", imageIdx)
-}
+	"gorker/gorker/geometry"
+	"gorker/gorker/pdf"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
 
-func findImageBlocks(page Page) [][3]interface{} {
+func findImageBlocks(page schema.Page) [][3]interface{} {
 	imageBlocks := [][3]interface{}{}
-	imageRegions := []Bbox{}
+	imageRegions := []geometry.Bbox{}
+	if page.Layout == nil {
+		return imageBlocks
+	}
 
 	for _, l := range page.Layout.Bboxes {
 		if l.Label == "Figure" || l.Label == "Picture" {
@@ -96,7 +27,7 @@ func findImageBlocks(page Page) [][3]interface{} {
 	}
 
 	for i := range imageRegions {
-		imageRegions[i] = rescaleBbox(page.Layout.ImageBbox, page.Bbox, imageRegions[i])
+		imageRegions[i] = geometry.RescaleBbox(page.Layout.ImageBbox, page.Bbox, imageRegions[i])
 	}
 
 	insertPoints := make(map[int][2]int)
@@ -104,8 +35,8 @@ func findImageBlocks(page Page) [][3]interface{} {
 	for regionIdx, region := range imageRegions {
 		for blockIdx, block := range page.Blocks {
 			for lineIdx, line := range block.Lines {
-				if line.IntersectionPct(region) > settings.BBOX_INTERSECTION_THRESH {
-					line.Spans = []Span{} // We will remove this line from the block
+				if line.IntersectionPct(region) > settings.BboxIntersectionThresh {
+					page.Blocks[blockIdx].Lines[lineIdx].Spans = nil // We will remove this line from the block
 					if _, exists := insertPoints[regionIdx]; !exists {
 						insertPoints[regionIdx] = [2]int{blockIdx, lineIdx}
 					}
@@ -117,7 +48,7 @@ func findImageBlocks(page Page) [][3]interface{} {
 	// Account for images with no detected lines
 	for regionIdx, region := range imageRegions {
 		if _, exists := insertPoints[regionIdx]; !exists {
-			insertPoints[regionIdx] = [2]int{findInsertBlock(page.Blocks, region), 0}
+			insertPoints[regionIdx] = [2]int{schema.FindInsertBlock(page.Blocks, region), 0}
 		}
 	}
 
@@ -129,14 +60,15 @@ func findImageBlocks(page Page) [][3]interface{} {
 	return imageBlocks
 }
 
-func extractPageImages(pageObj PageObj, page *Page) {
-	page.Images = []Image{}
+func extractPageImages(doc *fitz.Document, page *schema.Page) error {
+	var errs []error
+	page.Images = []image.Image{}
 	imageBlocks := findImageBlocks(*page)
 
-	for imageIdx, block := range imageBlocks {
+	for _, block := range imageBlocks {
 		blockIdx := block[0].(int)
 		lineIdx := block[1].(int)
-		bbox := block[2].(Bbox)
+		bbox := block[2].(geometry.Bbox)
 
 		if blockIdx >= len(page.Blocks) {
 			blockIdx = len(page.Blocks) - 1
@@ -146,11 +78,15 @@ func extractPageImages(pageObj PageObj, page *Page) {
 		}
 
 		block := &page.Blocks[blockIdx]
-		image := renderBboxImage(pageObj, *page, bbox)
-		imageFilename := getImageFilename(*page, imageIdx)
+		image, err := pdf.RenderBboxImage(doc, *page, bbox, settings.ImageDPI)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rendering image on page %d: %w", page.Pnum, err))
+			continue
+		}
+		imageFilename := getImageFilename(*page, len(page.Images))
 		imageMarkdown := fmt.Sprintf("\n\n![%s](%s)\n\n", imageFilename, imageFilename)
 
-		imageSpan := Span{
+		imageSpan := schema.Span{
 			Bbox:       bbox,
 			Text:       imageMarkdown,
 			Font:       "Image",
@@ -158,33 +94,32 @@ func extractPageImages(pageObj PageObj, page *Page) {
 			FontWeight: 0,
 			FontSize:   0,
 			Image:      true,
-			SpanID:     fmt.Sprintf("image_%d", imageIdx),
+			SpanID:     fmt.Sprintf("image_%d", len(page.Images)),
 		}
 
 		if len(block.Lines) > lineIdx {
 			block.Lines[lineIdx].Spans = append(block.Lines[lineIdx].Spans, imageSpan)
 		} else {
-			line := Line{
+			line := schema.Line{
 				Bbox:  bbox,
-				Spans: []Span{imageSpan},
+				Spans: []schema.Span{imageSpan},
 			}
 			block.Lines = append(block.Lines, line)
 		}
 
 		page.Images = append(page.Images, image)
 	}
+	return errors.Join(errs...)
 }
 
-func extractImages(doc Doc, pages []Page) {
+// ExtractImages replaces the figure regions of every page with images. The
+// returned error joins the failures of images that were left out.
+func ExtractImages(doc *fitz.Document, pages []schema.Page) error {
+	var errs []error
 	for pageIdx := range pages {
-		pageObj := PageObj{} // Assuming we can get the page object from the document
-		extractPageImages(pageObj, &pages[pageIdx])
+		if err := extractPageImages(doc, &pages[pageIdx]); err != nil {
+			errs = append(errs, err)
+		}
 	}
-}
-
-func main() {
-	// Example usage
-	doc := Doc{}
-	pages := []Page{}
-	extractImages(doc, pages)
+	return errors.Join(errs...)
 }
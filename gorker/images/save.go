@@ -1,28 +1,20 @@
-package main
+package images
 
 import (
 	"fmt"
-)
-
-// Page struct to represent the Page type
-type Page struct {
-	Pnum   int
-	Images []Image
-}
+	"image"
 
-// Image struct to represent the Image type
-type Image struct {
-	// Add necessary fields for the Image type
-}
+	"gorker/gorker/schema"
+)
 
 // getImageFilename function
-func getImageFilename(page Page, imageIdx int) string {
+func getImageFilename(page schema.Page, imageIdx int) string {
 	return fmt.Sprintf("%d_image_%d.png", page.Pnum, imageIdx)
 }
 
-// imagesToDict function
-func imagesToDict(pages []Page) map[string]Image {
-	images := make(map[string]Image)
+// ImagesToDict function
+func ImagesToDict(pages []schema.Page) map[string]image.Image {
+	images := make(map[string]image.Image)
 
 	for _, page := range pages {
 		if page.Images == nil {
@@ -37,19 +29,3 @@ func imagesToDict(pages []Page) map[string]Image {
 
 	return images
 }
-
-func main() {
-	// Example usage
-	pages := []Page{
-		{Pnum: 1, Images: []Image{{}, {}}},
-		{Pnum: 2, Images: []Image{{}}},
-		{Pnum: 3, Images: nil},
-	}
-
-	result := imagesToDict(pages)
-
-	// Print the result (just for demonstration)
-	for filename, _ := range result {
-		fmt.Println(filename)
-	}
-}
@@ -0,0 +1,78 @@
+package layout
+
+import (
+	"fmt"
+
+	"github.com/gen2brain/go-fitz"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
+
+// Analyzer finds the labeled regions of a page, such as "Text", "Title",
+// "Section-header", "List-item", "Formula", "Caption" and "Figure". Regions are
+// in the coordinate space of the result's ImageBbox, so an analyzer running a
+// model on page renders can return them as detected.
+type Analyzer interface {
+	Analyze(doc *fitz.Document, page schema.Page) (*schema.LayoutResult, error)
+}
+
+// TableFinder returns the regions of a page holding tables, in the page's
+// coordinate space.
+type TableFinder func(page schema.Page) []geometry.Bbox
+
+// NewAnalyzer creates the analyzer selected by settings.LayoutEngine for the
+// given document pages, or nil if layout analysis is turned off. Analyzers
+// that don't detect tables themselves take them from findTables.
+func NewAnalyzer(pages []schema.Page, findTables TableFinder) (Analyzer, error) {
+	switch settings.LayoutEngine {
+	case "rules":
+		return NewRuleAnalyzer(pages, findTables), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown layout engine %q", settings.LayoutEngine)
+	}
+}
+
+// DetectLayout fills the Layout of every page.
+func DetectLayout(doc *fitz.Document, pages []schema.Page, analyzer Analyzer) error {
+	for i := range pages {
+		result, err := analyzer.Analyze(doc, pages[i])
+		if err != nil {
+			return fmt.Errorf("analyzing layout of page %d: %w", pages[i].Pnum, err)
+		}
+		pages[i].Layout = result
+	}
+	return nil
+}
+
+// AnnotateBlockTypes gives every block the label of the layout region it
+// overlaps most, or "Text" if it overlaps none.
+func AnnotateBlockTypes(pages []schema.Page) {
+	for i := range pages {
+		page := &pages[i]
+		if page.Layout == nil {
+			continue
+		}
+
+		regions := make([]geometry.Bbox, len(page.Layout.Bboxes))
+		for j, box := range page.Layout.Bboxes {
+			regions[j] = geometry.RescaleBbox(page.Layout.ImageBbox, page.Bbox, box.Bbox)
+		}
+
+		for j := range page.Blocks {
+			block := &page.Blocks[j]
+			blockType := "Text"
+			maxIntersection := 0.0
+			for k, region := range regions {
+				if pct := block.IntersectionPct(region); pct > maxIntersection {
+					maxIntersection = pct
+					blockType = page.Layout.Bboxes[k].Label
+				}
+			}
+			block.BlockType = blockType
+		}
+	}
+}
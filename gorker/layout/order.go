@@ -1,122 +1,159 @@
-package main
+package layout
 
 import (
 	"sort"
-)
-
-type Page struct {
-	Layout Layout
-	Blocks []Block
-	Order  Order
-	Bbox   BoundingBox
-}
-
-type Layout struct {
-	Bboxes []LayoutBlock
-}
-
-type LayoutBlock struct {
-	Bbox BoundingBox
-}
 
-type Order struct {
-	Bboxes    []OrderBox
-	ImageBbox BoundingBox
-}
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
 
-type OrderBox struct {
-	Bbox     BoundingBox
-	Position int
-}
+const (
+	// Narrowest gutter, in points, that separates two columns.
+	minColumnGap = 4
+)
 
-type Block struct {
-	Bbox BoundingBox
+type orderItem struct {
+	idx  int
+	bbox geometry.Bbox
 }
 
-type BoundingBox struct {
-	// Define BoundingBox structure
-}
+// DetectOrder fills the Order of every page with the reading order of its
+// layout regions, found by recursively cutting the page along the gaps between
+// them. Pages without layout regions are ordered by their blocks.
+func DetectOrder(pages []schema.Page) {
+	for i := range pages {
+		page := &pages[i]
+		order := &schema.OrderResult{ImageBbox: page.Bbox}
+		var items []orderItem
+		var bboxes []geometry.Bbox
+		if page.Layout != nil && len(page.Layout.Bboxes) > 0 {
+			// Regions are cut in page space, so the column gap is in points
+			order.ImageBbox = page.Layout.ImageBbox
+			for j, box := range page.Layout.Bboxes {
+				items = append(items, orderItem{j, geometry.RescaleBbox(page.Layout.ImageBbox, page.Bbox, box.Bbox)})
+				bboxes = append(bboxes, box.Bbox)
+			}
+		} else {
+			for j, block := range page.Blocks {
+				items = append(items, orderItem{j, block.Bbox})
+				bboxes = append(bboxes, block.Bbox)
+			}
+		}
 
-type Settings struct {
-	OrderBatchSize   *int
-	TorchDeviceModel string
-	SuryaOrderDPI    int
-	OrderMaxBboxes   int
+		for position, item := range xyCut(items) {
+			order.Bboxes = append(order.Bboxes, schema.OrderBox{Bbox: bboxes[item.idx], Position: position})
+		}
+		page.Order = order
+	}
 }
 
-var settings Settings
-
-func getBatchSize() int {
-	if settings.OrderBatchSize != nil {
-		return *settings.OrderBatchSize
-	} else if settings.TorchDeviceModel == "cuda" {
-		return 6
-	} else if settings.TorchDeviceModel == "mps" {
-		return 6
+// xyCut orders boxes by splitting them into columns where a gutter runs
+// through all of them, or else into rows. Rows that carry on the columns of
+// the row above are kept together, so aligned paragraph breaks don't make the
+// order jump between columns, while titles and figures spanning the columns
+// still cut them.
+func xyCut(items []orderItem) []orderItem {
+	if len(items) <= 1 {
+		return items
 	}
-	return 6
-}
 
-func suryaOrder(doc interface{}, pages []Page, orderModel interface{}, batchMultiplier float64) {
-	images := make([]Image, len(pages))
-	for i := range pages {
-		images[i] = renderImage(doc, i, settings.SuryaOrderDPI)
+	if columns := splitItems(items, false, minColumnGap); len(columns) > 1 {
+		var ordered []orderItem
+		for _, column := range columns {
+			ordered = append(ordered, xyCut(column)...)
+		}
+		return ordered
 	}
 
-	bboxes := make([][]BoundingBox, len(pages))
-	for i, page := range pages {
-		bbox := make([]BoundingBox, 0, settings.OrderMaxBboxes)
-		for _, b := range page.Layout.Bboxes {
-			if len(bbox) >= settings.OrderMaxBboxes {
-				break
+	if rows := splitItems(items, true, 0); len(rows) > 1 {
+		groups := [][]orderItem{rows[0]}
+		for _, row := range rows[1:] {
+			last := groups[len(groups)-1]
+			merged := append(append([]orderItem{}, last...), row...)
+			if len(splitItems(last, false, minColumnGap)) > 1 && len(splitItems(merged, false, minColumnGap)) > 1 {
+				groups[len(groups)-1] = merged
+			} else {
+				groups = append(groups, row)
 			}
-			bbox = append(bbox, b.Bbox)
 		}
-		bboxes[i] = bbox
+
+		var ordered []orderItem
+		for _, group := range groups {
+			ordered = append(ordered, xyCut(group)...)
+		}
+		return ordered
 	}
 
-	processor := getProcessor(orderModel)
-	batchSize := int(float64(getBatchSize()) * batchMultiplier)
-	orderResults := batchOrdering(images, bboxes, orderModel, processor, batchSize)
+	// Overlapping boxes can't be cut, read them top to bottom
+	sorted := append([]orderItem{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].bbox, sorted[j].bbox
+		if a.Y0() != b.Y0() {
+			return a.Y0() < b.Y0()
+		}
+		return a.X0() < b.X0()
+	})
+	return sorted
+}
 
-	for i, page := range pages {
-		page.Order = orderResults[i]
+// splitItems splits boxes into runs along the y axis if vertical is set, or
+// else the x axis, wherever there is a gap wider than minGap between them.
+func splitItems(items []orderItem, vertical bool, minGap float64) [][]orderItem {
+	start, end := geometry.Bbox.X0, geometry.Bbox.X1
+	if vertical {
+		start, end = geometry.Bbox.Y0, geometry.Bbox.Y1
 	}
+
+	sorted := append([]orderItem{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return start(sorted[i].bbox) < start(sorted[j].bbox) })
+
+	var groups [][]orderItem
+	var reach float64
+	for _, item := range sorted {
+		if len(groups) == 0 || start(item.bbox) > reach+minGap {
+			groups = append(groups, nil)
+			reach = end(item.bbox)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], item)
+		reach = max(reach, end(item.bbox))
+	}
+	return groups
 }
 
-func sortBlocksInReadingOrder(pages []Page) {
-	for _, page := range pages {
+// SortBlocksInReadingOrder reorders the blocks of every page by the position
+// of the order box they overlap most. Blocks overlapping none take the
+// position of the nearest box, and blocks sharing a position are read column
+// by column, top to bottom.
+func SortBlocksInReadingOrder(pages []schema.Page) {
+	for pnum := range pages {
+		page := &pages[pnum]
 		order := page.Order
-		blockPositions := make(map[int]struct {
-			intersection float64
-			position     int
-		})
-		maxPosition := 0
-
-		for i, block := range page.Blocks {
-			for _, orderBox := range order.Bboxes {
-				orderBbox := orderBox.Bbox
-				position := orderBox.Position
-				orderBbox = rescaleBbox(order.ImageBbox, page.Bbox, orderBbox)
-				blockIntersection := block.IntersectionPct(orderBbox)
-
-				if _, ok := blockPositions[i]; !ok || blockIntersection > blockPositions[i].intersection {
-					blockPositions[i] = struct {
-						intersection float64
-						position     int
-					}{blockIntersection, position}
+		if order == nil {
+			continue
+		}
+
+		orderBboxes := make([]geometry.Bbox, len(order.Bboxes))
+		for i, orderBox := range order.Bboxes {
+			orderBboxes[i] = geometry.RescaleBbox(order.ImageBbox, page.Bbox, orderBox.Bbox)
+		}
+
+		blockGroups := make(map[int][]schema.Block)
+		for _, block := range page.Blocks {
+			best := -1
+			maxIntersection := 0.0
+			for i, orderBbox := range orderBboxes {
+				if pct := block.IntersectionPct(orderBbox); pct > maxIntersection {
+					best = i
+					maxIntersection = pct
 				}
-				maxPosition = max(maxPosition, position)
 			}
-		}
+			if best == -1 {
+				best = geometry.NearestBbox(block.Bbox, orderBboxes)
+			}
 
-		blockGroups := make(map[int][]Block)
-		for i, block := range page.Blocks {
-			position := maxPosition + 1
-			if pos, ok := blockPositions[i]; ok {
-				position = pos.position
-			} else {
-				maxPosition++
+			position := 0
+			if best != -1 {
+				position = order.Bboxes[best].Position
 			}
 			blockGroups[position] = append(blockGroups[position], block)
 		}
@@ -127,7 +164,7 @@ func sortBlocksInReadingOrder(pages []Page) {
 		}
 		sort.Ints(positions)
 
-		var newBlocks []Block
+		var newBlocks []schema.Block
 		for _, position := range positions {
 			blockGroup := sortBlockGroup(blockGroups[position])
 			newBlocks = append(newBlocks, blockGroup...)
@@ -136,38 +173,20 @@ func sortBlocksInReadingOrder(pages []Page) {
 	}
 }
 
-// Helper functions (not implemented, just signatures)
-func renderImage(doc interface{}, pageNum int, dpi int) Image {
-	// Implementation
-}
-
-func getProcessor(orderModel interface{}) interface{} {
-	// Implementation
-}
-
-func batchOrdering(images []Image, bboxes [][]BoundingBox, orderModel interface{}, processor interface{}, batchSize int) []Order {
-	// Implementation
-}
-
-func rescaleBbox(imageBbox, pageBbox, layoutBbox BoundingBox) BoundingBox {
-	// Implementation
-}
-
-func (b Block) IntersectionPct(other BoundingBox) float64 {
-	// Implementation
-}
-
-func sortBlockGroup(blocks []Block) []Block {
-	// Implementation
-}
-
-type Image struct {
-	// Define Image structure
-}
+// sortBlockGroup orders blocks that share a position the same way a page is
+// ordered.
+func sortBlockGroup(blocks []schema.Block) []schema.Block {
+	if len(blocks) <= 1 {
+		return blocks
+	}
+	items := make([]orderItem, len(blocks))
+	for i, block := range blocks {
+		items[i] = orderItem{i, block.Bbox}
+	}
 
-func max(a, b int) int {
-	if a > b {
-		return a
+	sorted := make([]schema.Block, 0, len(blocks))
+	for _, item := range xyCut(items) {
+		sorted = append(sorted, blocks[item.idx])
 	}
-	return b
+	return sorted
 }
@@ -0,0 +1,106 @@
+package layout
+
+import (
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+func orderedNames(page schema.Page, names map[geometry.Bbox]string) []string {
+	var got []string
+	for _, block := range page.Blocks {
+		got = append(got, names[block.Bbox])
+	}
+	return got
+}
+
+func TestSortBlocksInReadingOrder(t *testing.T) {
+	blocks := []struct {
+		name string
+		bbox geometry.Bbox
+	}{
+		{"right", geometry.Bbox{310, 100, 550, 400}},
+		{"orphan", geometry.Bbox{50, 760, 200, 790}},
+		{"left2", geometry.Bbox{50, 420, 290, 750}},
+		{"title", geometry.Bbox{50, 50, 550, 80}},
+		{"left", geometry.Bbox{50, 100, 290, 400}},
+	}
+
+	// Regions are detected on a render at twice the page size
+	layoutResult := &schema.LayoutResult{
+		ImageBbox: geometry.Bbox{0, 0, 1200, 1600},
+		Bboxes: []schema.LayoutBox{
+			{Bbox: geometry.Bbox{620, 200, 1100, 1500}, Label: "Text"},
+			{Bbox: geometry.Bbox{100, 200, 580, 1500}, Label: "Text"},
+			{Bbox: geometry.Bbox{100, 100, 1100, 160}, Label: "Title"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		layout *schema.LayoutResult
+		want   []string
+	}{
+		// The orphan misses every region and is read with the column nearest it
+		{"layout regions", layoutResult, []string{"title", "left", "left2", "orphan", "right"}},
+		{"no layout", nil, []string{"title", "left", "left2", "orphan", "right"}},
+	}
+	for _, tt := range tests {
+		page := schema.Page{Bbox: geometry.Bbox{0, 0, 600, 800}, Layout: tt.layout}
+		names := make(map[geometry.Bbox]string)
+		for _, block := range blocks {
+			page.Blocks = append(page.Blocks, schema.Block{Bbox: block.bbox})
+			names[block.bbox] = block.name
+		}
+
+		pages := []schema.Page{page}
+		DetectOrder(pages)
+		SortBlocksInReadingOrder(pages)
+
+		got := orderedNames(pages[0], names)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDetectOrderUsesLayoutRegions(t *testing.T) {
+	page := schema.Page{
+		Bbox:   geometry.Bbox{0, 0, 600, 800},
+		Blocks: []schema.Block{{Bbox: geometry.Bbox{50, 100, 290, 400}}},
+		Layout: &schema.LayoutResult{
+			ImageBbox: geometry.Bbox{0, 0, 1200, 1600},
+			Bboxes: []schema.LayoutBox{
+				{Bbox: geometry.Bbox{620, 200, 1100, 1500}},
+				{Bbox: geometry.Bbox{100, 200, 580, 1500}},
+			},
+		},
+	}
+	pages := []schema.Page{page}
+	DetectOrder(pages)
+
+	order := pages[0].Order
+	if order.ImageBbox != page.Layout.ImageBbox {
+		t.Errorf("order image bbox = %v, want the layout's %v", order.ImageBbox, page.Layout.ImageBbox)
+	}
+	want := []schema.OrderBox{
+		{Bbox: geometry.Bbox{100, 200, 580, 1500}, Position: 0},
+		{Bbox: geometry.Bbox{620, 200, 1100, 1500}, Position: 1},
+	}
+	if len(order.Bboxes) != len(want) {
+		t.Fatalf("order boxes = %v, want %v", order.Bboxes, want)
+	}
+	for i := range want {
+		if order.Bboxes[i] != want[i] {
+			t.Errorf("order box %d = %v, want %v", i, order.Bboxes[i], want[i])
+		}
+	}
+}
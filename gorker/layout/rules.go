@@ -0,0 +1,417 @@
+package layout
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gen2brain/go-fitz"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+const (
+	// Font size ratios to the body text for titles, headings and footnotes.
+	titleSizeRatio    = 1.5
+	headingSizeRatio  = 1.15
+	footnoteSizeRatio = 0.85
+	// Longest line, in characters, that can still be a heading.
+	maxHeadingChars = 150
+	maxHeadingLines = 3
+	// Share of the page height at the top and bottom holding running heads
+	// and page numbers.
+	marginBand = 0.1
+	// Share of a block's characters set in math fonts or written as math
+	// symbols for it to be a formula.
+	mathFontShare   = 0.4
+	mathSymbolShare = 0.25
+	// Smallest picture or figure, in points, and the gap that still joins
+	// paths into one figure.
+	minFigureSide = 24
+	figureJoinGap = 4
+	// Share of a figure that can be covered by text before it reads as a
+	// framed text box instead.
+	maxFigureTextShare = 0.5
+)
+
+var (
+	captionRe = regexp.MustCompile(`^\s*(Figure|FIGURE|Fig\.|FIG\.|Table|TABLE|Tab\.|Algorithm|Listing)\s*[\dIVX]+`)
+	// Dashes also start dialogue and attributions, and a capital letter
+	// and a dot is more often an initial than an item
+	listItemRe = regexp.MustCompile(`^\s*([-*+•●○■□▪▫◦‣]|\(?\d{1,3}[.)]|\(?[a-z][.)]|\(?[A-Z]\)|\(?[ivx]{1,4}[.)])(\s|$)`)
+	footnoteRe = regexp.MustCompile(`^\s*(\d{1,2}|[*†‡§¶])`)
+)
+
+// mathFonts are name fragments of fonts used to typeset math.
+var mathFonts = []string{"cmmi", "cmsy", "cmex", "msam", "msbm", "eufm", "rsfs", "esint", "symbol", "math", "mtmi", "mtsy", "stix", "tex-"}
+
+// RuleAnalyzer labels regions from the embedded text and drawings of a page,
+// using font sizes measured over the whole document. It needs no model and
+// works on a CPU.
+type RuleAnalyzer struct {
+	bodyFontSize float64
+	maxFontSize  float64
+	findTables   TableFinder
+}
+
+// NewRuleAnalyzer measures the fonts of the document pages. Tables are
+// labeled where findTables finds them, if it isn't nil.
+func NewRuleAnalyzer(pages []schema.Page, findTables TableFinder) *RuleAnalyzer {
+	// The body size is the size most characters are set in
+	charsBySize := make(map[float64]int)
+	maxSize := 0.0
+	for _, page := range pages {
+		for _, span := range page.NonblankSpans() {
+			size := math.Round(span.FontSize*2) / 2
+			charsBySize[size] += len([]rune(span.Text))
+			maxSize = math.Max(maxSize, span.FontSize)
+		}
+	}
+	bodySize := 0.0
+	for size, chars := range charsBySize {
+		if chars > charsBySize[bodySize] || (chars == charsBySize[bodySize] && size < bodySize) {
+			bodySize = size
+		}
+	}
+	return &RuleAnalyzer{bodyFontSize: bodySize, maxFontSize: maxSize, findTables: findTables}
+}
+
+func (a *RuleAnalyzer) Analyze(doc *fitz.Document, page schema.Page) (*schema.LayoutResult, error) {
+	result := &schema.LayoutResult{ImageBbox: page.Bbox}
+	figures := findFigures(page, page.Drawings)
+	result.Bboxes = append(result.Bboxes, figures...)
+
+	// Labels on charts can line up like table cells
+	var tableBboxes []geometry.Bbox
+	if a.findTables != nil {
+		tableBboxes = a.findTables(page)
+	}
+	var tableRegions []schema.LayoutBox
+	for _, bbox := range tableBboxes {
+		if !insideRegion(schema.Block{Bbox: bbox}, figures, 0.5) {
+			tableRegions = append(tableRegions, schema.LayoutBox{Bbox: bbox, Label: "Table", Confidence: 1})
+		}
+	}
+	result.Bboxes = append(result.Bboxes, tableRegions...)
+
+	for _, block := range page.Blocks {
+		if len(block.Lines) == 0 || insideRegion(block, figures, 0.9) || insideRegion(block, tableRegions, 0.9) {
+			continue
+		}
+		result.Bboxes = append(result.Bboxes, a.labelBlock(page, block)...)
+	}
+	return result, nil
+}
+
+// labelBlock returns the regions of one text block. A block starting with
+// heading lines is split into the heading and the rest.
+func (a *RuleAnalyzer) labelBlock(page schema.Page, block schema.Block) []schema.LayoutBox {
+	text := block.PrelimText()
+	region := func(lines []schema.Line, label string) schema.LayoutBox {
+		return schema.LayoutBox{Bbox: schema.BboxFromLines(lines), Label: label, Confidence: 1}
+	}
+
+	switch {
+	case isFormula(block):
+		return []schema.LayoutBox{region(block.Lines, "Formula")}
+	case captionRe.MatchString(text):
+		return []schema.LayoutBox{region(block.Lines, "Caption")}
+	}
+
+	if label := a.marginLabel(page, block); label != "" {
+		return []schema.LayoutBox{region(block.Lines, label)}
+	}
+
+	headingLines := 0
+	for headingLines < len(block.Lines) && headingLines < maxHeadingLines && a.isHeadingLine(block.Lines[headingLines]) {
+		headingLines++
+	}
+	// A long block of large text is a pull quote or a slide, not a heading
+	if headingLines == maxHeadingLines && len(block.Lines) > maxHeadingLines && a.isHeadingLine(block.Lines[maxHeadingLines]) {
+		headingLines = 0
+	}
+
+	var regions []schema.LayoutBox
+	if headingLines > 0 {
+		label := "Section-header"
+		if a.isTitle(block.Lines[:headingLines]) {
+			label = "Title"
+		}
+		regions = append(regions, region(block.Lines[:headingLines], label))
+	}
+	if body := block.Lines[headingLines:]; len(body) > 0 {
+		regions = append(regions, region(body, a.bodyLabel(page, body)))
+	}
+	return regions
+}
+
+// marginLabel tells whether a block is a running head or foot: short body
+// size text in the top or bottom band of the page with no other text beyond
+// it.
+func (a *RuleAnalyzer) marginLabel(page schema.Page, block schema.Block) string {
+	if len(block.Lines) > 2 || blockFontSize(block) > a.bodyFontSize*1.05 {
+		return ""
+	}
+	band := page.Bbox.Height() * marginBand
+	above, below := false, false
+	for _, other := range page.Blocks {
+		above = above || other.Bbox.Y1() <= block.Bbox.Y0()
+		below = below || other.Bbox.Y0() >= block.Bbox.Y1()
+	}
+	switch {
+	case !above && block.Bbox.Y1() <= page.Bbox.Y0()+band:
+		return "Page-header"
+	case !below && block.Bbox.Y0() >= page.Bbox.Y1()-band:
+		return "Page-footer"
+	}
+	return ""
+}
+
+func (a *RuleAnalyzer) bodyLabel(page schema.Page, lines []schema.Line) string {
+	text := lines[0].PrelimText()
+	if listItemRe.MatchString(text) {
+		return "List-item"
+	}
+	bbox := schema.BboxFromLines(lines)
+	small := blockFontSize(schema.Block{Lines: lines}) <= a.bodyFontSize*footnoteSizeRatio
+	if small && bbox.Y0() >= page.Bbox.Y0()+page.Bbox.Height()*0.7 && footnoteRe.MatchString(text) {
+		return "Footnote"
+	}
+	return "Text"
+}
+
+func (a *RuleAnalyzer) isHeadingLine(line schema.Line) bool {
+	text := strings.TrimSpace(line.PrelimText())
+	if text == "" || len([]rune(text)) > maxHeadingChars || !strings.ContainsFunc(text, isAlnum) {
+		return false
+	}
+	size := lineFontSize(line)
+	if a.bodyFontSize == 0 {
+		return false
+	}
+	if size >= a.bodyFontSize*headingSizeRatio {
+		return true
+	}
+
+	// Bold lines at body size are headings unless they read as a sentence
+	for _, span := range line.Spans {
+		if strings.TrimSpace(span.Text) != "" && !span.Bold && !strings.Contains(strings.ToLower(span.Font), "bold") {
+			return false
+		}
+	}
+	return size >= a.bodyFontSize*0.95 && !strings.HasSuffix(text, ".") && !strings.HasSuffix(text, ",")
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (a *RuleAnalyzer) isTitle(lines []schema.Line) bool {
+	size := blockFontSize(schema.Block{Lines: lines})
+	return size >= a.bodyFontSize*titleSizeRatio && size >= a.maxFontSize-0.5
+}
+
+// isFormula reports whether a block is display math: mostly set in math
+// fonts or made of math symbols rather than words.
+func isFormula(block schema.Block) bool {
+	chars, mathChars, symbols, wordChars := 0, 0, 0, 0
+	for _, line := range block.Lines {
+		for _, span := range line.Spans {
+			mathFont := isMathFont(span.Font)
+			for _, word := range strings.Fields(span.Text) {
+				letters := 0
+				for _, r := range word {
+					chars++
+					if mathFont {
+						mathChars++
+					}
+					if unicode.Is(unicode.Sm, r) || unicode.Is(unicode.Greek, r) {
+						symbols++
+					}
+					if unicode.IsLetter(r) {
+						letters++
+					}
+				}
+				// Words of ordinary text, rather than variable names
+				if letters >= 4 && !mathFont {
+					wordChars += letters
+				}
+			}
+		}
+	}
+	if chars == 0 || float64(wordChars) > float64(chars)*0.3 {
+		return false
+	}
+	return float64(mathChars) >= float64(chars)*mathFontShare || float64(symbols) >= float64(chars)*mathSymbolShare
+}
+
+func isMathFont(font string) bool {
+	lower := strings.ToLower(font)
+	for _, name := range mathFonts {
+		if strings.Contains(lower, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// findFigures returns the images and the clusters of vector paths on a page
+// that aren't ruled tables or framed text.
+func findFigures(page schema.Page, drawings []schema.Drawing) []schema.LayoutBox {
+	pageArea := page.Bbox.Area()
+	var figures []schema.LayoutBox
+	var paths []schema.Drawing
+	for _, drawing := range drawings {
+		bbox := drawing.Bbox.Intersection(page.Bbox)
+		switch {
+		case bbox.Width() == 0 && bbox.Height() == 0:
+			// Off the page
+		case drawing.Image:
+			if bbox.Width() >= minFigureSide && bbox.Height() >= minFigureSide && bbox.Area() < pageArea*0.95 {
+				figures = append(figures, schema.LayoutBox{Bbox: bbox, Label: "Picture", Confidence: 1})
+			}
+		case bbox.Area() < pageArea*0.5:
+			// Page backgrounds and frames aren't figures
+			drawing.Bbox = bbox
+			paths = append(paths, drawing)
+		}
+	}
+
+	for _, cluster := range clusterDrawings(paths) {
+		bbox := cluster[0].Bbox
+		for _, d := range cluster[1:] {
+			bbox = bbox.Union(d.Bbox)
+		}
+		if bbox.Width() < minFigureSide || bbox.Height() < minFigureSide {
+			continue
+		}
+
+		// Only rules around text are a table, leave those to the table step
+		allRules := true
+		for _, d := range cluster {
+			allRules = allRules && isRule(d)
+		}
+		textArea := 0.0
+		for _, line := range page.NonblankLines() {
+			if line.IntersectionPct(bbox) > 0.5 {
+				textArea += line.Bbox.Area()
+			}
+		}
+		if (allRules && textArea > 0) || textArea > bbox.Area()*maxFigureTextShare {
+			continue
+		}
+
+		// Pictures with vector labels on top are one figure
+		merged := false
+		for i := range figures {
+			if figures[i].Bbox.IntersectionPct(bbox) > 0 || bbox.IntersectionPct(figures[i].Bbox) > 0 {
+				figures[i].Bbox = figures[i].Bbox.Union(bbox)
+				figures[i].Label = "Figure"
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			figures = append(figures, schema.LayoutBox{Bbox: bbox, Label: "Figure", Confidence: 1})
+		}
+	}
+
+	sort.Slice(figures, func(i, j int) bool { return figures[i].Bbox.Y0() < figures[j].Bbox.Y0() })
+	return figures
+}
+
+// isRule reports whether a path only draws horizontal and vertical lines, or
+// is a thin filled bar, which is how tables and underlines are ruled.
+func isRule(drawing schema.Drawing) bool {
+	if drawing.Image {
+		return false
+	}
+	if drawing.Fill && (drawing.Bbox.Width() <= 2 || drawing.Bbox.Height() <= 2) {
+		return true
+	}
+	for _, s := range drawing.Segments {
+		if !s.Horizontal(0.5) && !s.Vertical(0.5) {
+			return false
+		}
+	}
+	return drawing.Stroke
+}
+
+// clusterDrawings groups paths that touch or nearly touch.
+func clusterDrawings(drawings []schema.Drawing) [][]schema.Drawing {
+	parent := make([]int, len(drawings))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// Sorting by top edge lets the scan stop once boxes are too far below
+	order := make([]int, len(drawings))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return drawings[order[i]].Bbox.Y0() < drawings[order[j]].Bbox.Y0() })
+	for oi, i := range order {
+		for _, j := range order[oi+1:] {
+			if drawings[j].Bbox.Y0() > drawings[i].Bbox.Y1()+figureJoinGap {
+				break
+			}
+			if drawings[i].Bbox.Distance(drawings[j].Bbox) <= figureJoinGap {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	groups := make(map[int][]schema.Drawing)
+	var roots []int
+	for _, i := range order {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], drawings[i])
+	}
+	clusters := make([][]schema.Drawing, 0, len(roots))
+	for _, root := range roots {
+		clusters = append(clusters, groups[root])
+	}
+	return clusters
+}
+
+// insideRegion reports whether more than thresh of a block lies in one of
+// the regions.
+func insideRegion(block schema.Block, regions []schema.LayoutBox, thresh float64) bool {
+	for _, region := range regions {
+		if block.IntersectionPct(region.Bbox) > thresh {
+			return true
+		}
+	}
+	return false
+}
+
+func lineFontSize(line schema.Line) float64 {
+	size := 0.0
+	for _, span := range line.Spans {
+		if strings.TrimSpace(span.Text) != "" {
+			size = math.Max(size, span.FontSize)
+		}
+	}
+	return size
+}
+
+func blockFontSize(block schema.Block) float64 {
+	size := 0.0
+	for _, line := range block.Lines {
+		size = math.Max(size, lineFontSize(line))
+	}
+	return size
+}
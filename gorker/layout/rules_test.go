@@ -0,0 +1,161 @@
+package layout
+
+import (
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+func TestListItemRe(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"• First point", true},
+		{"- First point", true},
+		{"* First point", true},
+		{"1. First point", true},
+		{"(12) First point", true},
+		{"a) First point", true},
+		{"(b) First point", true},
+		{"A) First point", true},
+		{"iv. First point", true},
+		{"•", true},
+
+		{"— said the author", false},
+		{"– an aside in the text", false},
+		{"A. Smith and B. Jones", false},
+		{"J. R. R. Tolkien", false},
+		{"1999 was a year", false},
+		{"Introduction", false},
+		{"-5 degrees", false},
+	}
+	for _, tt := range tests {
+		if got := listItemRe.MatchString(tt.text); got != tt.want {
+			t.Errorf("listItemRe.MatchString(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// sizedLine returns a line at height y set in font at size, about as wide
+// as its text.
+func sizedLine(text string, y, size float64, font string) schema.Line {
+	bbox := geometry.Bbox{72, y, 72 + size/2*float64(len([]rune(text))), y + size}
+	return schema.Line{
+		Spans: []schema.Span{{Text: text, Bbox: bbox, Font: font, FontSize: size}},
+		Bbox:  bbox,
+	}
+}
+
+func TestRuleAnalyzerAnalyze(t *testing.T) {
+	body := func(text string, y float64) schema.Line { return sizedLine(text, y, 10, "Times") }
+	lines := map[string]schema.Line{
+		"title":   sizedLine("A Study of Rules", 50, 24, "Times"),
+		"para1":   body("Rules label the regions of a page from the fonts of its text", 100),
+		"para2":   body("and the paths drawn on it, which is enough for most papers.", 112),
+		"heading": sizedLine("Methods", 150, 10, "Times-Bold"),
+		"after":   body("We measured the body text of the whole document first.", 162),
+		"item":    body("• The first point of a list", 200),
+		"dash":    body("— said the author of the study", 220),
+		"initial": body("A. Smith and B. Jones wrote this part of it.", 240),
+		"caption": body("Figure 1: The regions of a page", 300),
+		"cells":   body("Size Count Share", 400),
+		"footer":  body("12", 780),
+	}
+	block := func(names ...string) schema.Block {
+		var blockLines []schema.Line
+		for _, name := range names {
+			blockLines = append(blockLines, lines[name])
+		}
+		return schema.Block{Lines: blockLines, Bbox: schema.BboxFromLines(blockLines)}
+	}
+	page := schema.Page{
+		Bbox: geometry.Bbox{0, 0, 600, 800},
+		Blocks: []schema.Block{
+			block("title"), block("para1", "para2"), block("heading", "after"), block("item"),
+			block("dash"), block("initial"), block("caption"), block("cells"), block("footer"),
+		},
+	}
+	table := geometry.Bbox{70, 395, 300, 415}
+
+	region := func(label string, names ...string) schema.LayoutBox {
+		return schema.LayoutBox{Bbox: block(names...).Bbox, Label: label, Confidence: 1}
+	}
+	tests := []struct {
+		name       string
+		findTables TableFinder
+		want       []schema.LayoutBox
+	}{
+		{
+			name:       "tables found by the caller",
+			findTables: func(schema.Page) []geometry.Bbox { return []geometry.Bbox{table} },
+			want: []schema.LayoutBox{
+				{Bbox: table, Label: "Table", Confidence: 1},
+				region("Title", "title"),
+				region("Text", "para1", "para2"),
+				region("Section-header", "heading"),
+				region("Text", "after"),
+				region("List-item", "item"),
+				region("Text", "dash"),
+				region("Text", "initial"),
+				region("Caption", "caption"),
+				region("Page-footer", "footer"),
+			},
+		},
+		{
+			name: "no table finder",
+			want: []schema.LayoutBox{
+				region("Title", "title"),
+				region("Text", "para1", "para2"),
+				region("Section-header", "heading"),
+				region("Text", "after"),
+				region("List-item", "item"),
+				region("Text", "dash"),
+				region("Text", "initial"),
+				region("Caption", "caption"),
+				region("Text", "cells"),
+				region("Page-footer", "footer"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		analyzer := NewRuleAnalyzer([]schema.Page{page}, tt.findTables)
+		result, err := analyzer.Analyze(nil, page)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if result.ImageBbox != page.Bbox {
+			t.Errorf("%s: image bbox = %v, want the page's %v", tt.name, result.ImageBbox, page.Bbox)
+		}
+		if len(result.Bboxes) != len(tt.want) {
+			t.Errorf("%s: got regions %v, want %v", tt.name, result.Bboxes, tt.want)
+			continue
+		}
+		for i, want := range tt.want {
+			if result.Bboxes[i] != want {
+				t.Errorf("%s: region %d = %v, want %v", tt.name, i, result.Bboxes[i], want)
+			}
+		}
+	}
+}
+
+func TestIsFormula(t *testing.T) {
+	tests := []struct {
+		name  string
+		spans []schema.Span
+		want  bool
+	}{
+		{"math font", []schema.Span{{Text: "x + y = z", Font: "CMMI10"}}, true},
+		{"math symbols", []schema.Span{{Text: "α ≤ β + γ", Font: "Times"}}, true},
+		{"prose", []schema.Span{{Text: "The value of x is small", Font: "Times"}}, false},
+		{"prose with a symbol", []schema.Span{{Text: "Values ≤ 5 are rejected", Font: "Times"}}, false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		block := schema.Block{Lines: []schema.Line{{Spans: tt.spans}}}
+		if got := isFormula(block); got != tt.want {
+			t.Errorf("%s: isFormula = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package markdown
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gorker/gorker/cleaners"
+	"gorker/gorker/schema"
+)
+
+var (
+	escapeRe = regexp.MustCompile(`([#])`)
+
+	// Should cover latin-derived languages and russian. The line end patterns
+	// only look at the tail of the text joined so far.
+	hyphenEndRe   = regexp.MustCompile(`[\p{Lo}\p{Ll}\d][-—¬]\s?$`)
+	hyphenSplitRe = regexp.MustCompile(`[-—¬]\s?$`)
+	lowerStartRe  = regexp.MustCompile(`^\s?[\p{Lo}\p{Ll}\d]`)
+	lineEndRe     = regexp.MustCompile(`[\p{Lo}\p{Ll}\d][,;(—"'*]?\s?$`)
+	lineStartRe   = regexp.MustCompile(`^\s?[\p{L}\d]`)
+	sentenceEndRe = regexp.MustCompile(`[。ๆ.?!]\s?$`)
+)
+
+var textBlockTypes = map[string]bool{
+	"Text":      true,
+	"List-item": true,
+	"Footnote":  true,
+	"Caption":   true,
+	"Figure":    true,
+}
+
+// Render turns the block tree of a document into markdown. It also returns
+// the repeated headings it left out.
+func Render(pages []schema.Page) (string, []cleaners.DroppedTitle) {
+	mergedBlocks := MergeSpans(pages)
+	textBlocks := MergeLines(mergedBlocks)
+	textBlocks, droppedTitles := cleaners.FilterCommonTitles(textBlocks)
+	fullText := GetFullText(textBlocks)
+
+	// Handle empty blocks being joined
+	return cleaners.CleanupText(fullText), droppedTitles
+}
+
+func escapeMarkdown(text string) string {
+	return escapeRe.ReplaceAllString(text, `\$1`)
+}
+
+// surroundText wraps the non-whitespace part of s in marker, keeping the
+// surrounding whitespace outside.
+func surroundText(s, marker string) string {
+	stripped := strings.TrimSpace(s)
+	if stripped == "" {
+		return s
+	}
+	start := strings.Index(s, stripped)
+	return s[:start] + marker + stripped + marker + s[start+len(stripped):]
+}
+
+// MergeSpans joins the spans of every line into text, adding emphasis
+// markers for bold and italic runs.
+func MergeSpans(pages []schema.Page) [][]schema.MergedBlock {
+	var mergedBlocks [][]schema.MergedBlock
+	for _, page := range pages {
+		var pageBlocks []schema.MergedBlock
+		for _, block := range page.Blocks {
+			var blockLines []schema.MergedLine
+			for _, line := range block.Lines {
+				if len(line.Spans) == 0 {
+					continue
+				}
+
+				var lineText strings.Builder
+				var fonts []string
+				for i, span := range line.Spans {
+					// Look ahead to the next span with some text in it
+					var nextSpan *schema.Span
+					for j := i + 1; j < len(line.Spans); j++ {
+						nextSpan = &line.Spans[j]
+						if len(strings.TrimSpace(nextSpan.Text)) > 2 {
+							break
+						}
+					}
+
+					fonts = append(fonts, strings.ToLower(span.Font))
+					spanText := span.Text
+					// Dollar signs in text would read as inline math
+					if textBlockTypes[block.BlockType] && span.Font != "Latex" {
+						spanText = strings.ReplaceAll(spanText, "$", `\$`)
+					}
+
+					// Don't bold or italicize very short sequences
+					// Avoid bolding first and last sequence so lines can be joined properly
+					if len(spanText) > 3 && i > 0 && i < len(line.Spans)-1 {
+						if span.Italic && (nextSpan == nil || !nextSpan.Italic) {
+							spanText = surroundText(spanText, "*")
+						} else if span.Bold && (nextSpan == nil || !nextSpan.Bold) {
+							spanText = surroundText(spanText, "**")
+						}
+					}
+					lineText.WriteString(spanText)
+				}
+
+				blockLines = append(blockLines, schema.MergedLine{
+					Text:  lineText.String(),
+					Fonts: fonts,
+					Bbox:  line.Bbox,
+				})
+			}
+
+			if len(blockLines) > 0 {
+				pageBlocks = append(pageBlocks, schema.MergedBlock{
+					Lines:        blockLines,
+					Pnum:         block.Pnum,
+					BlockType:    block.BlockType,
+					Bbox:         block.Bbox,
+					HeadingLevel: block.HeadingLevel,
+				})
+			}
+		}
+		mergedBlocks = append(mergedBlocks, pageBlocks)
+	}
+	return mergedBlocks
+}
+
+// titleCase upper-cases the first letter of every word and lower-cases the
+// rest.
+func titleCase(s string) string {
+	runes := []rune(s)
+	wordStart := true
+	for i, r := range runes {
+		if unicode.IsLetter(r) {
+			if wordStart {
+				runes[i] = unicode.ToUpper(r)
+			} else {
+				runes[i] = unicode.ToLower(r)
+			}
+			wordStart = false
+		} else {
+			wordStart = unicode.IsSpace(r) || r == '-'
+		}
+	}
+	return string(runes)
+}
+
+// blockSurround wraps the text of a run of blocks in the markdown for their
+// type. Headings without a level fall back to 1 for titles and 2 for
+// section headers.
+func blockSurround(text, blockType string, headingLevel int) string {
+	switch blockType {
+	case "Section-header":
+		if headingLevel == 0 {
+			headingLevel = 2
+		}
+		if !strings.HasPrefix(text, "#") {
+			text = "\n" + strings.Repeat("#", headingLevel) + " " + titleCase(strings.TrimSpace(text)) + "\n"
+		}
+	case "Title":
+		if headingLevel == 0 {
+			headingLevel = 1
+		}
+		if !strings.HasPrefix(text, "#") {
+			text = strings.Repeat("#", headingLevel) + " " + titleCase(strings.TrimSpace(text)) + "\n"
+		}
+	case "Table":
+		text = "\n" + text + "\n"
+	case "List-item":
+		text = escapeMarkdown(text)
+	case "Code":
+		text = "\n```\n" + strings.TrimRight(text, "\n") + "\n```\n"
+	case "Text":
+		text = escapeMarkdown(text)
+	case "Formula":
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "$$") && strings.HasSuffix(trimmed, "$$") {
+			text = "\n" + trimmed + "\n"
+		}
+	}
+	return text
+}
+
+// tail returns the last few characters of s, which is all the line end
+// patterns need.
+func tail(s []byte) []byte {
+	const tailLen = 16
+	if len(s) <= tailLen {
+		return s
+	}
+	start := len(s) - tailLen
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
+
+// appendLine joins line onto the block text so far, removing line break
+// hyphens and deciding whether the break is a space, a newline or a new
+// paragraph.
+func appendLine(text []byte, line, blockType string, isContinuation bool) []byte {
+	// Lists are already split into one line per item
+	if blockType == "List-item" {
+		return append(append(text, '\n'), line...)
+	}
+
+	textTail := tail(text)
+
+	// Remove hyphen in current line if next line and current line appear to be joined
+	if hyphenEndRe.Match(textTail) && lowerStartRe.MatchString(line) {
+		loc := hyphenSplitRe.FindIndex(textTail)
+		text = text[:len(text)-len(textTail)+loc[0]]
+		return append(bytes.TrimRight(text, " \t\n"), strings.TrimLeft(line, " \t\n")...)
+	}
+
+	var joinWithSpace bool
+	sep := "\n"
+	switch {
+	case blockType == "Title" || blockType == "Section-header":
+		joinWithSpace = true
+	case blockType == "Formula":
+	case lineEndRe.Match(textTail) && lineStartRe.MatchString(line) && textBlockTypes[blockType]:
+		joinWithSpace = true
+	case isContinuation:
+		joinWithSpace = true
+	case textBlockTypes[blockType] && sentenceEndRe.Match(textTail):
+		sep = "\n\n"
+	case blockType == "Table":
+		sep = "\n\n"
+	}
+
+	if joinWithSpace {
+		text = append(bytes.TrimRight(text, " \t\n"), ' ')
+		return append(text, strings.TrimLeft(line, " \t\n")...)
+	}
+	text = append(text, sep...)
+	return append(text, line...)
+}
+
+func blockSeparator(prevBlock, block schema.FullyMergedBlock) string {
+	sep := "\n"
+	if prevBlock.BlockType == "Text" || prevBlock.BlockType == "List-item" {
+		sep = "\n\n"
+	}
+	return sep + block.Text
+}
+
+// MergeLines joins the lines of consecutive blocks of the same type into
+// paragraphs and wraps each run in the markdown for its block type.
+func MergeLines(blocks [][]schema.MergedBlock) []schema.FullyMergedBlock {
+	var textBlocks []schema.FullyMergedBlock
+	var prevType string
+	var prevLevel int
+	var prevLine *schema.MergedLine
+	var blockText []byte
+
+	for _, page := range blocks {
+		for _, block := range page {
+			// Headings of different levels stay apart
+			if (block.BlockType != prevType || block.HeadingLevel != prevLevel) && prevType != "" {
+				textBlocks = append(textBlocks, schema.FullyMergedBlock{
+					Text:      blockSurround(string(blockText), prevType, prevLevel),
+					BlockType: prevType,
+				})
+				blockText = blockText[:0]
+			}
+			prevType, prevLevel = block.BlockType, block.HeadingLevel
+
+			// Join lines in the block together properly
+			for i := range block.Lines {
+				line := &block.Lines[i]
+				lineHeight := line.Bbox.Height()
+				prevLineHeight, prevLineX := 0.0, 0.0
+				if prevLine != nil {
+					prevLineHeight = prevLine.Bbox.Height()
+					prevLineX = prevLine.Bbox.X0()
+				}
+				prevLine = line
+				// A new block starts a new paragraph unless the text runs on. Glyph
+				// boxes differ by rounding and side bearings from line to line
+				tolerance := lineHeight * 0.1
+				isContinuation := i > 0 && math.Abs(lineHeight-prevLineHeight) <= tolerance && math.Abs(line.Bbox.X0()-prevLineX) <= tolerance
+
+				if len(blockText) > 0 {
+					blockText = appendLine(blockText, line.Text, block.BlockType, isContinuation)
+				} else {
+					blockText = append(blockText, line.Text...)
+				}
+			}
+		}
+	}
+
+	// Append the final block
+	if prevType != "" {
+		textBlocks = append(textBlocks, schema.FullyMergedBlock{
+			Text:      blockSurround(string(blockText), prevType, prevLevel),
+			BlockType: prevType,
+		})
+	}
+	return textBlocks
+}
+
+// GetFullText joins rendered blocks into the document text.
+func GetFullText(textBlocks []schema.FullyMergedBlock) string {
+	var fullText strings.Builder
+	for i, block := range textBlocks {
+		if i > 0 {
+			fullText.WriteString(blockSeparator(textBlocks[i-1], block))
+		} else {
+			fullText.WriteString(block.Text)
+		}
+	}
+	return fullText.String()
+}
@@ -1,83 +1,47 @@
-package main
+package ocr
 
 import (
-	"image"
-	"math"
-	"strings"
+	"context"
+	"errors"
+	"fmt"
 
 	"github.com/gen2brain/go-fitz"
-	"github.com/otiai10/gosseract/v2"
-)
-
-type Page struct {
-	TextLines []string
-}
-
-type Settings struct {
-	DetectorBatchSize *int
-	TorchDeviceModel  string
-	SuryaDetectorDPI  float64
-}
-
-var settings Settings
 
-func getBatchSize() int {
-	if settings.DetectorBatchSize != nil {
-		return *settings.DetectorBatchSize
-	} else if settings.TorchDeviceModel == "cuda" {
-		return 4
-	}
-	return 4
-}
-
-func renderImage(doc *fitz.Document, pageNum int, dpi float64) (image.Image, error) {
-	return doc.Image(pageNum, dpi, dpi, 0)
-}
-
-func batchTextDetection(images []image.Image, client *gosseract.Client, batchSize int) ([][]string, error) {
-	var predictions [][]string
-	for i := 0; i < len(images); i += batchSize {
-		end := int(math.Min(float64(i+batchSize), float64(len(images))))
-		batch := images[i:end]
+	"gorker/gorker/pdf"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
 
-		for _, img := range batch {
-			client.SetImageFromBytes(img.Pix)
-			text, err := client.Text()
-			if err != nil {
-				return nil, err
-			}
-			predictions = append(predictions, strings.Split(text, "\n"))
+// DetectTextLines finds the text lines on every page, so the OCR step can
+// tell which of them the embedded text misses. Pages are rendered one at a
+// time, so only one page image is held at once. A page that fails is left
+// without text lines and the rest are still detected; the returned error
+// joins the failures.
+func DetectTextLines(ctx context.Context, doc *fitz.Document, pages []schema.Page, engine OCREngine) error {
+	var errs []error
+	for i := range pages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := detectPageTextLines(doc, &pages[i], engine); err != nil {
+			errs = append(errs, fmt.Errorf("detecting text lines on page %d: %w", pages[i].Pnum, err))
 		}
 	}
-	return predictions, nil
+	return errors.Join(errs...)
 }
 
-func suryaDetection(doc *fitz.Document, pages []Page, client *gosseract.Client, batchMultiplier float64) error {
-	maxLen := int(math.Min(float64(len(pages)), float64(doc.NumPage())))
-	var images []image.Image
-
-	for i := 0; i < maxLen; i++ {
-		img, err := renderImage(doc, i, settings.SuryaDetectorDPI)
-		if err != nil {
-			return err
-		}
-		images = append(images, img)
+func detectPageTextLines(doc *fitz.Document, page *schema.Page, engine OCREngine) error {
+	img, err := pdf.RenderImage(doc, page.Pnum, settings.SuryaDetectorDPI)
+	if err != nil {
+		return err
 	}
-
-	batchSize := int(float64(getBatchSize()) * batchMultiplier)
-	predictions, err := batchTextDetection(images, client, batchSize)
+	lines, err := engine.DetectLines(img, settings.SuryaDetectorDPI)
 	if err != nil {
 		return err
 	}
-
-	for i, pred := range predictions {
-		pages[i].TextLines = pred
+	page.TextLines = &schema.TextDetectionResult{
+		Bboxes:    lines,
+		ImageBbox: rectToBbox(img.Bounds()),
 	}
-
 	return nil
 }
-
-func main() {
-	// Initialize settings and other necessary setup
-	// Use the functions as needed
-}
@@ -0,0 +1,61 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// detectEngine finds one line on every page, except the pages numbered in
+// fail.
+type detectEngine struct {
+	calls int
+	fail  map[int]bool
+}
+
+func (e *detectEngine) DetectLines(img image.Image, dpi float64) ([]schema.DetectedLine, error) {
+	e.calls++
+	if e.fail[e.calls-1] {
+		return nil, errors.New("detector crashed")
+	}
+	return []schema.DetectedLine{{Bbox: geometry.Bbox{1, 1, 10, 5}, Confidence: 1}}, nil
+}
+
+func (e *detectEngine) Recognize(img image.Image, region image.Rectangle, dpi float64) ([]RecognizedLine, error) {
+	return nil, nil
+}
+
+func (e *detectEngine) Close() error { return nil }
+
+func TestDetectTextLines(t *testing.T) {
+	doc := blankPDF(t, 4)
+	defer doc.Close()
+	pages := make([]schema.Page, 4)
+	for i := range pages {
+		pages[i] = schema.Page{Pnum: i, Bbox: geometry.Bbox{0, 0, 100, 100}}
+	}
+
+	engine := &detectEngine{fail: map[int]bool{1: true}}
+	err := DetectTextLines(context.Background(), doc, pages, engine)
+	if err == nil {
+		t.Error("got no error for the failed page")
+	}
+	if engine.calls != 4 {
+		t.Errorf("detected %d pages, want all 4", engine.calls)
+	}
+	for i, page := range pages {
+		if detected := page.TextLines != nil; detected != (i != 1) {
+			t.Errorf("page %d: detected %v", i, detected)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := DetectTextLines(ctx, doc, pages, &detectEngine{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v after cancelling, want %v", err, context.Canceled)
+	}
+}
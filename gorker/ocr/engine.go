@@ -0,0 +1,51 @@
+package ocr
+
+import (
+	"fmt"
+	"image"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
+
+// RecognizedWord is a word read by an OCREngine, in image coordinates.
+type RecognizedWord struct {
+	Text       string
+	Bbox       geometry.Bbox
+	Confidence float64
+}
+
+// RecognizedLine is a line of words read by an OCREngine, in image
+// coordinates. Lines that share a BlockNum belong to the same text block.
+type RecognizedLine struct {
+	Text       string
+	Bbox       geometry.Bbox
+	Confidence float64
+	BlockNum   int
+	Words      []RecognizedWord
+}
+
+// OCREngine finds and reads text in rendered page images, given the
+// resolution they were rendered at. Confidences are between 0 and 1. An
+// engine is not safe for concurrent use.
+type OCREngine interface {
+	// DetectLines finds the text lines in img without keeping their text.
+	DetectLines(img image.Image, dpi float64) ([]schema.DetectedLine, error)
+	// Recognize reads the text inside region of img.
+	Recognize(img image.Image, region image.Rectangle, dpi float64) ([]RecognizedLine, error)
+	Close() error
+}
+
+// NewEngine creates the OCR engine selected by settings.OcrEngine, or nil
+// if OCR is turned off.
+func NewEngine(langs []string) (OCREngine, error) {
+	switch settings.OcrEngine {
+	case "tesseract":
+		return NewTesseractEngine(langs), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown OCR engine %q", settings.OcrEngine)
+	}
+}
@@ -0,0 +1,149 @@
+package ocr
+
+import (
+	"image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"github.com/otiai10/gosseract/v2"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+var (
+	installedMu    sync.Mutex
+	installedLangs []string
+	installedRead  bool
+	// listLanguages reads the installed traineddata. Tests replace it.
+	listLanguages = gosseract.GetAvailableLanguages
+)
+
+// InstalledLanguages returns the Tesseract codes of the traineddata files
+// Tesseract can load, sorted. The list is kept once it has been read, and
+// read again after a failure.
+func InstalledLanguages() ([]string, error) {
+	installedMu.Lock()
+	defer installedMu.Unlock()
+	if installedRead {
+		return installedLangs, nil
+	}
+	langs, err := listLanguages()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(langs)
+	installedLangs, installedRead = langs, true
+	return langs, nil
+}
+
+// TesseractEngine is an OCREngine backed by a Tesseract client, and a
+// layout analyzer for finding lines.
+type TesseractEngine struct {
+	client *gosseract.Client
+	layout *layoutAnalyzer
+}
+
+// NewTesseractEngine creates an engine reading the given Tesseract language
+// codes, or English if there are none.
+func NewTesseractEngine(langs []string) *TesseractEngine {
+	client := gosseract.NewClient()
+	if len(langs) > 0 {
+		client.SetLanguage(langs...)
+	}
+	return &TesseractEngine{client: client, layout: newLayoutAnalyzer()}
+}
+
+func (e *TesseractEngine) Close() error {
+	e.layout.Close()
+	return e.client.Close()
+}
+
+// setImage hands img to Tesseract, along with the resolution it was
+// rendered at since PNM carries none and Tesseract's size heuristics
+// depend on it.
+func (e *TesseractEngine) setImage(img image.Image, dpi float64) error {
+	if dpi > 0 {
+		if err := e.client.SetVariable("user_defined_dpi", strconv.Itoa(int(math.Round(dpi)))); err != nil {
+			return err
+		}
+	}
+	return e.client.SetImageFromBytes(encodePNM(img))
+}
+
+// DetectLines finds lines by layout analysis alone, without reading them.
+// Layout analysis gives no confidence, so every line has full confidence.
+func (e *TesseractEngine) DetectLines(img image.Image, dpi float64) ([]schema.DetectedLine, error) {
+	boxes := e.layout.textLines(img, dpi)
+	lines := make([]schema.DetectedLine, 0, len(boxes))
+	for _, box := range boxes {
+		lines = append(lines, schema.DetectedLine{Bbox: rectToBbox(box), Confidence: 1})
+	}
+	return lines, nil
+}
+
+func (e *TesseractEngine) Recognize(img image.Image, region image.Rectangle, dpi float64) ([]RecognizedLine, error) {
+	region = region.Intersect(img.Bounds())
+	if region.Empty() {
+		return nil, nil
+	}
+	if err := e.setImage(imaging.Crop(img, region), dpi); err != nil {
+		return nil, err
+	}
+	boxes, err := e.client.GetBoundingBoxesVerbose()
+	if err != nil {
+		return nil, err
+	}
+
+	// Words come back in reading order, numbered by block, paragraph and line
+	var lines []RecognizedLine
+	var words []string
+	prevKey := [3]int{-1, -1, -1}
+	for _, box := range boxes {
+		text := strings.TrimSpace(box.Word)
+		if text == "" {
+			continue
+		}
+		word := RecognizedWord{
+			Text:       text,
+			Bbox:       rectToBbox(box.Box.Add(region.Min)),
+			Confidence: box.Confidence / 100,
+		}
+
+		key := [3]int{box.BlockNum, box.ParNum, box.LineNum}
+		if key != prevKey {
+			if len(lines) > 0 {
+				lines[len(lines)-1].Text = strings.Join(words, " ")
+			}
+			lines = append(lines, RecognizedLine{BlockNum: box.BlockNum})
+			words = words[:0]
+			prevKey = key
+		}
+		line := &lines[len(lines)-1]
+		line.Words = append(line.Words, word)
+		words = append(words, text)
+	}
+	if len(lines) > 0 {
+		lines[len(lines)-1].Text = strings.Join(words, " ")
+	}
+
+	for i := range lines {
+		bboxes := make([]geometry.Bbox, len(lines[i].Words))
+		confidence := 0.0
+		for j, word := range lines[i].Words {
+			bboxes[j] = word.Bbox
+			confidence += word.Confidence
+		}
+		lines[i].Bbox = geometry.MergeBboxes(bboxes)
+		lines[i].Confidence = confidence / float64(len(lines[i].Words))
+	}
+	return lines, nil
+}
+
+func rectToBbox(r image.Rectangle) geometry.Bbox {
+	return geometry.Bbox{float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X), float64(r.Max.Y)}
+}
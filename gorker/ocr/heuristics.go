@@ -1,118 +1,186 @@
-package main
+package ocr
 
 import (
 	"math"
 	"regexp"
 	"strings"
-	"unicode"
 
-	"github.com/your-package/marker/schema"
-	"github.com/your-package/marker/settings"
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
 )
 
-func shouldOCRPage(page *schema.Page, noText bool) bool {
-	detectedLinesFound, totalLines := detectedLineCoverage(page)
-
-	// No reason to OCR page if it has no text lines
-	if totalLines == 0 {
-		return false
-	}
+var (
+	spaceRegex   = regexp.MustCompile(`\s+`)
+	newlineRegex = regexp.MustCompile(`\n+`)
+)
 
-	// OCR page if we got minimal text, or if we got too many spaces
-	conditions := []bool{
-		noText, // Full doc has no text, and needs full OCR
-		len(page.PrelimText) > 0 && detectBadOCR(page.PrelimText), // Bad OCR
-		!detectedLinesFound, // didn't extract text for all detected lines
-	}
+// QualityThresholds decide when a page's embedded text is too broken to keep.
+type QualityThresholds struct {
+	// Text is bad above these shares of whitespace runs and newline runs.
+	Space   float64
+	Newline float64
+	// Text is garbled below this share of letters and digits.
+	Alphanum float64
+	// Text is bad above max(InvalidCharsMin, InvalidCharsPct * length)
+	// characters from settings.InvalidChars.
+	InvalidCharsMin int
+	InvalidCharsPct float64
+	// A detected line is covered once this much of it lies in extracted
+	// lines, and a page needs more than Detection of its lines covered.
+	Intersect float64
+	Detection float64
+}
 
-	for _, condition := range conditions {
-		if condition {
-			return true
-		}
+// DefaultQualityThresholds returns the thresholds from settings.
+func DefaultQualityThresholds() QualityThresholds {
+	return QualityThresholds{
+		Space:           settings.OcrSpaceThresh,
+		Newline:         settings.OcrNewlineThresh,
+		Alphanum:        settings.OcrAlphanumThresh,
+		InvalidCharsMin: settings.OcrInvalidCharsMin,
+		InvalidCharsPct: settings.OcrInvalidCharsPct,
+		Intersect:       settings.OcrIntersectThresh,
+		Detection:       settings.OcrDetectionThresh,
 	}
+}
 
-	return settings.OCRAllPages
+// TextQuality holds the metrics used to judge a piece of text.
+type TextQuality struct {
+	Length          int     `json:"length"`
+	WhitespaceRatio float64 `json:"whitespace_ratio"`
+	NewlineRatio    float64 `json:"newline_ratio"`
+	AlphanumRatio   float64 `json:"alphanum_ratio"`
+	InvalidChars    int     `json:"invalid_chars"`
 }
 
-func detectBadOCR(text string, spaceThreshold, newlineThreshold, alphanumThreshold float64) bool {
+func measureText(text string) TextQuality {
+	q := TextQuality{Length: len(text)}
 	if len(text) == 0 {
-		// Assume OCR failed if we have no text
-		return true
+		return q
 	}
 
-	spaceRegex := regexp.MustCompile(`\s+`)
 	spaces := len(spaceRegex.FindAllString(text, -1))
-	alphaChars := len(spaceRegex.ReplaceAllString(text, ""))
-	if float64(spaces)/float64(alphaChars+spaces) > spaceThreshold {
-		return true
-	}
+	nonSpaces := len(spaceRegex.ReplaceAllString(text, ""))
+	q.WhitespaceRatio = float64(spaces) / float64(spaces+nonSpaces)
 
-	newlineRegex := regexp.MustCompile(`\n+`)
 	newlines := len(newlineRegex.FindAllString(text, -1))
 	nonNewlines := len(newlineRegex.ReplaceAllString(text, ""))
-	if float64(newlines)/float64(newlines+nonNewlines) > newlineThreshold {
-		return true
-	}
+	q.NewlineRatio = float64(newlines) / float64(newlines+nonNewlines)
 
-	if alphanumRatio(text) < alphanumThreshold { // Garbled text
-		return true
-	}
+	q.AlphanumRatio = alphanumRatio(text)
 
-	invalidChars := 0
 	for _, c := range text {
 		if strings.ContainsRune(settings.InvalidChars, c) {
-			invalidChars++
+			q.InvalidChars++
 		}
 	}
-	if float64(invalidChars) > math.Max(6.0, float64(len(text))*0.03) {
+	return q
+}
+
+// Bad reports whether text with these metrics should be thrown away. Empty
+// text is always bad.
+func (q TextQuality) Bad(t QualityThresholds) bool {
+	if q.Length == 0 {
 		return true
 	}
+	maxInvalid := math.Max(float64(t.InvalidCharsMin), float64(q.Length)*t.InvalidCharsPct)
+	return q.WhitespaceRatio > t.Space ||
+		q.NewlineRatio > t.Newline ||
+		q.AlphanumRatio < t.Alphanum || // Garbled text
+		float64(q.InvalidChars) > maxInvalid
+}
+
+// Reasons for the OCR decision in a PageQuality.
+const (
+	ReasonNoLines      = "no_lines"      // Nothing detected on the page, never OCRed
+	ReasonNoText       = "no_text"       // The document has no text at all
+	ReasonBadText      = "bad_text"      // The page text fails the TextQuality checks
+	ReasonMissingLines = "missing_lines" // Too few detected lines have extracted text
+	ReasonAllPages     = "all_pages"     // settings.OCRAllPages
+)
 
-	return false
+// PageQuality records why a page was or wasn't OCRed.
+type PageQuality struct {
+	Pnum int `json:"pnum"`
+	TextQuality
+	DetectedLines int     `json:"detected_lines"`
+	CoveredLines  int     `json:"covered_lines"`
+	LineCoverage  float64 `json:"line_coverage"`
+	BadText       bool    `json:"bad_text"`
+	OCR           bool    `json:"ocr"`
+	Reason        string  `json:"reason,omitempty"`
 }
 
-func noTextFound(pages []*schema.Page) bool {
+// AssessPage measures the embedded text of page and decides whether it needs
+// OCR. noText is whether the whole document lacks text.
+func AssessPage(page schema.Page, noText bool, t QualityThresholds) PageQuality {
+	text := page.PrelimText()
+	q := PageQuality{
+		Pnum:        page.Pnum,
+		TextQuality: measureText(text),
+	}
+	q.BadText = len(text) > 0 && q.Bad(t)
+
+	// Pages whose lines weren't detected are judged by their text alone
+	detected := page.TextLines != nil
+	if detected {
+		q.DetectedLines = len(page.TextLines.Bboxes)
+		q.CoveredLines = q.DetectedLines - len(uncoveredLines(page, t.Intersect))
+		if q.DetectedLines == 0 {
+			// No reason to OCR page if it has no text lines
+			q.Reason = ReasonNoLines
+			return q
+		}
+		q.LineCoverage = float64(q.CoveredLines) / float64(q.DetectedLines)
+	}
+
+	switch {
+	case noText:
+		q.Reason = ReasonNoText
+	case q.BadText:
+		q.Reason = ReasonBadText
+	case detected && q.LineCoverage <= t.Detection:
+		q.Reason = ReasonMissingLines
+	case settings.OCRAllPages:
+		q.Reason = ReasonAllPages
+	}
+	q.OCR = q.Reason != ""
+	return q
+}
+
+func detectBadOCR(text string, t QualityThresholds) bool {
+	return measureText(text).Bad(t)
+}
+
+func noTextFound(pages []schema.Page) bool {
 	var fullText strings.Builder
 	for _, page := range pages {
-		fullText.WriteString(page.PrelimText)
+		fullText.WriteString(page.PrelimText())
 	}
 	return len(strings.TrimSpace(fullText.String())) == 0
 }
 
-func detectedLineCoverage(page *schema.Page, intersectThresh, detectionThresh float64) (bool, int) {
-	foundLines := 0
+// uncoveredLines returns the detected lines of a page, in page coordinates,
+// that the extracted text lines don't cover.
+func uncoveredLines(page schema.Page, intersectThresh float64) []geometry.Bbox {
+	if page.TextLines == nil {
+		return nil
+	}
+
+	var uncovered []geometry.Bbox
 	for _, detectedLine := range page.TextLines.Bboxes {
 		// Get bbox and rescale to match dimensions of original page
-		detectedBbox := detectedLine.Bbox
-		detectedBbox = rescaleBbox(page.TextLines.ImageBbox, page.Bbox, detectedBbox)
+		detectedBbox := geometry.RescaleBbox(page.TextLines.ImageBbox, page.Bbox, detectedLine.Bbox)
 		totalIntersection := 0.0
 		for _, block := range page.Blocks {
 			for _, line := range block.Lines {
-				intersectionPct := boxIntersectionPct(detectedBbox, line.Bbox)
-				totalIntersection += intersectionPct
+				totalIntersection += detectedBbox.IntersectionPct(line.Bbox)
 			}
 		}
-		if totalIntersection > intersectThresh {
-			foundLines++
+		if totalIntersection <= intersectThresh {
+			uncovered = append(uncovered, detectedBbox)
 		}
 	}
-	totalLines := len(page.TextLines.Bboxes)
-	if totalLines == 0 {
-		return true, 0
-	}
-	return float64(foundLines)/float64(totalLines) > detectionThresh, totalLines
+	return uncovered
 }
-
-func alphanumRatio(text string) float64 {
-	alphanumCount := 0
-	for _, c := range text {
-		if unicode.IsLetter(c) || unicode.IsNumber(c) {
-			alphanumCount++
-		}
-	}
-	return float64(alphanumCount) / float64(len(text))
-}
-
-// These functions are assumed to be defined elsewhere in your Go codebase:
-// rescaleBbox
-// boxIntersectionPct
@@ -0,0 +1,60 @@
+package ocr
+
+import (
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// textPage returns a page with one line of text at the top, and the given
+// detected lines.
+func textPage(text string, detected []geometry.Bbox) schema.Page {
+	lineBbox := geometry.Bbox{10, 10, 90, 20}
+	page := schema.Page{
+		Bbox: geometry.Bbox{0, 0, 100, 100},
+		Blocks: []schema.Block{{
+			Lines: []schema.Line{{Spans: []schema.Span{{Text: text, Bbox: lineBbox}}, Bbox: lineBbox}},
+			Bbox:  lineBbox,
+		}},
+	}
+	if detected != nil {
+		page.TextLines = &schema.TextDetectionResult{ImageBbox: page.Bbox}
+		for _, bbox := range detected {
+			page.TextLines.Bboxes = append(page.TextLines.Bboxes, schema.DetectedLine{Bbox: bbox, Confidence: 1})
+		}
+	}
+	return page
+}
+
+func TestAssessPage(t *testing.T) {
+	good := "A line of ordinary text that reads well."
+	garbled := "%% ## @@ !! ^^ && ** (( )) ~~ ++"
+	covered := []geometry.Bbox{{10, 10, 90, 20}}
+	missing := []geometry.Bbox{{10, 10, 90, 20}, {10, 30, 90, 40}, {10, 50, 90, 60}}
+
+	tests := []struct {
+		name     string
+		page     schema.Page
+		noText   bool
+		wantOCR  bool
+		wantWhy  string
+		detected int
+	}{
+		{"good text", textPage(good, covered), false, false, "", 1},
+		{"nothing detected", textPage(good, []geometry.Bbox{}), false, false, ReasonNoLines, 0},
+		{"lines missing", textPage(good, missing), false, true, ReasonMissingLines, 3},
+		{"garbled text", textPage(garbled, covered), false, true, ReasonBadText, 1},
+		{"document without text", textPage("", covered), true, true, ReasonNoText, 1},
+		// Detection failed, so the text decides
+		{"undetected good text", textPage(good, nil), false, false, "", 0},
+		{"undetected garbled text", textPage(garbled, nil), false, true, ReasonBadText, 0},
+		{"undetected page of a document without text", textPage("", nil), true, true, ReasonNoText, 0},
+	}
+	for _, tt := range tests {
+		q := AssessPage(tt.page, tt.noText, DefaultQualityThresholds())
+		if q.OCR != tt.wantOCR || q.Reason != tt.wantWhy || q.DetectedLines != tt.detected {
+			t.Errorf("%s: got OCR %v reason %q with %d lines, want %v %q with %d", tt.name, q.OCR, q.Reason, q.DetectedLines, tt.wantOCR, tt.wantWhy, tt.detected)
+		}
+	}
+}
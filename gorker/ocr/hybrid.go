@@ -0,0 +1,88 @@
+package ocr
+
+import (
+	"sort"
+
+	"gorker/gorker/schema"
+)
+
+// spliceLines inserts OCR lines into the extracted blocks of page, either into
+// the nearest block if the line sits next to it or as a new block of its own.
+// Lines that mostly repeat extracted text are dropped. It returns the number
+// of lines inserted.
+func spliceLines(page *schema.Page, lines []schema.Line, intersectThresh float64) int {
+	inserted := 0
+	for _, line := range lines {
+		if coveredByBlocks(page.Blocks, line, intersectThresh) {
+			continue
+		}
+		inserted++
+
+		if len(page.Blocks) == 0 {
+			page.Blocks = append(page.Blocks, newOCRBlock(page.Pnum, line))
+			continue
+		}
+
+		idx := schema.FindInsertBlock(page.Blocks, line.Bbox)
+		block := &page.Blocks[idx]
+		if line.Bbox.Distance(block.Bbox) <= line.Bbox.Height() {
+			block.Lines = append(block.Lines, line)
+			sortLinesInRows(block.Lines)
+			block.Bbox = block.Bbox.Union(line.Bbox)
+			continue
+		}
+
+		// Keep the new block on the side of its neighbour it was found on
+		if line.Bbox.Y0() >= block.Bbox.Y0() {
+			idx++
+		}
+		page.Blocks = append(page.Blocks, schema.Block{})
+		copy(page.Blocks[idx+1:], page.Blocks[idx:])
+		page.Blocks[idx] = newOCRBlock(page.Pnum, line)
+	}
+	return inserted
+}
+
+// sortLinesInRows puts lines in reading order. Lines sharing most of their
+// height with a row are part of it, rows go top to bottom, and the lines of a
+// row left to right.
+func sortLinesInRows(lines []schema.Line) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Bbox.Y0() < lines[j].Bbox.Y0()
+	})
+	for start := 0; start < len(lines); {
+		row, end := lines[start].Bbox, start+1
+		for end < len(lines) {
+			bbox := lines[end].Bbox
+			if bbox.OverlapYPct(row) <= 0.5 && row.OverlapYPct(bbox) <= 0.5 {
+				break
+			}
+			row = row.Union(bbox)
+			end++
+		}
+		rowLines := lines[start:end]
+		sort.SliceStable(rowLines, func(i, j int) bool {
+			return rowLines[i].Bbox.X0() < rowLines[j].Bbox.X0()
+		})
+		start = end
+	}
+}
+
+func newOCRBlock(pnum int, line schema.Line) schema.Block {
+	return schema.Block{
+		Lines:     []schema.Line{line},
+		Bbox:      line.Bbox,
+		Pnum:      pnum,
+		BlockType: "Text",
+	}
+}
+
+func coveredByBlocks(blocks []schema.Block, line schema.Line, intersectThresh float64) bool {
+	totalIntersection := 0.0
+	for _, block := range blocks {
+		for _, existing := range block.Lines {
+			totalIntersection += line.Bbox.IntersectionPct(existing.Bbox)
+		}
+	}
+	return totalIntersection > intersectThresh
+}
@@ -0,0 +1,160 @@
+package ocr
+
+import (
+	"slices"
+	"testing"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+func boxLine(text string, bbox geometry.Bbox) schema.Line {
+	return schema.Line{Spans: []schema.Span{{Text: text, Bbox: bbox}}, Bbox: bbox}
+}
+
+func lineTexts(lines []schema.Line) []string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.PrelimText()
+	}
+	return texts
+}
+
+// permutations returns every ordering of lines.
+func permutations(lines []schema.Line) [][]schema.Line {
+	if len(lines) <= 1 {
+		return [][]schema.Line{append([]schema.Line{}, lines...)}
+	}
+	var all [][]schema.Line
+	for i := range lines {
+		rest := append(append([]schema.Line{}, lines[:i]...), lines[i+1:]...)
+		for _, perm := range permutations(rest) {
+			all = append(all, append([]schema.Line{lines[i]}, perm...))
+		}
+	}
+	return all
+}
+
+func TestSortLinesInRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []schema.Line
+		want  []string
+	}{
+		{
+			name: "rows top to bottom, left to right",
+			lines: []schema.Line{
+				boxLine("a", geometry.Bbox{72, 100, 150, 110}),
+				boxLine("b", geometry.Bbox{200, 101, 300, 111}),
+				boxLine("c", geometry.Bbox{72, 112, 150, 122}),
+				boxLine("d", geometry.Bbox{200, 113, 300, 123}),
+			},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			// Each line overlaps the next by more than half, but the first
+			// and last don't overlap, which an order comparing pairs of
+			// lines can't sort consistently
+			name: "staircase",
+			lines: []schema.Line{
+				boxLine("a", geometry.Bbox{300, 100, 350, 110}),
+				boxLine("b", geometry.Bbox{200, 104, 250, 114}),
+				boxLine("c", geometry.Bbox{100, 108, 150, 118}),
+				boxLine("d", geometry.Bbox{72, 130, 90, 140}),
+			},
+			want: []string{"c", "b", "a", "d"},
+		},
+		{
+			name: "tall line spans two rows",
+			lines: []schema.Line{
+				boxLine("tall", geometry.Bbox{72, 100, 90, 124}),
+				boxLine("top", geometry.Bbox{100, 100, 200, 110}),
+				boxLine("bottom", geometry.Bbox{100, 114, 200, 124}),
+			},
+			want: []string{"tall", "top", "bottom"},
+		},
+	}
+	for _, tt := range tests {
+		for _, perm := range permutations(tt.lines) {
+			sortLinesInRows(perm)
+			if got := lineTexts(perm); !slices.Equal(got, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSpliceLines(t *testing.T) {
+	extracted := []schema.Line{
+		boxLine("first", geometry.Bbox{72, 100, 150, 110}),
+		boxLine("second", geometry.Bbox{72, 112, 150, 122}),
+	}
+	newPage := func() schema.Page {
+		lines := append([]schema.Line{}, extracted...)
+		return schema.Page{
+			Pnum:   2,
+			Bbox:   geometry.Bbox{0, 0, 600, 800},
+			Blocks: []schema.Block{{Lines: lines, Bbox: schema.BboxFromLines(lines), Pnum: 2, BlockType: "Text"}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		page     schema.Page
+		lines    []schema.Line
+		inserted int
+		want     [][]string
+	}{
+		{
+			name:     "line beside a block joins its row",
+			page:     newPage(),
+			lines:    []schema.Line{boxLine("missed", geometry.Bbox{160, 101, 220, 111})},
+			inserted: 1,
+			want:     [][]string{{"first", "missed", "second"}},
+		},
+		{
+			name:     "line repeating extracted text",
+			page:     newPage(),
+			lines:    []schema.Line{boxLine("first", geometry.Bbox{72, 100, 150, 110})},
+			inserted: 0,
+			want:     [][]string{{"first", "second"}},
+		},
+		{
+			name: "lines far away become blocks",
+			page: newPage(),
+			lines: []schema.Line{
+				boxLine("below", geometry.Bbox{72, 400, 150, 410}),
+				boxLine("above", geometry.Bbox{72, 20, 150, 30}),
+			},
+			inserted: 2,
+			want:     [][]string{{"above"}, {"first", "second"}, {"below"}},
+		},
+		{
+			name:     "page without text",
+			page:     schema.Page{Pnum: 2, Bbox: geometry.Bbox{0, 0, 600, 800}},
+			lines:    []schema.Line{boxLine("only", geometry.Bbox{72, 100, 150, 110})},
+			inserted: 1,
+			want:     [][]string{{"only"}},
+		},
+	}
+	for _, tt := range tests {
+		page := tt.page
+		inserted := spliceLines(&page, tt.lines, 0.5)
+		if inserted != tt.inserted {
+			t.Errorf("%s: inserted %d lines, want %d", tt.name, inserted, tt.inserted)
+		}
+		if len(page.Blocks) != len(tt.want) {
+			t.Errorf("%s: got %d blocks, want %d", tt.name, len(page.Blocks), len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			block := page.Blocks[i]
+			if got := lineTexts(block.Lines); !slices.Equal(got, want) {
+				t.Errorf("%s: block %d has lines %v, want %v", tt.name, i, got, want)
+			}
+			if block.Bbox != schema.BboxFromLines(block.Lines) || block.Pnum != 2 {
+				t.Errorf("%s: block %d has bbox %v and page %d", tt.name, i, block.Bbox, block.Pnum)
+			}
+		}
+	}
+}
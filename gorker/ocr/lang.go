@@ -1,60 +1,73 @@
-package main
+package ocr
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
-	"github.com/your-org/marker/ocr/tesseract"
-	"github.com/your-org/marker/settings"
-	"github.com/your-org/surya/languages"
-	"github.com/your-org/surya/model/recognition/tokenizer"
+	"gorker/gorker/settings"
 )
 
-func langsToIds(langs []string) []int {
-	uniqueLangs := make(map[string]bool)
-	for _, lang := range langs {
-		uniqueLangs[lang] = true
-	}
-
-	uniqueLangsList := make([]string, 0, len(uniqueLangs))
-	for lang := range uniqueLangs {
-		uniqueLangsList = append(uniqueLangsList, lang)
+// ReplaceLangsWithCodes maps language names such as "English" and ISO codes
+// such as "en" to the codes the OCR engine expects, picking the default
+// variant of languages that have several. Tesseract codes and unknown values
+// are kept as is.
+func ReplaceLangsWithCodes(langs []string) []string {
+	codes := make([]string, len(langs))
+	for i, lang := range langs {
+		if known, ok := LookupLanguage(lang); ok && !slices.Contains(known.Codes, lang) {
+			codes[i] = known.Codes[0]
+		} else {
+			codes[i] = lang
+		}
 	}
-
-	_, langTokens := tokenizer.LangTokenize("", uniqueLangsList)
-	return langTokens
+	return codes
 }
 
-func replacelangsWithCodes(langs []string) []string {
-	if settings.OCREngine == "surya" {
-		for i, lang := range langs {
-			if code, ok := languages.LanguageToCode[strings.Title(lang)]; ok {
-				langs[i] = code
-			}
+// ValidateLangs checks that every code is a known language with traineddata
+// installed, so a bad language fails the conversion before any work is done.
+func ValidateLangs(langs []string) error {
+	for _, lang := range langs {
+		if _, ok := languagesByCode[lang]; !ok {
+			return fmt.Errorf("invalid language code %s for Tesseract", lang)
 		}
-	} else {
-		for i, lang := range langs {
-			if code, ok := tesseract.LanguageToTesseractCode[lang]; ok {
-				langs[i] = code
-			}
+	}
+	if len(langs) == 0 || settings.OcrEngine != "tesseract" {
+		return nil
+	}
+
+	installed, err := InstalledLanguages()
+	if err != nil {
+		return fmt.Errorf("listing Tesseract languages: %w", err)
+	}
+	var missing []string
+	for _, lang := range langs {
+		if !slices.Contains(installed, lang) {
+			missing = append(missing, lang)
 		}
 	}
-	return langs
+	if len(missing) > 0 {
+		return fmt.Errorf("no Tesseract traineddata for %s, installed languages are: %s",
+			strings.Join(missing, ", "), strings.Join(installed, ", "))
+	}
+	return nil
 }
 
-func validateLangs(langs []string) error {
-	if settings.OCREngine == "surya" {
-		for _, lang := range langs {
-			if _, ok := languages.CodeToLanguage[lang]; !ok {
-				return fmt.Errorf("invalid language code %s for Surya OCR", lang)
-			}
-		}
-	} else {
-		for _, lang := range langs {
-			if _, ok := tesseract.TesseractCodeToLanguage[lang]; !ok {
-				return fmt.Errorf("invalid language code %s for Tesseract", lang)
-			}
+// filterInstalled drops the languages Tesseract has no traineddata for. It
+// keeps all of them if the installed languages can't be listed.
+func filterInstalled(langs []string) []string {
+	if len(langs) == 0 || settings.OcrEngine != "tesseract" {
+		return langs
+	}
+	installed, err := InstalledLanguages()
+	if err != nil {
+		return langs
+	}
+	var kept []string
+	for _, lang := range langs {
+		if slices.Contains(installed, lang) {
+			kept = append(kept, lang)
 		}
 	}
-	return nil
+	return kept
 }
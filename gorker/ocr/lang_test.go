@@ -0,0 +1,129 @@
+package ocr
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"gorker/gorker/settings"
+)
+
+// stubInstalled makes list the source of the installed languages, forgetting
+// any list read before. It returns a func that puts the real one back.
+func stubInstalled(list func() ([]string, error)) func() {
+	saved := listLanguages
+	listLanguages = list
+	installedLangs, installedRead = nil, false
+	return func() {
+		listLanguages = saved
+		installedLangs, installedRead = nil, false
+	}
+}
+
+func TestLookupLanguage(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		found bool
+	}{
+		{"eng", "English", true},
+		{"en", "English", true},
+		{"English", "English", true},
+		{"english", "English", true},
+		{"chi_tra", "Chinese", true},
+		{"zh", "Chinese", true},
+		{"Klingon", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		lang, ok := LookupLanguage(tt.query)
+		if ok != tt.found || lang.Name != tt.want {
+			t.Errorf("LookupLanguage(%q) = %q %v, want %q %v", tt.query, lang.Name, ok, tt.want, tt.found)
+		}
+	}
+}
+
+func TestReplaceLangsWithCodes(t *testing.T) {
+	got := ReplaceLangsWithCodes([]string{"English", "de", "chi_tra", "Chinese", "xyz"})
+	want := []string{"eng", "deu", "chi_tra", "chi_sim", "xyz"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ReplaceLangsWithCodes = %v, want %v", got, want)
+	}
+}
+
+func TestInstalledLanguagesCachesSuccess(t *testing.T) {
+	calls := 0
+	defer stubInstalled(func() ([]string, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("tessdata not found")
+		}
+		return []string{"eng", "deu"}, nil
+	})()
+
+	if _, err := InstalledLanguages(); err == nil {
+		t.Fatal("got no error from a failed listing")
+	}
+	// A failure is not kept, so the list is read again
+	for i := 0; i < 2; i++ {
+		langs, err := InstalledLanguages()
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if want := []string{"deu", "eng"}; !slices.Equal(langs, want) {
+			t.Errorf("InstalledLanguages = %v, want %v", langs, want)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("listed the languages %d times, want 2", calls)
+	}
+}
+
+func TestValidateLangs(t *testing.T) {
+	defer func(engine string) { settings.OcrEngine = engine }(settings.OcrEngine)
+	settings.OcrEngine = "tesseract"
+	defer stubInstalled(func() ([]string, error) { return []string{"eng", "fra"}, nil })()
+
+	tests := []struct {
+		name    string
+		langs   []string
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"installed", []string{"eng", "fra"}, false},
+		{"unknown code", []string{"eng", "xyz"}, true},
+		{"name instead of code", []string{"English"}, true},
+		{"not installed", []string{"deu"}, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateLangs(tt.langs); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateLangs(%v) = %v, want error %v", tt.name, tt.langs, err, tt.wantErr)
+		}
+	}
+
+	// Another engine doesn't need traineddata
+	settings.OcrEngine = "none"
+	if err := ValidateLangs([]string{"deu"}); err != nil {
+		t.Errorf("ValidateLangs with OCR_ENGINE=none: %v", err)
+	}
+}
+
+func TestValidateLangsListingFails(t *testing.T) {
+	defer func(engine string) { settings.OcrEngine = engine }(settings.OcrEngine)
+	settings.OcrEngine = "tesseract"
+	defer stubInstalled(func() ([]string, error) { return nil, errors.New("tessdata not found") })()
+
+	if err := ValidateLangs([]string{"eng"}); err == nil {
+		t.Error("got no error when the installed languages can't be listed")
+	}
+}
+
+func TestFilterInstalled(t *testing.T) {
+	defer func(engine string) { settings.OcrEngine = engine }(settings.OcrEngine)
+	settings.OcrEngine = "tesseract"
+	defer stubInstalled(func() ([]string, error) { return []string{"eng", "fra"}, nil })()
+
+	if got, want := filterInstalled([]string{"fra", "deu", "eng"}), []string{"fra", "eng"}; !slices.Equal(got, want) {
+		t.Errorf("filterInstalled = %v, want %v", got, want)
+	}
+}
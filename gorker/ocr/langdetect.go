@@ -0,0 +1,258 @@
+package ocr
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorker/gorker/schema"
+)
+
+const (
+	// Minimum number of letters before a guess is made at all.
+	minDetectLetters = 50
+	// Share of the letters a script needs to count as used by the text.
+	minScriptShare = 0.1
+	// Share of the best language's stopword hits another Latin language
+	// needs to be kept as well.
+	minStopwordShare = 0.5
+	minStopwordHits  = 3
+)
+
+// scriptLanguages maps scripts to the language usually written in them. Latin,
+// Cyrillic, Han and Arabic need a closer look and are handled separately.
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	code   string
+}{
+	{unicode.Greek, "ell"},
+	{unicode.Hebrew, "heb"},
+	{unicode.Hangul, "kor"},
+	{unicode.Hiragana, "jpn"},
+	{unicode.Katakana, "jpn"},
+	{unicode.Devanagari, "hin"},
+	{unicode.Bengali, "ben"},
+	{unicode.Gurmukhi, "pan"},
+	{unicode.Gujarati, "guj"},
+	{unicode.Oriya, "ori"},
+	{unicode.Tamil, "tam"},
+	{unicode.Telugu, "tel"},
+	{unicode.Kannada, "kan"},
+	{unicode.Malayalam, "mal"},
+	{unicode.Sinhala, "sin"},
+	{unicode.Thai, "tha"},
+	{unicode.Lao, "lao"},
+	{unicode.Khmer, "khm"},
+	{unicode.Myanmar, "mya"},
+	{unicode.Georgian, "kat"},
+	{unicode.Armenian, "hye"},
+	{unicode.Ethiopic, "amh"},
+}
+
+// Common characters written differently in simplified and traditional
+// Chinese.
+const (
+	simplifiedChars  = "这们说时国会来对为个学发经过后动还进种实现开关问题东车长门见书变应认议选边华气电语两"
+	traditionalChars = "這們說時國會來對為個學發經過後動還進種實現開關問題東車長門見書變應認議選邊華氣電語兩"
+)
+
+// latinStopwords are frequent short words that tell Latin script languages
+// apart.
+var latinStopwords = map[string][]string{
+	"eng": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "are", "this"},
+	"deu": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "von", "sich", "auf", "ein"},
+	"fra": {"le", "la", "les", "et", "des", "est", "une", "dans", "pour", "que", "qui", "du"},
+	"spa": {"el", "la", "los", "las", "y", "es", "una", "por", "con", "para", "que", "del"},
+	"ita": {"il", "di", "che", "è", "per", "una", "sono", "della", "con", "non", "gli", "del"},
+	"por": {"o", "os", "as", "e", "é", "uma", "não", "com", "para", "que", "do", "da"},
+	"nld": {"de", "het", "een", "en", "van", "is", "niet", "dat", "op", "zijn", "met", "voor"},
+	"swe": {"och", "att", "det", "är", "som", "en", "på", "för", "med", "inte", "av", "till"},
+	"dan": {"og", "at", "det", "er", "som", "en", "på", "for", "med", "ikke", "af", "til"},
+	"nor": {"og", "å", "det", "er", "som", "en", "på", "for", "med", "ikke", "av", "til"},
+	"fin": {"ja", "on", "ei", "se", "että", "oli", "hän", "mutta", "kuin", "ovat", "myös", "tai"},
+	"pol": {"i", "w", "nie", "na", "się", "jest", "że", "do", "to", "z", "jak", "przez"},
+	"ces": {"a", "je", "se", "na", "že", "to", "v", "jako", "ale", "pro", "jsou", "který"},
+	"tur": {"ve", "bir", "bu", "da", "de", "için", "ile", "olarak", "daha", "çok", "gibi", "olan"},
+	"ind": {"dan", "yang", "di", "ini", "itu", "dengan", "untuk", "tidak", "dari", "dalam", "akan", "pada"},
+	"vie": {"của", "và", "là", "các", "có", "được", "trong", "cho", "không", "những", "một", "với"},
+}
+
+// DetectLanguages guesses the Tesseract codes for the languages of text from
+// the scripts it uses and, for Latin script, its most common words. The most
+// used language comes first. It returns nil if there is too little text to
+// tell.
+func DetectLanguages(text string) []string {
+	counts := make(map[string]int)
+	letters := 0
+	latin, cyrillic, arabic, han := 0, 0, 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for _, sl := range scriptLanguages {
+				if unicode.Is(sl.script, r) {
+					counts[sl.code]++
+					break
+				}
+			}
+		}
+	}
+	if letters < minDetectLetters {
+		return nil
+	}
+
+	// Kana means the Han characters are Japanese
+	if counts["jpn"] > 0 {
+		counts["jpn"] += han
+	} else if han > 0 {
+		counts[chineseVariant(text)] += han
+	}
+	if cyrillic > 0 {
+		counts[cyrillicLanguage(text)] += cyrillic
+	}
+	if arabic > 0 {
+		counts[arabicLanguage(text)] += arabic
+	}
+
+	var codes []string
+	for code, count := range counts {
+		if float64(count)/float64(letters) >= minScriptShare {
+			codes = append(codes, code)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if counts[codes[i]] != counts[codes[j]] {
+			return counts[codes[i]] > counts[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	if float64(latin)/float64(letters) >= minScriptShare {
+		latinCodes := latinLanguages(text)
+		if len(latinCodes) == 0 {
+			latinCodes = []string{"eng"}
+		}
+		// Merge the Latin languages in at the share of the whole script
+		i := sort.Search(len(codes), func(i int) bool { return counts[codes[i]] < latin })
+		codes = append(codes[:i], append(latinCodes, codes[i:]...)...)
+	}
+	return codes
+}
+
+// latinLanguages ranks Latin script languages by how many of their stopwords
+// appear in text.
+func latinLanguages(text string) []string {
+	hits := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	stopwords := make(map[string][]string)
+	for code, list := range latinStopwords {
+		for _, word := range list {
+			stopwords[word] = append(stopwords[word], code)
+		}
+	}
+	for _, word := range words {
+		for _, code := range stopwords[word] {
+			hits[code]++
+		}
+	}
+
+	var codes []string
+	best := 0
+	for code, count := range hits {
+		if count >= minStopwordHits {
+			codes = append(codes, code)
+		}
+		best = max(best, count)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if hits[codes[i]] != hits[codes[j]] {
+			return hits[codes[i]] > hits[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	kept := codes[:0]
+	for _, code := range codes {
+		if float64(hits[code]) >= float64(best)*minStopwordShare {
+			kept = append(kept, code)
+		}
+	}
+	return kept
+}
+
+// cyrillicLanguage tells Russian apart from languages with letters of their
+// own.
+func cyrillicLanguage(text string) string {
+	switch {
+	case strings.ContainsAny(text, "ЂђЋћЉљЊњЏџЈј"):
+		return "srp"
+	case strings.ContainsAny(text, "Ўў"):
+		return "bel"
+	case strings.ContainsAny(text, "ЄєЇїҐґІі"):
+		return "ukr"
+	case strings.ContainsAny(text, "ӘәҒғҚқҢңӨөҰұҮүҺһ"):
+		return "kaz"
+	}
+	return "rus"
+}
+
+// chineseVariant tells traditional from simplified Chinese by the characters
+// only one of them uses.
+func chineseVariant(text string) string {
+	simplified, traditional := 0, 0
+	for _, r := range text {
+		if strings.ContainsRune(simplifiedChars, r) {
+			simplified++
+		} else if strings.ContainsRune(traditionalChars, r) {
+			traditional++
+		}
+	}
+	if traditional > simplified {
+		return "chi_tra"
+	}
+	return "chi_sim"
+}
+
+// arabicLanguage tells Arabic apart from Persian and Urdu by the letters
+// Arabic doesn't use.
+func arabicLanguage(text string) string {
+	switch {
+	case strings.ContainsAny(text, "ٹڈڑںےھ"):
+		return "urd"
+	case strings.ContainsAny(text, "پچژگ"):
+		return "fas"
+	}
+	return "ara"
+}
+
+// DetectDocumentLanguages guesses the languages of the text of all pages,
+// keeping the ones Tesseract can read.
+func DetectDocumentLanguages(pages []schema.Page) []string {
+	var fullText strings.Builder
+	for _, page := range pages {
+		fullText.WriteString(page.PrelimText())
+		fullText.WriteString("\n")
+	}
+	return filterInstalled(DetectLanguages(fullText.String()))
+}
+
+// DetectPageLanguages sets the languages Tesseract can read of every page with
+// enough text to tell. Pages without are OCRed in the document languages.
+func DetectPageLanguages(pages []schema.Page) {
+	for i := range pages {
+		pages[i].Langs = filterInstalled(DetectLanguages(pages[i].PrelimText()))
+	}
+}
@@ -0,0 +1,59 @@
+package ocr
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguages(t *testing.T) {
+	english := "The results of the survey are shown in this table, and it is clear that the method works for most of the cases."
+	german := "Die Ergebnisse der Umfrage sind in der Tabelle, und das ist nicht mit den anderen Werten von sich auf ein Niveau zu bringen."
+	greek := "Η ανάλυση των δεδομένων δείχνει ότι η μέθοδος λειτουργεί καλά στις περισσότερες περιπτώσεις της έρευνας."
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"too short", "The cat is on the mat.", nil},
+		{"only digits and symbols", strings.Repeat("12 + 34 = 46; ", 20), nil},
+		{"english", english, []string{"eng"}},
+		{"german", german, []string{"deu"}},
+		{"latin without stopwords", strings.Repeat("Lorem ipsum dolor sit amet consectetur adipiscing ", 3), []string{"eng"}},
+		{"greek", greek, []string{"ell"}},
+		{"mostly greek with english", greek + " " + english[:60], []string{"ell", "eng"}},
+		{"mostly english with greek", english + " " + english + " " + greek[:80], []string{"eng", "ell"}},
+		{"greek under the share threshold", strings.Repeat(english, 4) + " αβγ", []string{"eng"}},
+		{"russian", strings.Repeat("Результаты исследования показаны в таблице ниже. ", 2), []string{"rus"}},
+		{"ukrainian", strings.Repeat("Результати дослідження наведені в таблиці нижче. ", 2), []string{"ukr"}},
+		{"japanese", strings.Repeat("これは日本語の文章です。漢字とひらがなを使います。", 3), []string{"jpn"}},
+		{"traditional chinese", strings.Repeat("這個問題們說時國會來對為個學發經過後動還進種實現開關", 3), []string{"chi_tra"}},
+		{"simplified chinese", strings.Repeat("这个问题们说时国会来对为个学发经过后动还进种实现开关", 3), []string{"chi_sim"}},
+		{"persian", strings.Repeat("این یک متن فارسی است که برای آزمایش نوشته شده و گچ پژوهش ", 2), []string{"fas"}},
+	}
+	for _, tt := range tests {
+		if got := DetectLanguages(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: DetectLanguages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLatinLanguages(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"no stopwords", "Lorem ipsum dolor sit amet", nil},
+		{"too few hits", "the cat sat on a mat", nil},
+		{"one language", "the cat and the hat of the town is in the house", []string{"eng"}},
+		// Danish and Norwegian share most of their stopwords
+		{"close languages are both kept", "og det er ikke for og det er ikke", []string{"dan", "nor"}},
+	}
+	for _, tt := range tests {
+		if got := latinLanguages(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: latinLanguages = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,211 +1,318 @@
-package main
+package ocr
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"image"
+	"math"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/pdfcpu/pdfcpu/pkg/api"
-	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
-)
-
-type Page struct {
-	Blocks    []Block
-	Pnum      int
-	Bbox      []float64
-	Rotation  int
-	TextLines TextLines
-	OcrMethod string
-}
-
-type Block struct {
-	Bbox  []float64
-	Pnum  int
-	Lines []Line
-}
-
-type Line struct {
-	Bbox  []float64
-	Spans []Span
-}
-
-type Span struct {
-	Text       string
-	Bbox       []float64
-	SpanID     string
-	Font       string
-	FontWeight int
-	FontSize   float64
-}
-
-type TextLines struct {
-	Bboxes [][]float64
-}
-
-type Settings struct {
-	RecognitionBatchSize int
-	TorchDeviceModel     string
-	OcrEngine            string
-	SuryaOcrDPI          int
-	OcrParallelWorkers   int
-	TesseractTimeout     int
-}
-
-var settings = Settings{
-	RecognitionBatchSize: 32,
-	TorchDeviceModel:     "cuda",
-	OcrEngine:            "surya",
-	SuryaOcrDPI:          300,
-	OcrParallelWorkers:   4,
-	TesseractTimeout:     300,
-}
+	"github.com/gen2brain/go-fitz"
 
-func getBatchSize() int {
-	if settings.RecognitionBatchSize != 0 {
-		return settings.RecognitionBatchSize
-	}
-	if settings.TorchDeviceModel == "cuda" || settings.TorchDeviceModel == "mps" {
-		return 32
-	}
-	return 32
-}
+	"gorker/gorker/geometry"
+	"gorker/gorker/pdf"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
 
-func runOCR(doc *pdfcpu.Context, pages []Page, langs []string, recModel interface{}, batchMultiplier int) ([]Page, map[string]int) {
+// RunOCR replaces the text of pages whose embedded text is missing or
+// unusable with text read from the rendered page by engines from newEngine.
+// A nil newEngine turns OCR off.
+//
+// It also returns the quality report behind each page's decision, and joins
+// the failures of pages that kept their embedded text because of them.
+//
+// With settings.OcrHybrid, pages that do have usable text keep it, and only
+// the detected lines it doesn't cover are read and spliced into the blocks.
+func RunOCR(ctx context.Context, doc *fitz.Document, pages []schema.Page, newEngine EngineFactory) ([]schema.Page, map[string]int, []PageQuality, error) {
+	thresholds := DefaultQualityThresholds()
 	ocrPages := 0
 	ocrSuccess := 0
 	ocrFailed := 0
+	hybridPages := 0
+	hybridLines := 0
 	noText := noTextFound(pages)
-	var ocrIdxs []int
+	var jobs []ocrJob
+	quality := make([]PageQuality, len(pages))
 
 	for pnum, page := range pages {
-		if shouldOCRPage(page, noText) {
-			ocrIdxs = append(ocrIdxs, pnum)
-			ocrPages++
+		quality[pnum] = AssessPage(page, noText, thresholds)
+		if !quality[pnum].OCR {
+			continue
 		}
-	}
-
-	if ocrPages == 0 {
-		return pages, map[string]int{
-			"ocr_pages":   0,
-			"ocr_failed":  0,
-			"ocr_success": 0,
+		ocrPages++
+
+		if settings.OcrHybrid && !noText && quality[pnum].Length > 0 && !quality[pnum].BadText {
+			regions := uncoveredLines(page, thresholds.Intersect)
+			if len(regions) == 0 {
+				// Nothing is missing from the text we have
+				ocrSuccess++
+				continue
+			}
+			jobs = append(jobs, ocrJob{pageIdx: pnum, regions: regions, langs: page.Langs})
+		} else {
+			jobs = append(jobs, ocrJob{pageIdx: pnum, langs: page.Langs})
 		}
 	}
 
-	var newPages []Page
-	switch settings.OcrEngine {
-	case "surya":
-		newPages = suryaRecognition(doc, ocrIdxs, langs, recModel, pages, batchMultiplier)
-	case "ocrmypdf":
-		newPages = tesseractRecognition(doc, ocrIdxs, langs)
-	default:
+	if len(jobs) == 0 || newEngine == nil {
 		return pages, map[string]int{
-			"ocr_pages":   0,
-			"ocr_failed":  0,
-			"ocr_success": 0,
-		}
+			"ocr_pages":    ocrPages,
+			"ocr_failed":   0,
+			"ocr_success":  ocrSuccess,
+			"ocr_hybrid":   0,
+			"ocr_inserted": 0,
+		}, quality, nil
 	}
 
-	for i, page := range newPages {
-		origIdx := ocrIdxs[i]
-		if detectBadOCR(page.getPrelimText()) || len(page.getPrelimText()) == 0 {
+	results := tesseractRecognition(ctx, doc, jobs, pages, newEngine)
+	var errs []error
+
+	for i, result := range results {
+		job := jobs[i]
+		page := &pages[job.pageIdx]
+		text := linesText(result.lines)
+		if result.err != nil {
+			errs = append(errs, fmt.Errorf("running OCR on page %d: %w", page.Pnum, result.err))
+			ocrFailed++
+		} else if detectBadOCR(text, thresholds) {
 			ocrFailed++
+		} else if job.regions != nil {
+			ocrSuccess++
+			hybridPages++
+			hybridLines += spliceLines(page, linesToSchema(result.lines, page.Pnum), thresholds.Intersect)
+			page.OcrMethod = "hybrid"
 		} else {
 			ocrSuccess++
-			pages[origIdx] = page
+			*page = schema.Page{
+				Blocks:    linesToBlocks(result.lines, page.Pnum),
+				Pnum:      page.Pnum,
+				Bbox:      page.Bbox,
+				Drawings:  page.Drawings,
+				OcrMethod: "tesseract",
+			}
 		}
 	}
 
 	return pages, map[string]int{
-		"ocr_pages":   ocrPages,
-		"ocr_failed":  ocrFailed,
-		"ocr_success": ocrSuccess,
-	}
+		"ocr_pages":    ocrPages,
+		"ocr_failed":   ocrFailed,
+		"ocr_success":  ocrSuccess,
+		"ocr_hybrid":   hybridPages,
+		"ocr_inserted": hybridLines,
+	}, quality, errors.Join(errs...)
 }
 
-func suryaRecognition(doc *pdfcpu.Context, pageIdxs []int, langs []string, recModel interface{}, pages []Page, batchMultiplier int) []Page {
-	// This function would need to be implemented based on the Surya OCR library
-	// As it's a custom library, I'll leave it as a placeholder
-	fmt.Println("Surya recognition not implemented")
-	return nil
+// ocrJob is a page to OCR, either whole or only the given regions in page
+// coordinates. langs is empty to read the page in the document languages.
+type ocrJob struct {
+	pageIdx int
+	regions []geometry.Bbox
+	langs   []string
 }
 
-func tesseractRecognition(doc *pdfcpu.Context, pageIdxs []int, langs []string) []Page {
-	pdfPages := generateSinglePagePDFs(doc, pageIdxs)
+// ocrResult holds the lines read for a job, in page coordinates.
+type ocrResult struct {
+	lines []RecognizedLine
+	err   error
+}
 
-	var wg sync.WaitGroup
-	results := make([]Page, len(pdfPages))
+// EngineFactory creates an OCR engine for one worker, reading langs or the
+// document languages if langs is empty.
+type EngineFactory func(langs []string) (OCREngine, error)
+
+// tesseractRecognition runs the jobs on a pool of settings.OcrParallelWorkers
+// engines, each page limited to settings.TesseractTimeout seconds. A page
+// that times out keeps its worker until the engine finishes with it, so no
+// more engines are ever alive than there are workers.
+func tesseractRecognition(ctx context.Context, doc *fitz.Document, jobs []ocrJob, pages []schema.Page, newEngine EngineFactory) []ocrResult {
+	results := make([]ocrResult, len(jobs))
+	workers := settings.OcrParallelWorkers
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	if workers < 1 {
+		workers = 1
+	}
 
-	for i, pdfPage := range pdfPages {
+	jobIdxs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
 		wg.Add(1)
-		go func(i int, pdfPage *bytes.Buffer) {
+		go func() {
 			defer wg.Done()
-			results[i] = tesseractRecognitionSingle(pdfPage, langs)
-		}(i, pdfPage)
+			var engine OCREngine
+			var engineLangs string
+			defer func() {
+				if engine != nil {
+					engine.Close()
+				}
+			}()
+
+			for i := range jobIdxs {
+				if err := ctx.Err(); err != nil {
+					results[i] = ocrResult{err: err}
+					continue
+				}
+				// Pages in other languages need an engine of their own
+				if langs := strings.Join(jobs[i].langs, "+"); engine != nil && langs != engineLangs {
+					engine.Close()
+					engine = nil
+				}
+				if engine == nil {
+					var err error
+					engineLangs = strings.Join(jobs[i].langs, "+")
+					if engine, err = newEngine(jobs[i].langs); err != nil {
+						results[i] = ocrResult{err: err}
+						continue
+					}
+				}
+
+				results[i] = tesseractRecognitionSingle(ctx, doc, pages[jobs[i].pageIdx], jobs[i].regions, engine)
+			}
+		}()
 	}
 
+	for i := range jobs {
+		jobIdxs <- i
+	}
+	close(jobIdxs)
 	wg.Wait()
+
 	return results
 }
 
-func generateSinglePagePDFs(doc *pdfcpu.Context, pageIdxs []int) []*bytes.Buffer {
-	var pdfPages []*bytes.Buffer
-
-	for _, pageIdx := range pageIdxs {
-		buf := new(bytes.Buffer)
-		err := api.ExtractPages(doc, buf, []string{fmt.Sprintf("%d", pageIdx+1)}, nil)
-		if err != nil {
-			fmt.Printf("Error extracting page %d: %v\n", pageIdx, err)
-			continue
+// tesseractRecognitionSingle OCRs one page, or only regions of it if there are
+// any. If the page times out it fails, but only returns once engine is done
+// with it and free for the next page.
+func tesseractRecognitionSingle(ctx context.Context, doc *fitz.Document, page schema.Page, regions []geometry.Bbox, engine OCREngine) ocrResult {
+	img, err := pdf.RenderImage(doc, page.Pnum, settings.SuryaOcrDPI)
+	if err != nil {
+		return ocrResult{err: err}
+	}
+	imageBbox := rectToBbox(img.Bounds())
+
+	rects := []image.Rectangle{img.Bounds()}
+	if regions != nil {
+		rects = rects[:0]
+		for _, region := range regions {
+			// Pad the line so glyphs cut by the detector aren't lost
+			bbox := geometry.RescaleBbox(page.Bbox, imageBbox, region)
+			pad := bbox.Height() * 0.2
+			rects = append(rects, image.Rect(
+				int(bbox.X0()-pad), int(bbox.Y0()-pad),
+				int(math.Ceil(bbox.X1()+pad)), int(math.Ceil(bbox.Y1()+pad)),
+			))
 		}
-		pdfPages = append(pdfPages, buf)
 	}
 
-	return pdfPages
-}
-
-func tesseractRecognitionSingle(pdfPage *bytes.Buffer, langs []string) Page {
-	// This function would need to use the Tesseract OCR library
-	// As it's an external tool, I'll leave it as a placeholder
-	fmt.Println("Tesseract recognition not implemented")
-	return Page{}
-}
+	if settings.TesseractTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(settings.TesseractTimeout)*time.Second)
+		defer cancel()
+	}
 
-func shouldOCRPage(page Page, noText bool) bool {
-	// Implement the logic to determine if a page needs OCR
-	return false
-}
+	done := make(chan ocrResult, 1)
+	go func() {
+		var res ocrResult
+		for _, rect := range rects {
+			// Regions left after a timeout aren't worth reading
+			if ctx.Err() != nil {
+				break
+			}
+			lines, err := engine.Recognize(img, rect, settings.SuryaOcrDPI)
+			if err != nil {
+				res.err = err
+				break
+			}
+			res.lines = append(res.lines, lines...)
+		}
+		done <- res
+	}()
+
+	var res ocrResult
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		// Recognition can't be interrupted, so wait for it to finish
+		<-done
+		return ocrResult{err: ctx.Err()}
+	}
+	if res.err != nil {
+		return res
+	}
 
-func noTextFound(pages []Page) bool {
-	// Implement the logic to determine if no text was found in the pages
-	return false
+	for i := range res.lines {
+		line := &res.lines[i]
+		line.Bbox = geometry.RescaleBbox(imageBbox, page.Bbox, line.Bbox)
+		for j := range line.Words {
+			line.Words[j].Bbox = geometry.RescaleBbox(imageBbox, page.Bbox, line.Words[j].Bbox)
+		}
+	}
+	return res
 }
 
-func detectBadOCR(text string) bool {
-	// Implement the logic to detect bad OCR results
-	return false
+func linesText(lines []RecognizedLine) string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	return strings.Join(texts, "\n")
 }
 
-func (p Page) getPrelimText() string {
-	// Implement the logic to get preliminary text from a page
-	return ""
+// linesToSchema turns recognized lines into lines of OCR spans, one for each
+// word so that the spans keep the word positions.
+func linesToSchema(lines []RecognizedLine, pnum int) []schema.Line {
+	out := make([]schema.Line, len(lines))
+	for i, line := range lines {
+		spans := make([]schema.Span, 0, len(line.Words))
+		for j, word := range line.Words {
+			text := word.Text
+			if j < len(line.Words)-1 {
+				text += " "
+			}
+			spans = append(spans, schema.Span{
+				Text:     text,
+				Bbox:     word.Bbox,
+				SpanID:   fmt.Sprintf("%d_ocr_%d_%d", pnum, i, j),
+				FontSize: line.Bbox.Height(),
+				Source:   schema.SourceOCR,
+			})
+		}
+		if len(spans) == 0 {
+			spans = append(spans, schema.Span{
+				Text:     line.Text,
+				Bbox:     line.Bbox,
+				SpanID:   fmt.Sprintf("%d_ocr_%d", pnum, i),
+				FontSize: line.Bbox.Height(),
+				Source:   schema.SourceOCR,
+			})
+		}
+		out[i] = schema.Line{Spans: spans, Bbox: line.Bbox}
+	}
+	return out
 }
 
-func main() {
-	// Example usage
-	doc, err := pdfcpu.ReadFile("input.pdf", nil)
-	if err != nil {
-		fmt.Printf("Error reading PDF: %v\n", err)
-		os.Exit(1)
+// linesToBlocks groups recognized lines into blocks the way the engine found
+// them.
+func linesToBlocks(lines []RecognizedLine, pnum int) []schema.Block {
+	var blocks []schema.Block
+	schemaLines := linesToSchema(lines, pnum)
+	prevBlockNum := -1
+	for i, line := range lines {
+		if len(blocks) == 0 || line.BlockNum != prevBlockNum {
+			blocks = append(blocks, schema.Block{Pnum: pnum, BlockType: "Text"})
+			prevBlockNum = line.BlockNum
+		}
+		block := &blocks[len(blocks)-1]
+		block.Lines = append(block.Lines, schemaLines[i])
 	}
 
-	pages := []Page{}        // Initialize with actual pages
-	langs := []string{"eng"} // Example language
-	var recModel interface{} // This would be your recognition model
-
-	newPages, stats := runOCR(doc, pages, langs, recModel, 1)
-
-	fmt.Printf("OCR Stats: %v\n", stats)
-	fmt.Printf("Processed %d pages\n", len(newPages))
+	for i := range blocks {
+		blocks[i].Bbox = schema.BboxFromLines(blocks[i].Lines)
+	}
+	return blocks
 }
@@ -0,0 +1,143 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gen2brain/go-fitz"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
+
+// blankPDF returns a document of blank pages, which MuPDF opens by
+// rebuilding its missing cross-reference table.
+func blankPDF(t *testing.T, pages int) *fitz.Document {
+	t.Helper()
+	var kids []string
+	var objs strings.Builder
+	for i := 0; i < pages; i++ {
+		kids = append(kids, fmt.Sprintf("%d 0 R", i+3))
+		fmt.Fprintf(&objs, "%d 0 obj <</Type /Page /Parent 2 0 R /MediaBox [0 0 100 100]>> endobj\n", i+3)
+	}
+	data := fmt.Sprintf("%%PDF-1.4\n1 0 obj <</Type /Catalog /Pages 2 0 R>> endobj\n2 0 obj <</Type /Pages /Kids [%s] /Count %d>> endobj\n%strailer <</Root 1 0 R>>\n%%%%EOF\n",
+		strings.Join(kids, " "), pages, objs.String())
+	doc, err := fitz.NewFromMemory([]byte(data))
+	if err != nil {
+		t.Fatalf("opening blank document: %v", err)
+	}
+	return doc
+}
+
+// slowEngine takes delay to read anything, and counts the engines alive at
+// once.
+type slowEngine struct {
+	delay time.Duration
+	pool  *enginePool
+}
+
+type enginePool struct {
+	mu          sync.Mutex
+	alive, most int
+}
+
+func (p *enginePool) newEngine(delay time.Duration) EngineFactory {
+	return func(langs []string) (OCREngine, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.alive++
+		p.most = max(p.most, p.alive)
+		return &slowEngine{delay: delay, pool: p}, nil
+	}
+}
+
+func (e *slowEngine) DetectLines(img image.Image, dpi float64) ([]schema.DetectedLine, error) {
+	return nil, nil
+}
+
+func (e *slowEngine) Recognize(img image.Image, region image.Rectangle, dpi float64) ([]RecognizedLine, error) {
+	time.Sleep(e.delay)
+	return []RecognizedLine{{Text: "text", Words: []RecognizedWord{{Text: "text"}}}}, nil
+}
+
+func (e *slowEngine) Close() error {
+	e.pool.mu.Lock()
+	defer e.pool.mu.Unlock()
+	e.pool.alive--
+	return nil
+}
+
+func TestTesseractRecognitionTimeouts(t *testing.T) {
+	defer func(workers, timeout int) {
+		settings.OcrParallelWorkers, settings.TesseractTimeout = workers, timeout
+	}(settings.OcrParallelWorkers, settings.TesseractTimeout)
+	settings.OcrParallelWorkers, settings.TesseractTimeout = 2, 1
+
+	doc := blankPDF(t, 4)
+	defer doc.Close()
+	pages := make([]schema.Page, 4)
+	jobs := make([]ocrJob, 4)
+	for i := range pages {
+		pages[i] = schema.Page{Pnum: i, Bbox: geometry.Bbox{0, 0, 100, 100}}
+		jobs[i] = ocrJob{pageIdx: i}
+	}
+
+	// Every page times out
+	pool := &enginePool{}
+	results := tesseractRecognition(context.Background(), doc, jobs, pages, pool.newEngine(1500*time.Millisecond))
+	for i, result := range results {
+		if result.err != context.DeadlineExceeded {
+			t.Errorf("page %d: got error %v, want a timeout", i, result.err)
+		}
+	}
+	if pool.most > settings.OcrParallelWorkers {
+		t.Errorf("%d engines were alive at once, want at most %d", pool.most, settings.OcrParallelWorkers)
+	}
+	if pool.alive != 0 {
+		t.Errorf("%d engines were left open", pool.alive)
+	}
+}
+
+func TestLinesToSchema(t *testing.T) {
+	lines := []RecognizedLine{{
+		Text: "Hello OCR world",
+		Bbox: geometry.Bbox{10, 20, 110, 32},
+		Words: []RecognizedWord{
+			{Text: "Hello", Bbox: geometry.Bbox{10, 20, 40, 32}},
+			{Text: "OCR", Bbox: geometry.Bbox{45, 21, 65, 32}},
+			{Text: "world", Bbox: geometry.Bbox{70, 20, 110, 31}},
+		},
+	}}
+
+	got := linesToSchema(lines, 3)
+	if len(got) != 1 {
+		t.Fatalf("got %d lines, want 1", len(got))
+	}
+	if text := got[0].PrelimText(); text != "Hello OCR world" {
+		t.Errorf("line text = %q, want %q", text, "Hello OCR world")
+	}
+
+	want := []schema.Span{
+		{Text: "Hello ", Bbox: geometry.Bbox{10, 20, 40, 32}, SpanID: "3_ocr_0_0"},
+		{Text: "OCR ", Bbox: geometry.Bbox{45, 21, 65, 32}, SpanID: "3_ocr_0_1"},
+		{Text: "world", Bbox: geometry.Bbox{70, 20, 110, 31}, SpanID: "3_ocr_0_2"},
+	}
+	if len(got[0].Spans) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(got[0].Spans), len(want))
+	}
+	for i, w := range want {
+		span := got[0].Spans[i]
+		if span.Text != w.Text || span.Bbox != w.Bbox || span.SpanID != w.SpanID {
+			t.Errorf("span %d = %q %v %s, want %q %v %s", i, span.Text, span.Bbox, span.SpanID, w.Text, w.Bbox, w.SpanID)
+		}
+		if span.Source != schema.SourceOCR || span.FontSize != 12 {
+			t.Errorf("span %d source %q size %v, want %q 12", i, span.Source, span.FontSize, schema.SourceOCR)
+		}
+	}
+}
@@ -1,97 +1,143 @@
-LANGUAGE_TO_TESSERACT_CODE = {
-    'Afrikaans': 'afr',
-    'Amharic': 'amh',
-    'Arabic': 'ara',
-    'Assamese': 'asm',
-    'Azerbaijani': 'aze',
-    'Belarusian': 'bel',
-    'Bulgarian': 'bul',
-    'Bengali': 'ben',
-    'Breton': 'bre',
-    'Bosnian': 'bos',
-    'Catalan': 'cat',
-    'Czech': 'ces',
-    'Welsh': 'cym',
-    'Danish': 'dan',
-    'German': 'deu',
-    'Greek': 'ell',
-    'English': 'eng',
-    'Esperanto': 'epo',
-    'Spanish': 'spa',
-    'Estonian': 'est',
-    'Basque': 'eus',
-    'Persian': 'fas',
-    'Finnish': 'fin',
-    'French': 'fra',
-    'Western Frisian': 'fry',
-    'Irish': 'gle',
-    'Scottish Gaelic': 'gla',
-    'Galician': 'glg',
-    'Gujarati': 'guj',
-    'Hausa': 'hau',
-    'Hebrew': 'heb',
-    'Hindi': 'hin',
-    'Croatian': 'hrv',
-    'Hungarian': 'hun',
-    'Armenian': 'hye',
-    'Indonesian': 'ind',
-    'Icelandic': 'isl',
-    'Italian': 'ita',
-    'Japanese': 'jpn',
-    'Javanese': 'jav',
-    'Georgian': 'kat',
-    'Kazakh': 'kaz',
-    'Khmer': 'khm',
-    'Kannada': 'kan',
-    'Korean': 'kor',
-    'Kurdish': 'kur',
-    'Kyrgyz': 'kir',
-    'Latin': 'lat',
-    'Lao': 'lao',
-    'Lithuanian': 'lit',
-    'Latvian': 'lav',
-    'Malagasy': 'mlg',
-    'Macedonian': 'mkd',
-    'Malayalam': 'mal',
-    'Mongolian': 'mon',
-    'Marathi': 'mar',
-    'Malay': 'msa',
-    'Burmese': 'mya',
-    'Nepali': 'nep',
-    'Dutch': 'nld',
-    'Norwegian': 'nor',
-    'Oromo': 'orm',
-    'Oriya': 'ori',
-    'Punjabi': 'pan',
-    'Polish': 'pol',
-    'Pashto': 'pus',
-    'Portuguese': 'por',
-    'Romanian': 'ron',
-    'Russian': 'rus',
-    'Sanskrit': 'san',
-    'Sindhi': 'snd',
-    'Sinhala': 'sin',
-    'Slovak': 'slk',
-    'Slovenian': 'slv',
-    'Somali': 'som',
-    'Albanian': 'sqi',
-    'Serbian': 'srp',
-    'Sundanese': 'sun',
-    'Swedish': 'swe',
-    'Swahili': 'swa',
-    'Tamil': 'tam',
-    'Telugu': 'tel',
-    'Thai': 'tha',
-    'Tagalog': 'tgl',
-    'Turkish': 'tur',
-    'Uyghur': 'uig',
-    'Ukrainian': 'ukr',
-    'Urdu': 'urd',
-    'Uzbek': 'uzb',
-    'Vietnamese': 'vie',
-    'Xhosa': 'xho',
-    'Yiddish': 'yid',
-    'Chinese': 'chi_sim',
+package ocr
+
+import "strings"
+
+// Language is a language Tesseract can read.
+type Language struct {
+	// Name is the English name, as accepted in Options.Langs.
+	Name string
+	// ISO is the ISO 639-1 code.
+	ISO string
+	// Codes are the Tesseract codes of the language's traineddata, the
+	// default variant first.
+	Codes []string
+}
+
+// Languages lists every language the OCR step knows about.
+var Languages = []Language{
+	{"Afrikaans", "af", []string{"afr"}},
+	{"Amharic", "am", []string{"amh"}},
+	{"Arabic", "ar", []string{"ara"}},
+	{"Assamese", "as", []string{"asm"}},
+	{"Azerbaijani", "az", []string{"aze", "aze_cyrl"}},
+	{"Belarusian", "be", []string{"bel"}},
+	{"Bulgarian", "bg", []string{"bul"}},
+	{"Bengali", "bn", []string{"ben"}},
+	{"Breton", "br", []string{"bre"}},
+	{"Bosnian", "bs", []string{"bos"}},
+	{"Catalan", "ca", []string{"cat"}},
+	{"Czech", "cs", []string{"ces"}},
+	{"Welsh", "cy", []string{"cym"}},
+	{"Danish", "da", []string{"dan"}},
+	{"German", "de", []string{"deu"}},
+	{"Greek", "el", []string{"ell"}},
+	{"English", "en", []string{"eng"}},
+	{"Esperanto", "eo", []string{"epo"}},
+	{"Spanish", "es", []string{"spa"}},
+	{"Estonian", "et", []string{"est"}},
+	{"Basque", "eu", []string{"eus"}},
+	{"Persian", "fa", []string{"fas"}},
+	{"Finnish", "fi", []string{"fin"}},
+	{"French", "fr", []string{"fra"}},
+	{"Western Frisian", "fy", []string{"fry"}},
+	{"Irish", "ga", []string{"gle"}},
+	{"Scottish Gaelic", "gd", []string{"gla"}},
+	{"Galician", "gl", []string{"glg"}},
+	{"Gujarati", "gu", []string{"guj"}},
+	{"Hausa", "ha", []string{"hau"}},
+	{"Hebrew", "he", []string{"heb"}},
+	{"Hindi", "hi", []string{"hin"}},
+	{"Croatian", "hr", []string{"hrv"}},
+	{"Hungarian", "hu", []string{"hun"}},
+	{"Armenian", "hy", []string{"hye"}},
+	{"Indonesian", "id", []string{"ind"}},
+	{"Icelandic", "is", []string{"isl"}},
+	{"Italian", "it", []string{"ita"}},
+	{"Japanese", "ja", []string{"jpn", "jpn_vert"}},
+	{"Javanese", "jv", []string{"jav"}},
+	{"Georgian", "ka", []string{"kat"}},
+	{"Kazakh", "kk", []string{"kaz"}},
+	{"Khmer", "km", []string{"khm"}},
+	{"Kannada", "kn", []string{"kan"}},
+	{"Korean", "ko", []string{"kor", "kor_vert"}},
+	{"Kurdish", "ku", []string{"kur", "kmr"}},
+	{"Kyrgyz", "ky", []string{"kir"}},
+	{"Latin", "la", []string{"lat"}},
+	{"Lao", "lo", []string{"lao"}},
+	{"Lithuanian", "lt", []string{"lit"}},
+	{"Latvian", "lv", []string{"lav"}},
+	{"Malagasy", "mg", []string{"mlg"}},
+	{"Macedonian", "mk", []string{"mkd"}},
+	{"Malayalam", "ml", []string{"mal"}},
+	{"Mongolian", "mn", []string{"mon"}},
+	{"Marathi", "mr", []string{"mar"}},
+	{"Malay", "ms", []string{"msa"}},
+	{"Burmese", "my", []string{"mya"}},
+	{"Nepali", "ne", []string{"nep"}},
+	{"Dutch", "nl", []string{"nld"}},
+	{"Norwegian", "no", []string{"nor"}},
+	{"Oromo", "om", []string{"orm"}},
+	{"Oriya", "or", []string{"ori"}},
+	{"Punjabi", "pa", []string{"pan"}},
+	{"Polish", "pl", []string{"pol"}},
+	{"Pashto", "ps", []string{"pus"}},
+	{"Portuguese", "pt", []string{"por"}},
+	{"Romanian", "ro", []string{"ron"}},
+	{"Russian", "ru", []string{"rus"}},
+	{"Sanskrit", "sa", []string{"san"}},
+	{"Sindhi", "sd", []string{"snd"}},
+	{"Sinhala", "si", []string{"sin"}},
+	{"Slovak", "sk", []string{"slk"}},
+	{"Slovenian", "sl", []string{"slv"}},
+	{"Somali", "so", []string{"som"}},
+	{"Albanian", "sq", []string{"sqi"}},
+	{"Serbian", "sr", []string{"srp", "srp_latn"}},
+	{"Sundanese", "su", []string{"sun"}},
+	{"Swedish", "sv", []string{"swe"}},
+	{"Swahili", "sw", []string{"swa"}},
+	{"Tamil", "ta", []string{"tam"}},
+	{"Telugu", "te", []string{"tel"}},
+	{"Thai", "th", []string{"tha"}},
+	{"Tagalog", "tl", []string{"tgl"}},
+	{"Turkish", "tr", []string{"tur"}},
+	{"Uyghur", "ug", []string{"uig"}},
+	{"Ukrainian", "uk", []string{"ukr"}},
+	{"Urdu", "ur", []string{"urd"}},
+	{"Uzbek", "uz", []string{"uzb", "uzb_cyrl"}},
+	{"Vietnamese", "vi", []string{"vie"}},
+	{"Xhosa", "xh", []string{"xho"}},
+	{"Yiddish", "yi", []string{"yid"}},
+	{"Chinese", "zh", []string{"chi_sim", "chi_tra", "chi_sim_vert", "chi_tra_vert"}},
 }
 
-TESSERACT_CODE_TO_LANGUAGE = {v:k for k,v in LANGUAGE_TO_TESSERACT_CODE.items()}
\ No newline at end of file
+var (
+	languagesByName = make(map[string]*Language, len(Languages))
+	languagesByISO  = make(map[string]*Language, len(Languages))
+	languagesByCode = make(map[string]*Language, len(Languages))
+)
+
+func init() {
+	for i := range Languages {
+		lang := &Languages[i]
+		languagesByName[strings.ToLower(lang.Name)] = lang
+		languagesByISO[lang.ISO] = lang
+		for _, code := range lang.Codes {
+			languagesByCode[code] = lang
+		}
+	}
+}
+
+// LookupLanguage finds a language by one of its Tesseract codes, its ISO code
+// or its name in any case.
+func LookupLanguage(s string) (Language, bool) {
+	if lang, ok := languagesByCode[s]; ok {
+		return *lang, true
+	}
+	if lang, ok := languagesByISO[s]; ok {
+		return *lang, true
+	}
+	if lang, ok := languagesByName[strings.ToLower(s)]; ok {
+		return *lang, true
+	}
+	return Language{}, false
+}
@@ -0,0 +1,73 @@
+package ocr
+
+// #cgo pkg-config: tesseract lept
+// #include <tesseract/capi.h>
+import "C"
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"unsafe"
+)
+
+// layoutAnalyzer runs Tesseract's page layout analysis on its own, which
+// finds the text lines of a page without reading them. gosseract always runs
+// the recognizer before it reports any boxes, so this uses the C API.
+type layoutAnalyzer struct {
+	api *C.TessBaseAPI
+}
+
+// newLayoutAnalyzer creates an analyzer. Layout analysis needs no language
+// data.
+func newLayoutAnalyzer() *layoutAnalyzer {
+	api := C.TessBaseAPICreate()
+	C.TessBaseAPIInitForAnalysePage(api)
+	return &layoutAnalyzer{api: api}
+}
+
+func (a *layoutAnalyzer) Close() {
+	C.TessBaseAPIEnd(a.api)
+	C.TessBaseAPIDelete(a.api)
+}
+
+// textLines returns the boxes of the text lines in img, which was rendered
+// at dpi.
+func (a *layoutAnalyzer) textLines(img image.Image, dpi float64) []image.Rectangle {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		gray = image.NewGray(bounds)
+		draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
+	}
+
+	// Tesseract copies the pixels, so they needn't outlive the call
+	pixels := gray.Pix[gray.PixOffset(bounds.Min.X, bounds.Min.Y):]
+	C.TessBaseAPISetImage(a.api, (*C.uchar)(unsafe.Pointer(&pixels[0])), C.int(bounds.Dx()), C.int(bounds.Dy()), 1, C.int(gray.Stride))
+	if dpi > 0 {
+		C.TessBaseAPISetSourceResolution(a.api, C.int(math.Round(dpi)))
+	}
+	defer C.TessBaseAPIClear(a.api)
+
+	// There is no iterator when the page has no text
+	it := C.TessBaseAPIAnalyseLayout(a.api)
+	if it == nil {
+		return nil
+	}
+	defer C.TessPageIteratorDelete(it)
+
+	var lines []image.Rectangle
+	for {
+		var left, top, right, bottom C.int
+		if C.TessPageIteratorBoundingBox(it, C.RIL_TEXTLINE, &left, &top, &right, &bottom) != 0 {
+			lines = append(lines, image.Rect(int(left), int(top), int(right), int(bottom)).Add(bounds.Min))
+		}
+		if C.TessPageIteratorNext(it, C.RIL_TEXTLINE) == 0 {
+			break
+		}
+	}
+	return lines
+}
@@ -1,8 +1,9 @@
-package main
+package ocr
 
 import (
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 func alphanumRatio(text string) float64 {
@@ -21,6 +22,6 @@ func alphanumRatio(text string) float64 {
 		}
 	}
 
-	ratio := float64(alphanumericCount) / float64(len(text))
+	ratio := float64(alphanumericCount) / float64(utf8.RuneCountInString(text))
 	return ratio
 }
@@ -0,0 +1,71 @@
+package gorker
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func getSubfolderPath(outFolder, fname string) string {
+	return filepath.Join(outFolder, strings.TrimSuffix(fname, filepath.Ext(fname)))
+}
+
+func getMarkdownFilepath(outFolder, fname string) string {
+	outFilename := strings.TrimSuffix(fname, filepath.Ext(fname)) + ".md"
+	return filepath.Join(getSubfolderPath(outFolder, fname), outFilename)
+}
+
+// MarkdownExists reports whether fname has already been converted into
+// outFolder.
+func MarkdownExists(outFolder, fname string) bool {
+	_, err := os.Stat(getMarkdownFilepath(outFolder, fname))
+	return err == nil
+}
+
+// SaveMarkdown writes a converted document to its own subfolder of outFolder:
+// the markdown, every image it references and a _meta.json sidecar with the
+// conversion metadata. It returns the subfolder path.
+func SaveMarkdown(outFolder, fname string, result *Result) (string, error) {
+	subfolderPath := getSubfolderPath(outFolder, fname)
+	if err := os.MkdirAll(subfolderPath, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	markdownFilepath := getMarkdownFilepath(outFolder, fname)
+	if err := os.WriteFile(markdownFilepath, []byte(result.Markdown), 0644); err != nil {
+		return "", err
+	}
+
+	metadata, err := json.MarshalIndent(result.Metadata, "", "    ")
+	if err != nil {
+		return "", fmt.Errorf("encoding metadata: %w", err)
+	}
+	outMetaFilepath := strings.TrimSuffix(markdownFilepath, ".md") + "_meta.json"
+	if err := os.WriteFile(outMetaFilepath, metadata, 0644); err != nil {
+		return "", err
+	}
+
+	for filename, img := range result.Images {
+		if err := saveImage(filepath.Join(subfolderPath, filename), img); err != nil {
+			return "", fmt.Errorf("saving image %s: %w", filename, err)
+		}
+	}
+
+	return subfolderPath, nil
+}
+
+func saveImage(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
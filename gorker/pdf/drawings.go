@@ -0,0 +1,347 @@
+package pdf
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gen2brain/go-fitz"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// MuPDF's SVG output of a page draws text as <use> references to glyph paths
+// defined up front, and everything else as <path> and <image> elements, each
+// with its own transform and possibly nested in transformed groups. Reading
+// it back gives the drawing primitives and glyph positions go-fitz doesn't
+// otherwise expose.
+
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// then returns the transform applying m and then n.
+func (m matrix) then(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+var (
+	svgTagRe    = regexp.MustCompile(`<(/?)([a-zA-Z]+)((?:[^>"]|"[^"]*")*?)(/?)>`)
+	svgAttrRe   = regexp.MustCompile(`([a-zA-Z:-]+)="([^"]*)"`)
+	svgMatrixRe = regexp.MustCompile(`matrix\(([^)]*)\)`)
+	svgPathRe   = regexp.MustCompile(`[MLHVCSQTAZmlhvcsqtaz]|-?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+)
+
+// glyph is a character drawn on a page. Its box runs from the glyph's origin
+// to the far edge of its ink, and from the font's ascent to its descent.
+type glyph struct {
+	text string
+	bbox geometry.Bbox
+}
+
+// The ascent and descent of glyph boxes, in units of the font size. MuPDF's
+// HTML output places lines with the same ascent.
+const (
+	glyphAscent  = 0.8
+	glyphDescent = 0.2
+)
+
+// getDrawings returns the paths and images painted on a page, leaving out
+// text, and the characters drawn on it in the order they were drawn.
+func getDrawings(doc *fitz.Document, pnum int) ([]schema.Drawing, []glyph, error) {
+	svg, err := doc.SVG(pnum)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading drawings of page %d: %w", pnum, err)
+	}
+	drawings, glyphs := parseSVG(svg)
+	return drawings, glyphs, nil
+}
+
+func parseSVG(svg string) ([]schema.Drawing, []glyph) {
+	var drawings []schema.Drawing
+	var glyphs []glyph
+	// Images defined once and placed with <use>, by id
+	imageDefs := make(map[string]geometry.Bbox)
+	// The ink of glyph outlines in font units, by id
+	glyphDefs := make(map[string]geometry.Bbox)
+	transforms := []matrix{identity}
+	// Glyphs made of several paths are defined as groups
+	groupIDs := []string{""}
+	hidden := 0 // Depth inside definitions that aren't painted where they are
+
+	for _, tag := range svgTagRe.FindAllStringSubmatch(svg, -1) {
+		closing, name, selfClosing := tag[1] == "/", tag[2], tag[4] == "/"
+		attrs := make(map[string]string)
+		for _, attr := range svgAttrRe.FindAllStringSubmatch(tag[3], -1) {
+			if attr[1] != "xlink:href" && attr[1] != "href" {
+				attrs[attr[1]] = attr[2]
+			} else if strings.HasPrefix(attr[2], "#") {
+				attrs["href"] = attr[2][1:]
+			}
+		}
+
+		switch name {
+		case "defs", "clipPath", "mask", "symbol", "pattern":
+			if closing {
+				hidden--
+			} else if !selfClosing {
+				hidden++
+			}
+			continue
+		case "g":
+			if closing {
+				if len(transforms) > 1 {
+					transforms = transforms[:len(transforms)-1]
+					groupIDs = groupIDs[:len(groupIDs)-1]
+				}
+			} else if !selfClosing {
+				transforms = append(transforms, parseTransform(attrs["transform"]).then(transforms[len(transforms)-1]))
+				id := attrs["id"]
+				if id == "" {
+					id = groupIDs[len(groupIDs)-1]
+				}
+				groupIDs = append(groupIDs, id)
+			}
+			continue
+		}
+		if closing {
+			continue
+		}
+
+		m := parseTransform(attrs["transform"]).then(transforms[len(transforms)-1])
+		switch name {
+		case "image":
+			x, y := attrFloat(attrs, "x"), attrFloat(attrs, "y")
+			rect := geometry.Bbox{x, y, x + attrFloat(attrs, "width"), y + attrFloat(attrs, "height")}
+			if hidden > 0 {
+				if id := attrs["id"]; id != "" {
+					imageDefs[id] = rect
+				}
+				continue
+			}
+			drawings = append(drawings, schema.Drawing{Bbox: transformBbox(m, rect), Image: true})
+		case "use":
+			if hidden > 0 {
+				continue
+			}
+			if rect, ok := imageDefs[attrs["href"]]; ok {
+				drawings = append(drawings, schema.Drawing{Bbox: transformBbox(m, rect), Image: true})
+			} else if text, ok := attrs["data-text"]; ok {
+				ink := glyphDefs[attrs["href"]]
+				rect := geometry.Bbox{math.Min(ink.X0(), 0), -glyphDescent, math.Max(ink.X1(), 0), glyphAscent}
+				glyphs = append(glyphs, glyph{text: html.UnescapeString(text), bbox: transformBbox(m, rect)})
+			}
+		case "path", "rect", "line":
+			if hidden > 0 {
+				id := attrs["id"]
+				if id == "" {
+					id = groupIDs[len(groupIDs)-1]
+				}
+				if name == "path" && id != "" {
+					if segments := parsePathSegments(attrs["d"], m); len(segments) > 0 {
+						ink := segmentsBbox(segments)
+						if prev, ok := glyphDefs[id]; ok {
+							ink = prev.Union(ink)
+						}
+						glyphDefs[id] = ink
+					}
+				}
+				continue
+			}
+			drawing := schema.Drawing{
+				Stroke: attrs["stroke"] != "" && attrs["stroke"] != "none",
+				Fill:   attrs["fill"] != "none",
+			}
+			switch name {
+			case "path":
+				drawing.Segments = parsePathSegments(attrs["d"], m)
+			case "rect":
+				x, y := attrFloat(attrs, "x"), attrFloat(attrs, "y")
+				w, h := attrFloat(attrs, "width"), attrFloat(attrs, "height")
+				drawing.Segments = polygonSegments(m, [][2]float64{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}})
+			case "line":
+				drawing.Segments = polygonSegments(m, [][2]float64{
+					{attrFloat(attrs, "x1"), attrFloat(attrs, "y1")},
+					{attrFloat(attrs, "x2"), attrFloat(attrs, "y2")},
+				})[:1]
+			}
+			if len(drawing.Segments) == 0 {
+				continue
+			}
+			drawing.Bbox = segmentsBbox(drawing.Segments)
+			drawings = append(drawings, drawing)
+		}
+	}
+	return drawings, glyphs
+}
+
+func parseTransform(value string) matrix {
+	match := svgMatrixRe.FindStringSubmatch(value)
+	if match == nil {
+		return identity
+	}
+	fields := strings.FieldsFunc(match[1], func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) != 6 {
+		return identity
+	}
+	var m matrix
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return identity
+		}
+		m[i] = v
+	}
+	return m
+}
+
+func attrFloat(attrs map[string]string, key string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSuffix(attrs[key], "pt"), 64)
+	return v
+}
+
+func transformBbox(m matrix, b geometry.Bbox) geometry.Bbox {
+	return segmentsBbox(polygonSegments(m, [][2]float64{{b[0], b[1]}, {b[2], b[1]}, {b[2], b[3]}, {b[0], b[3]}}))
+}
+
+// polygonSegments transforms the points of a closed polygon and returns its
+// sides.
+func polygonSegments(m matrix, points [][2]float64) []schema.Segment {
+	segments := make([]schema.Segment, 0, len(points))
+	for i, p := range points {
+		q := points[(i+1)%len(points)]
+		x0, y0 := m.apply(p[0], p[1])
+		x1, y1 := m.apply(q[0], q[1])
+		segments = append(segments, schema.Segment{X0: x0, Y0: y0, X1: x1, Y1: y1})
+	}
+	return segments
+}
+
+func segmentsBbox(segments []schema.Segment) geometry.Bbox {
+	bboxes := make([]geometry.Bbox, len(segments))
+	for i, s := range segments {
+		bboxes[i] = geometry.Bbox{math.Min(s.X0, s.X1), math.Min(s.Y0, s.Y1), math.Max(s.X0, s.X1), math.Max(s.Y0, s.Y1)}
+	}
+	return geometry.MergeBboxes(bboxes)
+}
+
+// parsePathSegments reads the straight segments of SVG path data. MuPDF only
+// writes absolute commands, but relative ones are followed too.
+func parsePathSegments(d string, m matrix) []schema.Segment {
+	var segments []schema.Segment
+	tokens := svgPathRe.FindAllString(d, -1)
+	var cmd byte
+	var x, y, startX, startY float64
+
+	lineTo := func(nx, ny float64) {
+		x0, y0 := m.apply(x, y)
+		x1, y1 := m.apply(nx, ny)
+		segments = append(segments, schema.Segment{X0: x0, Y0: y0, X1: x1, Y1: y1})
+		x, y = nx, ny
+	}
+
+	i := 0
+	next := func() (float64, bool) {
+		if i >= len(tokens) {
+			return 0, false
+		}
+		v, err := strconv.ParseFloat(tokens[i], 64)
+		if err != nil {
+			return 0, false
+		}
+		i++
+		return v, true
+	}
+	// args reads n numbers for the current command, or fails at the next
+	// command letter
+	args := func(n int) ([]float64, bool) {
+		vals := make([]float64, n)
+		for j := range vals {
+			v, ok := next()
+			if !ok {
+				return nil, false
+			}
+			vals[j] = v
+		}
+		return vals, true
+	}
+
+	for i < len(tokens) {
+		if c := tokens[i][0]; (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			cmd = c
+			i++
+			if cmd == 'Z' || cmd == 'z' {
+				if x != startX || y != startY {
+					lineTo(startX, startY)
+				}
+				x, y = startX, startY
+				continue
+			}
+		}
+
+		relative := cmd >= 'a' && cmd <= 'z'
+		ox, oy := 0.0, 0.0
+		if relative {
+			ox, oy = x, y
+		}
+		var ok bool
+		var v []float64
+		switch cmd | 0x20 {
+		case 'm':
+			if v, ok = args(2); ok {
+				x, y = ox+v[0], oy+v[1]
+				startX, startY = x, y
+				// Further pairs are implicit line tos
+				if relative {
+					cmd = 'l'
+				} else {
+					cmd = 'L'
+				}
+			}
+		case 'l', 't':
+			if v, ok = args(2); ok {
+				lineTo(ox+v[0], oy+v[1])
+			}
+		case 'h':
+			if v, ok = args(1); ok {
+				lineTo(ox+v[0], y)
+			}
+		case 'v':
+			if v, ok = args(1); ok {
+				lineTo(x, oy+v[0])
+			}
+		case 'c':
+			if v, ok = args(6); ok {
+				lineTo(ox+v[4], oy+v[5])
+			}
+		case 's', 'q':
+			if v, ok = args(4); ok {
+				lineTo(ox+v[2], oy+v[3])
+			}
+		case 'a':
+			if v, ok = args(7); ok {
+				lineTo(ox+v[5], oy+v[6])
+			}
+		}
+		if !ok {
+			// Skip whatever we couldn't read
+			i++
+		}
+	}
+	return segments
+}
@@ -0,0 +1,351 @@
+package pdf
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/gen2brain/go-fitz"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// GetTextBlocks reads the embedded text of pages [startPage, startPage+maxPages)
+// into the document model, along with the document outline. A maxPages of 0
+// reads to the end of the document. Text that isn't drawn, like the invisible
+// text layer of a scanned page, has no glyphs to place it by and is left out,
+// so such pages go to OCR.
+func GetTextBlocks(doc *fitz.Document, maxPages, startPage int) ([]schema.Page, []fitz.Outline, error) {
+	numPages := doc.NumPage()
+	if startPage < 0 || startPage >= numPages {
+		return nil, nil, fmt.Errorf("start page %d is out of range for a %d page document", startPage, numPages)
+	}
+	endPage := numPages
+	if maxPages > 0 && startPage+maxPages < endPage {
+		endPage = startPage + maxPages
+	}
+
+	// Documents without an outline return an error here
+	toc, _ := doc.ToC()
+
+	var pages []schema.Page
+	for pnum := startPage; pnum < endPage; pnum++ {
+		page, err := extractPage(doc, pnum)
+		if err != nil {
+			return nil, nil, fmt.Errorf("extracting text from page %d: %w", pnum, err)
+		}
+		pages = append(pages, page)
+	}
+	return pages, toc, nil
+}
+
+// GetLengthOfText returns the number of characters in the embedded text of
+// every page, which is much cheaper to find than the text blocks.
+func GetLengthOfText(doc *fitz.Document) (int, error) {
+	length := 0
+	for pnum := 0; pnum < doc.NumPage(); pnum++ {
+		text, err := doc.Text(pnum)
+		if err != nil {
+			return 0, fmt.Errorf("extracting text from page %d: %w", pnum, err)
+		}
+		length += len([]rune(text))
+	}
+	return length, nil
+}
+
+func extractPage(doc *fitz.Document, pnum int) (schema.Page, error) {
+	bound, err := doc.Bound(pnum)
+	if err != nil {
+		return schema.Page{}, err
+	}
+	pageHTML, err := doc.HTML(pnum, false)
+	if err != nil {
+		return schema.Page{}, err
+	}
+	pageText, err := doc.Text(pnum)
+	if err != nil {
+		return schema.Page{}, err
+	}
+	drawings, glyphs, err := getDrawings(doc, pnum)
+	if err != nil {
+		return schema.Page{}, err
+	}
+
+	page := schema.Page{
+		Pnum:     pnum,
+		Bbox:     geometry.Bbox{0, 0, float64(bound.Dx()), float64(bound.Dy())},
+		Drawings: drawings,
+	}
+
+	lines := parseStextHTML(pageHTML)
+	boxes := placeSpans(lines, glyphs)
+	spanID := 0
+	for _, group := range groupLines(lines, pageText) {
+		block := schema.Block{Pnum: pnum, BlockType: "Text"}
+		for _, idx := range group {
+			line := stextToLine(lines[idx], boxes[idx], pnum, &spanID)
+			// Only keep lines with real text and a positive box
+			if strings.TrimSpace(line.PrelimText()) == "" || line.Bbox.Area() <= 0 {
+				continue
+			}
+			block.Lines = append(block.Lines, line)
+		}
+		if len(block.Lines) == 0 {
+			continue
+		}
+		block.Bbox = schema.BboxFromLines(block.Lines)
+		page.Blocks = append(page.Blocks, block)
+	}
+	page.Blocks = mergeSplitBlocks(page.Blocks)
+	return page, nil
+}
+
+func stextToLine(stext stextLine, boxes []geometry.Bbox, pnum int, spanID *int) schema.Line {
+	var line schema.Line
+	var placed []geometry.Bbox
+	for _, box := range boxes {
+		if box != (geometry.Bbox{}) {
+			placed = append(placed, box)
+		}
+	}
+	// A line none of whose glyphs were drawn has nowhere to go
+	if len(placed) == 0 {
+		return line
+	}
+	band := geometry.MergeBboxes(placed)
+
+	for i, s := range stext.Spans {
+		weight := 400.0
+		if s.Bold {
+			weight = 700
+		}
+		line.Spans = append(line.Spans, schema.Span{
+			Text:       strings.TrimRight(s.Text, "\r\n"),
+			Bbox:       spanBbox(boxes, i, band),
+			SpanID:     fmt.Sprintf("%d_%d", pnum, *spanID),
+			Font:       s.Font,
+			FontWeight: weight,
+			FontSize:   s.FontSize,
+			Bold:       s.Bold,
+			Italic:     s.Italic,
+			Source:     schema.SourcePdfText,
+		})
+		*spanID++
+	}
+
+	bboxes := make([]geometry.Bbox, 0, len(line.Spans))
+	for _, span := range line.Spans {
+		bboxes = append(bboxes, span.Bbox)
+	}
+	line.Bbox = geometry.MergeBboxes(bboxes)
+	return line
+}
+
+// spanBbox returns the box of span i. Spans without glyphs of their own,
+// like the spaces between words, fill the gap between their neighbours.
+func spanBbox(boxes []geometry.Bbox, i int, band geometry.Bbox) geometry.Bbox {
+	if boxes[i] != (geometry.Bbox{}) {
+		return boxes[i]
+	}
+	x0, x1 := math.NaN(), math.NaN()
+	for j := i - 1; j >= 0 && math.IsNaN(x0); j-- {
+		if boxes[j] != (geometry.Bbox{}) {
+			x0 = boxes[j].X1()
+		}
+	}
+	for j := i + 1; j < len(boxes) && math.IsNaN(x1); j++ {
+		if boxes[j] != (geometry.Bbox{}) {
+			x1 = boxes[j].X0()
+		}
+	}
+	switch {
+	case math.IsNaN(x0):
+		x0 = x1
+	case math.IsNaN(x1) || x1 < x0:
+		x1 = x0
+	}
+	return geometry.Bbox{x0, band.Y0(), x1, band.Y1()}
+}
+
+// ligatures are the characters of ligature glyphs, which the structured text
+// spells out.
+var ligatures = map[rune]string{
+	'\uFB00': "ff",
+	'\uFB01': "fi",
+	'\uFB02': "fl",
+	'\uFB03': "ffi",
+	'\uFB04': "ffl",
+	'\uFB05': "st",
+	'\uFB06': "st",
+}
+
+// glyphWindow is how far past the last matched glyph a character is looked
+// for, skipping glyphs the structured text doesn't have.
+const glyphWindow = 16
+
+// placeSpans returns the box of every span of the lines, from the glyphs
+// drawn for its characters. MuPDF collects the characters of a line in the
+// order they are drawn, so each line is matched up in sequence with the
+// glyphs level with it, from the glyph at its left edge. Characters only one
+// side has are skipped, and spans with no glyphs found, like invisible text,
+// get an empty box.
+func placeSpans(lines []stextLine, glyphs []glyph) [][]geometry.Bbox {
+	// Ligatures draw several characters with one glyph
+	type drawnRune struct {
+		r     rune
+		glyph int
+	}
+	used := make([]bool, len(glyphs))
+
+	boxes := make([][]geometry.Bbox, len(lines))
+	for i, line := range lines {
+		boxes[i] = make([]geometry.Bbox, len(line.Spans))
+		height := maxFontSize(line)
+		var drawn []drawnRune
+		for g, glyph := range glyphs {
+			if used[g] || !onLine(glyph.bbox, line) || glyph.bbox.X0() < line.Left-height*0.5 {
+				continue
+			}
+			for _, r := range glyph.text {
+				if spelled, ok := ligatures[r]; ok {
+					for _, l := range spelled {
+						drawn = append(drawn, drawnRune{l, g})
+					}
+				} else if !unicode.IsSpace(r) {
+					drawn = append(drawn, drawnRune{r, g})
+				}
+			}
+		}
+
+		// Start at the line's first character, past any glyphs of lines
+		// drawn before it on the same baseline
+		next, last := 0, -1
+		if first := strings.TrimLeftFunc(line.text(), unicode.IsSpace); first != "" {
+			r := []rune(first)[0]
+			for k, d := range drawn {
+				if d.r == r && math.Abs(glyphs[d.glyph].bbox.X0()-line.Left) < height*0.5 {
+					next = k
+					break
+				}
+			}
+		}
+
+		for j, span := range line.Spans {
+			var found []geometry.Bbox
+			for _, r := range span.Text {
+				if unicode.IsSpace(r) {
+					continue
+				}
+				// Some fonts map one glyph to the same character repeated
+				if last >= 0 && drawn[last].r == r && (next >= len(drawn) || drawn[next].r != r) {
+					found = append(found, glyphs[drawn[last].glyph].bbox)
+					continue
+				}
+				last = -1
+				for k := next; k < len(drawn) && k < next+glyphWindow; k++ {
+					if drawn[k].r == r {
+						found = append(found, glyphs[drawn[k].glyph].bbox)
+						used[drawn[k].glyph] = true
+						next, last = k+1, k
+						break
+					}
+				}
+			}
+			if len(found) > 0 {
+				boxes[i][j] = geometry.MergeBboxes(found)
+			}
+		}
+	}
+	return boxes
+}
+
+// onLine reports whether a glyph box is level with a line, which keeps
+// characters from matching a glyph of the same character elsewhere. Scripts
+// set off the baseline still are.
+func onLine(box geometry.Bbox, line stextLine) bool {
+	height := maxFontSize(line)
+	middle := line.Top + height*(glyphAscent+glyphDescent)/2
+	return math.Abs((box.Y0()+box.Y1())/2-middle) < height*0.5
+}
+
+// maxFontSize returns the largest font size of a line.
+func maxFontSize(line stextLine) float64 {
+	height := 0.0
+	for _, span := range line.Spans {
+		height = math.Max(height, span.FontSize)
+	}
+	return height
+}
+
+// groupLines splits the page lines into MuPDF's text blocks, as indices into
+// lines. The plain text output has the same lines in the same order, with a
+// blank line after each block. If the two disagree every line becomes its own
+// block.
+func groupLines(lines []stextLine, pageText string) [][]int {
+	var groups [][]int
+	var block []int
+	idx := 0
+	aligned := true
+	for _, text := range strings.Split(pageText, "\n") {
+		if text == "" {
+			if len(block) > 0 {
+				groups = append(groups, block)
+				block = nil
+			}
+			continue
+		}
+		if idx >= len(lines) || lines[idx].text() != text {
+			aligned = false
+			break
+		}
+		block = append(block, idx)
+		idx++
+	}
+	if len(block) > 0 {
+		groups = append(groups, block)
+	}
+
+	if !aligned || idx != len(lines) {
+		groups = nil
+		for i := range lines {
+			groups = append(groups, []int{i})
+		}
+	}
+	return groups
+}
+
+// mergeSplitBlocks joins single line blocks onto the block above when they
+// read as the next line of the same paragraph. Some producers write every line
+// as its own text object, which MuPDF then reports as its own block.
+func mergeSplitBlocks(blocks []schema.Block) []schema.Block {
+	var merged []schema.Block
+	for _, block := range blocks {
+		if n := len(merged); n > 0 && len(block.Lines) == 1 && continuesBlock(merged[n-1], block.Lines[0]) {
+			merged[n-1].Lines = append(merged[n-1].Lines, block.Lines[0])
+			merged[n-1].Bbox = merged[n-1].Bbox.Union(block.Bbox)
+			continue
+		}
+		merged = append(merged, block)
+	}
+	return merged
+}
+
+func continuesBlock(block schema.Block, line schema.Line) bool {
+	prev := block.Lines[len(block.Lines)-1]
+	prevSize, nextSize := lineFontSize(prev), lineFontSize(line)
+	gap := line.Bbox.Y0() - prev.Bbox.Y1()
+	return gap >= -prev.Bbox.Height()*0.2 &&
+		gap < math.Max(prevSize, nextSize)*0.9 &&
+		math.Abs(prevSize-nextSize) <= math.Max(prevSize, nextSize)*0.1 &&
+		prev.Bbox.OverlapX(line.Bbox) > 0
+}
+
+func lineFontSize(line schema.Line) float64 {
+	size := 0.0
+	for _, span := range line.Spans {
+		size = math.Max(size, span.FontSize)
+	}
+	return size
+}
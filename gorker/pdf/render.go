@@ -0,0 +1,50 @@
+package pdf
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/gen2brain/go-fitz"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+// RenderImage rasterizes a page at the given resolution.
+func RenderImage(doc *fitz.Document, pnum int, dpi float64) (image.Image, error) {
+	img, err := doc.ImageDPI(pnum, dpi)
+	if err != nil {
+		return nil, fmt.Errorf("rendering page %d: %w", pnum, err)
+	}
+	return img, nil
+}
+
+// RenderBboxImage rasterizes the part of a page covered by bbox, which is in
+// the page's own coordinate space.
+func RenderBboxImage(doc *fitz.Document, page schema.Page, bbox geometry.Bbox, dpi float64) (image.Image, error) {
+	img, err := RenderImage(doc, page.Pnum, dpi)
+	if err != nil {
+		return nil, err
+	}
+	return CropBboxImage(img, page, bbox)
+}
+
+// CropBboxImage cuts the part covered by bbox, which is in the page's own
+// coordinate space, out of a render of the whole page.
+func CropBboxImage(img image.Image, page schema.Page, bbox geometry.Bbox) (image.Image, error) {
+	bounds := img.Bounds()
+	imageBbox := geometry.Bbox{float64(bounds.Min.X), float64(bounds.Min.Y), float64(bounds.Max.X), float64(bounds.Max.Y)}
+	cropBbox := geometry.RescaleBbox(page.Bbox, imageBbox, bbox)
+	rect := image.Rect(
+		int(math.Floor(cropBbox.X0())),
+		int(math.Floor(cropBbox.Y0())),
+		int(math.Ceil(cropBbox.X1())),
+		int(math.Ceil(cropBbox.Y1())),
+	).Intersect(bounds)
+	if rect.Empty() {
+		return nil, fmt.Errorf("bbox %v is outside page %d", bbox, page.Pnum)
+	}
+	return imaging.Crop(img, rect), nil
+}
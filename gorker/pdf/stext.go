@@ -0,0 +1,160 @@
+package pdf
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MuPDF's HTML output of the structured text page is the richest view of it
+// go-fitz exposes. Each line is a <p> whose top sits 0.8em above the baseline
+// of its first character, holding spans with their font family and size,
+// wrapped in <b>, <i>, <tt> and <sup> for the flags MuPDF detected. It has no
+// glyph positions, which are read from the SVG output instead.
+
+type stextSpan struct {
+	Text        string
+	Font        string
+	FontSize    float64
+	Bold        bool
+	Italic      bool
+	Monospace   bool
+	Superscript bool
+	Subscript   bool
+}
+
+type stextLine struct {
+	Top        float64
+	Left       float64
+	LineHeight float64
+	Spans      []stextSpan
+}
+
+func (l stextLine) text() string {
+	var sb strings.Builder
+	for _, span := range l.Spans {
+		sb.WriteString(span.Text)
+	}
+	return sb.String()
+}
+
+var (
+	stextLineRe  = regexp.MustCompile(`(?s)<p style="([^"]*)">(.*?)</p>`)
+	stextTokenRe = regexp.MustCompile(`<(/?)([a-z]+)([^>]*)>|[^<]+`)
+	styleAttrRe  = regexp.MustCompile(`style="([^"]*)"`)
+)
+
+func parseStextHTML(page string) []stextLine {
+	var lines []stextLine
+	for _, match := range stextLineRe.FindAllStringSubmatch(page, -1) {
+		style := parseStyle(match[1])
+		line := stextLine{
+			Top:        parsePoints(style["top"]),
+			Left:       parsePoints(style["left"]),
+			LineHeight: parsePoints(style["line-height"]),
+		}
+		line.Spans = parseStextSpans(match[2])
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func parseStextSpans(content string) []stextSpan {
+	var spans []stextSpan
+	var bold, italic, mono, sup int
+	var styles []map[string]string
+
+	for _, token := range stextTokenRe.FindAllStringSubmatch(content, -1) {
+		if token[2] == "" {
+			if len(styles) == 0 {
+				continue
+			}
+			style := styles[len(styles)-1]
+			span := stextSpan{
+				Text:        html.UnescapeString(token[0]),
+				Font:        fontName(style["font-family"]),
+				FontSize:    parsePoints(style["font-size"]),
+				Bold:        bold > 0,
+				Italic:      italic > 0,
+				Monospace:   mono > 0 || isMonospaceFont(style["font-family"]),
+				Superscript: sup > 0,
+			}
+			// MuPDF splits spans on color changes, which we don't keep, so
+			// join runs that look the same.
+			if n := len(spans); n > 0 && sameStyle(spans[n-1], span) {
+				spans[n-1].Text += span.Text
+			} else {
+				spans = append(spans, span)
+			}
+			continue
+		}
+
+		delta := 1
+		if token[1] == "/" {
+			delta = -1
+		}
+		switch token[2] {
+		case "b":
+			bold += delta
+		case "i":
+			italic += delta
+		case "tt":
+			mono += delta
+		case "sup":
+			sup += delta
+		case "span":
+			if delta > 0 {
+				attr := styleAttrRe.FindStringSubmatch(token[3])
+				if attr == nil {
+					styles = append(styles, map[string]string{})
+				} else {
+					styles = append(styles, parseStyle(attr[1]))
+				}
+			} else if len(styles) > 0 {
+				styles = styles[:len(styles)-1]
+			}
+		}
+	}
+	return spans
+}
+
+func sameStyle(a, b stextSpan) bool {
+	return a.Font == b.Font && a.FontSize == b.FontSize && a.Bold == b.Bold && a.Italic == b.Italic &&
+		a.Monospace == b.Monospace && a.Superscript == b.Superscript
+}
+
+func parseStyle(style string) map[string]string {
+	props := make(map[string]string)
+	for _, decl := range strings.Split(style, ";") {
+		key, value, ok := strings.Cut(decl, ":")
+		if ok {
+			props[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return props
+}
+
+func parsePoints(value string) float64 {
+	points, err := strconv.ParseFloat(strings.TrimSuffix(value, "pt"), 64)
+	if err != nil {
+		return 0
+	}
+	return points
+}
+
+// fontName drops the generic CSS family MuPDF appends to the PDF font name,
+// and any subset prefix left on it.
+func fontName(family string) string {
+	name, _, _ := strings.Cut(family, ",")
+	name = strings.Trim(name, `'"`)
+	if prefix, rest, ok := strings.Cut(name, "+"); ok && len(prefix) == 6 {
+		name = rest
+	}
+	return name
+}
+
+func isMonospaceFont(family string) bool {
+	lower := strings.ToLower(family)
+	return strings.Contains(lower, "monospace") || strings.Contains(lower, "courier") || strings.Contains(lower, "mono")
+}
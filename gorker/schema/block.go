@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"math"
+	"strings"
+
+	"gorker/gorker/geometry"
+)
+
+// Span sources record where a span's text came from.
+const (
+	SourcePdfText = "pdftext"
+	SourceOCR     = "ocr"
+)
+
+type Span struct {
+	Text       string        `json:"text"`
+	Bbox       geometry.Bbox `json:"bbox"`
+	SpanID     string        `json:"span_id"`
+	Font       string        `json:"font"`
+	FontWeight float64       `json:"font_weight"`
+	FontSize   float64       `json:"font_size"`
+	Rotation   int           `json:"rotation"`
+	Bold       bool          `json:"bold"`
+	Italic     bool          `json:"italic"`
+	Image      bool          `json:"image"`
+	Source     string        `json:"source"`
+}
+
+type Line struct {
+	Spans []Span        `json:"spans"`
+	Bbox  geometry.Bbox `json:"bbox"`
+}
+
+func (l Line) PrelimText() string {
+	var sb strings.Builder
+	for _, span := range l.Spans {
+		sb.WriteString(span.Text)
+	}
+	return sb.String()
+}
+
+func (l Line) Start() float64 {
+	return l.Bbox[0]
+}
+
+func (l Line) IntersectionPct(bbox geometry.Bbox) float64 {
+	return l.Bbox.IntersectionPct(bbox)
+}
+
+type Block struct {
+	Lines     []Line        `json:"lines"`
+	Bbox      geometry.Bbox `json:"bbox"`
+	Pnum      int           `json:"pnum"`
+	BlockType string        `json:"block_type"`
+	// HeadingLevel is the markdown level of a heading block, 1 to 6, or 0
+	// if it hasn't been worked out.
+	HeadingLevel int `json:"heading_level,omitempty"`
+}
+
+func (b Block) PrelimText() string {
+	lines := make([]string, 0, len(b.Lines))
+	for _, line := range b.Lines {
+		lines = append(lines, line.PrelimText())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b Block) IntersectionPct(bbox geometry.Bbox) float64 {
+	return b.Bbox.IntersectionPct(bbox)
+}
+
+func (b Block) MinLineStart() float64 {
+	minStart := math.Inf(1)
+	for _, line := range b.Lines {
+		minStart = math.Min(minStart, line.Start())
+	}
+	return minStart
+}
+
+// Copy returns a copy of the block that shares no line or span storage with
+// the original.
+func (b Block) Copy() Block {
+	copied := b
+	copied.Lines = make([]Line, len(b.Lines))
+	for i, line := range b.Lines {
+		copied.Lines[i] = Line{Spans: append([]Span(nil), line.Spans...), Bbox: line.Bbox}
+	}
+	return copied
+}
+
+// FilterSpans drops every span whose id is in badSpanIDs.
+func (b *Block) FilterSpans(badSpanIDs map[string]bool) {
+	var newLines []Line
+	for _, line := range b.Lines {
+		var newSpans []Span
+		for _, span := range line.Spans {
+			if !badSpanIDs[span.SpanID] {
+				newSpans = append(newSpans, span)
+			}
+		}
+		line.Spans = newSpans
+		if len(newSpans) > 0 {
+			newLines = append(newLines, line)
+		}
+	}
+	b.Lines = newLines
+}
+
+func BboxFromLines(lines []Line) geometry.Bbox {
+	bboxes := make([]geometry.Bbox, 0, len(lines))
+	for _, line := range lines {
+		bboxes = append(bboxes, line.Bbox)
+	}
+	return geometry.MergeBboxes(bboxes)
+}
+
+// FindInsertBlock returns the index of the block nearest to bbox, which is
+// where content detected in bbox should be inserted.
+func FindInsertBlock(blocks []Block, bbox geometry.Bbox) int {
+	bboxes := make([]geometry.Bbox, 0, len(blocks))
+	for _, block := range blocks {
+		bboxes = append(bboxes, block.Bbox)
+	}
+	return max(geometry.NearestBbox(bbox, bboxes), 0)
+}
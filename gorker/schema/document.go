@@ -0,0 +1,19 @@
+package schema
+
+import "strings"
+
+// Document is the root of the model every pipeline stage reads and writes:
+// Document -> Page -> Block -> Line -> Span.
+type Document struct {
+	Filename string            `json:"filename"`
+	Pages    []Page            `json:"pages"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+func (d Document) PrelimText() string {
+	pages := make([]string, 0, len(d.Pages))
+	for _, page := range d.Pages {
+		pages = append(pages, page.PrelimText())
+	}
+	return strings.Join(pages, "\n")
+}
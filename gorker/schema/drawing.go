@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"math"
+
+	"gorker/gorker/geometry"
+)
+
+// Segment is a straight piece of a path, in page coordinates.
+type Segment struct {
+	X0, Y0, X1, Y1 float64
+}
+
+// Horizontal reports whether the segment runs left to right, within tol.
+func (s Segment) Horizontal(tol float64) bool {
+	return math.Abs(s.Y1-s.Y0) <= tol && math.Abs(s.X1-s.X0) > tol
+}
+
+// Vertical reports whether the segment runs top to bottom, within tol.
+func (s Segment) Vertical(tol float64) bool {
+	return math.Abs(s.X1-s.X0) <= tol && math.Abs(s.Y1-s.Y0) > tol
+}
+
+// Drawing is a vector path or an image painted on a page, in page
+// coordinates.
+type Drawing struct {
+	Bbox   geometry.Bbox
+	Image  bool
+	Stroke bool
+	Fill   bool
+	// Segments are the straight pieces of a path. Curves are replaced by the
+	// chord between their end points.
+	Segments []Segment
+}
@@ -0,0 +1,25 @@
+package schema
+
+import "gorker/gorker/geometry"
+
+// MergedLine is a line whose spans have been joined into a single string,
+// keeping the fonts used so formatting can be recovered later.
+type MergedLine struct {
+	Text  string        `json:"text"`
+	Fonts []string      `json:"fonts"`
+	Bbox  geometry.Bbox `json:"bbox"`
+}
+
+type MergedBlock struct {
+	Lines        []MergedLine  `json:"lines"`
+	Pnum         int           `json:"pnum"`
+	BlockType    string        `json:"block_type"`
+	Bbox         geometry.Bbox `json:"bbox"`
+	HeadingLevel int           `json:"heading_level,omitempty"`
+}
+
+// FullyMergedBlock is a block rendered down to its final text.
+type FullyMergedBlock struct {
+	Text      string `json:"text"`
+	BlockType string `json:"block_type"`
+}
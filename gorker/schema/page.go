@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"image"
+	"strings"
+
+	"gorker/gorker/geometry"
+)
+
+type LayoutBox struct {
+	Bbox       geometry.Bbox `json:"bbox"`
+	Label      string        `json:"label"`
+	Confidence float64       `json:"confidence"`
+}
+
+// LayoutResult holds labeled regions in the coordinate space of ImageBbox,
+// the rendered page image they were detected on.
+type LayoutResult struct {
+	Bboxes    []LayoutBox   `json:"bboxes"`
+	ImageBbox geometry.Bbox `json:"image_bbox"`
+}
+
+type OrderBox struct {
+	Bbox     geometry.Bbox `json:"bbox"`
+	Position int           `json:"position"`
+}
+
+// OrderResult holds reading order positions in the coordinate space of
+// ImageBbox.
+type OrderResult struct {
+	Bboxes    []OrderBox    `json:"bboxes"`
+	ImageBbox geometry.Bbox `json:"image_bbox"`
+}
+
+type DetectedLine struct {
+	Bbox       geometry.Bbox `json:"bbox"`
+	Confidence float64       `json:"confidence"`
+}
+
+// TextDetectionResult holds text line boxes found on a rendered page, in the
+// coordinate space of ImageBbox.
+type TextDetectionResult struct {
+	Bboxes    []DetectedLine `json:"bboxes"`
+	ImageBbox geometry.Bbox  `json:"image_bbox"`
+}
+
+type Page struct {
+	Blocks    []Block              `json:"blocks"`
+	Pnum      int                  `json:"pnum"`
+	Bbox      geometry.Bbox        `json:"bbox"`
+	TextLines *TextDetectionResult `json:"text_lines,omitempty"`
+	Layout    *LayoutResult        `json:"layout,omitempty"`
+	Order     *OrderResult         `json:"order,omitempty"`
+	OcrMethod string               `json:"ocr_method,omitempty"`
+	Langs     []string             `json:"langs,omitempty"`
+	Images    []image.Image        `json:"-"`
+	// Drawings are the paths and images painted on the page, read along
+	// with its text.
+	Drawings []Drawing `json:"-"`
+}
+
+func (p Page) PrelimText() string {
+	blocks := make([]string, 0, len(p.Blocks))
+	for _, block := range p.Blocks {
+		blocks = append(blocks, block.PrelimText())
+	}
+	return strings.Join(blocks, "\n")
+}
+
+func (p Page) NonblankLines() []Line {
+	var lines []Line
+	for _, block := range p.Blocks {
+		for _, line := range block.Lines {
+			if strings.TrimSpace(line.PrelimText()) != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+func (p Page) NonblankSpans() []Span {
+	var spans []Span
+	for _, block := range p.Blocks {
+		for _, line := range block.Lines {
+			for _, span := range line.Spans {
+				if strings.TrimSpace(span.Text) != "" {
+					spans = append(spans, span)
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func (p Page) FontSizes() []float64 {
+	var sizes []float64
+	for _, block := range p.Blocks {
+		for _, line := range block.Lines {
+			for _, span := range line.Spans {
+				sizes = append(sizes, span.FontSize)
+			}
+		}
+	}
+	return sizes
+}
+
+func (p Page) LineHeights() []float64 {
+	var heights []float64
+	for _, block := range p.Blocks {
+		for _, line := range block.Lines {
+			heights = append(heights, line.Bbox.Height())
+		}
+	}
+	return heights
+}
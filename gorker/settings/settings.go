@@ -0,0 +1,98 @@
+package settings
+
+import (
+	"os"
+	"strconv"
+)
+
+// Settings are read once from the environment, falling back to the defaults
+// below.
+var (
+	TorchDeviceModel = envString("TORCH_DEVICE", "cpu")
+
+	// Minimum share of a line's area inside a layout region for the line to
+	// belong to it.
+	BboxIntersectionThresh = envFloat("BBOX_INTERSECTION_THRESH", 0.7)
+
+	// Equation recognition. The engine is "server", a LaTeX-OCR server at
+	// TexifyServerURL, or "none" to keep the extracted text of equations. A
+	// batch size of 0 picks one based on the device.
+	EquationEngine    = envString("EQUATION_ENGINE", "server")
+	TexifyServerURL   = envString("TEXIFY_SERVER_URL", "http://127.0.0.1:8502/predict/")
+	TexifyTimeout     = envInt("TEXIFY_TIMEOUT", 60)
+	TexifyBatchSize   = envInt("TEXIFY_BATCH_SIZE", 0)
+	TexifyModelMax    = envInt("TEXIFY_MODEL_MAX", 384)
+	TexifyTokenBuffer = envInt("TEXIFY_TOKEN_BUFFER", 256)
+	TexifyDPI         = envFloat("TEXIFY_DPI", 96)
+
+	// Text line detection.
+	SuryaDetectorDPI = envFloat("SURYA_DETECTOR_DPI", 96)
+
+	// OCR. The engine is "tesseract", or "none" to turn OCR off.
+	OcrEngine          = envString("OCR_ENGINE", "tesseract")
+	OCRAllPages        = envBool("OCR_ALL_PAGES", false)
+	SuryaOcrDPI        = envFloat("SURYA_OCR_DPI", 300)
+	OcrParallelWorkers = envInt("OCR_PARALLEL_WORKERS", 4)
+	TesseractTimeout   = envInt("TESSERACT_TIMEOUT", 300)
+	// Keep usable embedded text and only OCR the lines it misses.
+	OcrHybrid = envBool("OCR_HYBRID", false)
+	// Languages to OCR in when none are given, detected from the text of the
+	// whole "document" or of each "page". "none" leaves them to Tesseract.
+	LangDetect = envString("LANG_DETECT", "document")
+
+	// Layout analysis. The engine is "rules", or "none" to turn it off.
+	LayoutEngine = envString("LAYOUT_ENGINE", "rules")
+
+	// Characters that signal a broken text layer.
+	InvalidChars = envString("INVALID_CHARS", "\ufffd")
+
+	// When embedded text is judged too broken to keep, see ocr.PageQuality.
+	OcrSpaceThresh     = envFloat("OCR_SPACE_THRESH", 0.7)
+	OcrNewlineThresh   = envFloat("OCR_NEWLINE_THRESH", 0.6)
+	OcrAlphanumThresh  = envFloat("OCR_ALPHANUM_THRESH", 0.3)
+	OcrInvalidCharsMin = envInt("OCR_INVALID_CHARS_MIN", 6)
+	OcrInvalidCharsPct = envFloat("OCR_INVALID_CHARS_PCT", 0.03)
+	OcrIntersectThresh = envFloat("OCR_INTERSECT_THRESH", 0.5)
+	OcrDetectionThresh = envFloat("OCR_DETECTION_THRESH", 0.4)
+
+	// Running headers and footers are looked for among this many lines at
+	// the top and at the bottom of each page.
+	HeaderFooterMaxLines = envInt("HEADER_FOOTER_MAX_LINES", 2)
+
+	// Headings repeated through a document, like chapter titles in page
+	// headers, are dropped. Headings match when their text is at least this
+	// alike, and repeat when they match this share of all headings.
+	CommonTitleMatchThresh = envFloat("COMMON_TITLE_MATCH_THRESH", 0.9)
+	CommonTitleMinShare    = envFloat("COMMON_TITLE_MIN_SHARE", 0.05)
+
+	ExtractImages = envBool("EXTRACT_IMAGES", true)
+	ImageDPI      = envFloat("IMAGE_DPI", 96)
+)
+
+func envString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envFloat(key string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
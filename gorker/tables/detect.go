@@ -0,0 +1,502 @@
+package tables
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+)
+
+const (
+	// Distance, in points, within which rulings are at the same position.
+	rulingTol = 2
+	// Gap, in points, that still joins rulings into one table.
+	rulingJoinGap = 4
+	// Gap between spans, in font sizes, that separates two cells.
+	cellGapRatio = 0.8
+	// Fewest rows and columns of aligned text that make an unruled table, and
+	// the most words its cells hold on average.
+	minTextRows  = 3
+	minTextCols  = 3
+	maxCellWords = 4
+	// Share of those cells that are numbers. Author lists, side by side code
+	// and index columns line up too, but their cells start with words.
+	minNumericShare = 0.25
+)
+
+// ruling is a horizontal or vertical line drawn on a page.
+type ruling struct {
+	horizontal bool
+	// pos is the y of a horizontal ruling or the x of a vertical one, start
+	// and end its extent along the other axis.
+	pos, start, end float64
+}
+
+func (r ruling) bbox() geometry.Bbox {
+	if r.horizontal {
+		return geometry.Bbox{r.start, r.pos, r.end, r.pos}
+	}
+	return geometry.Bbox{r.pos, r.start, r.pos, r.end}
+}
+
+// findRulings returns the lines drawn by straight stroked paths and by thin
+// filled bars, which is how tables are ruled.
+func findRulings(drawings []schema.Drawing) []ruling {
+	var rulings []ruling
+	for _, d := range drawings {
+		if d.Image {
+			continue
+		}
+		b := d.Bbox
+		switch {
+		case d.Fill && math.Min(b.Width(), b.Height()) <= 2:
+			// Dots where bars meet add nothing
+			if math.Max(b.Width(), b.Height()) < 1 {
+				continue
+			}
+			if b.Width() >= b.Height() {
+				rulings = append(rulings, ruling{true, (b.Y0() + b.Y1()) / 2, b.X0(), b.X1()})
+			} else {
+				rulings = append(rulings, ruling{false, (b.X0() + b.X1()) / 2, b.Y0(), b.Y1()})
+			}
+		case d.Stroke:
+			for _, s := range d.Segments {
+				switch {
+				case s.Horizontal(0.5):
+					rulings = append(rulings, ruling{true, (s.Y0 + s.Y1) / 2, math.Min(s.X0, s.X1), math.Max(s.X0, s.X1)})
+				case s.Vertical(0.5):
+					rulings = append(rulings, ruling{false, (s.X0 + s.X1) / 2, math.Min(s.Y0, s.Y1), math.Max(s.Y0, s.Y1)})
+				}
+			}
+		}
+	}
+	return rulings
+}
+
+// clusterRulings groups rulings that touch or nearly touch.
+func clusterRulings(rulings []ruling) [][]ruling {
+	parent := make([]int, len(rulings))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range rulings {
+		for j := i + 1; j < len(rulings); j++ {
+			if rulings[i].bbox().Distance(rulings[j].bbox()) <= rulingJoinGap {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	groups := make(map[int][]ruling)
+	var roots []int
+	for i, r := range rulings {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], r)
+	}
+	clusters := make([][]ruling, 0, len(roots))
+	for _, root := range roots {
+		clusters = append(clusters, groups[root])
+	}
+	return clusters
+}
+
+func rulingsBbox(rulings []ruling) geometry.Bbox {
+	bboxes := make([]geometry.Bbox, len(rulings))
+	for i, r := range rulings {
+		bboxes[i] = r.bbox()
+	}
+	return geometry.MergeBboxes(bboxes)
+}
+
+// positions returns the distinct positions of the horizontal or vertical
+// rulings, in order.
+func positions(rulings []ruling, horizontal bool) []float64 {
+	var all []float64
+	for _, r := range rulings {
+		if r.horizontal == horizontal {
+			all = append(all, r.pos)
+		}
+	}
+	sort.Float64s(all)
+
+	var distinct []float64
+	for _, pos := range all {
+		if len(distinct) == 0 || pos > distinct[len(distinct)-1]+rulingTol {
+			distinct = append(distinct, pos)
+		}
+	}
+	return distinct
+}
+
+// gridRulings drops the rulings that meet no ruling running the other way at
+// either end, such as underlines and rules between page sections, when there
+// are rulings both ways.
+func gridRulings(rulings []ruling) []ruling {
+	hs, vs := positions(rulings, true), positions(rulings, false)
+	if len(hs) == 0 || len(vs) == 0 {
+		return rulings
+	}
+	meets := func(pos float64, others []float64) bool {
+		for _, other := range others {
+			if math.Abs(pos-other) <= rulingTol {
+				return true
+			}
+		}
+		return false
+	}
+
+	var kept []ruling
+	for _, r := range rulings {
+		others := hs
+		if r.horizontal {
+			others = vs
+		}
+		if meets(r.start, others) || meets(r.end, others) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// coverage returns the share of the stretch from start to end that rulings
+// at pos cover.
+func coverage(rulings []ruling, horizontal bool, pos, start, end float64) float64 {
+	if end <= start {
+		return 0
+	}
+	var spans [][2]float64
+	for _, r := range rulings {
+		if r.horizontal == horizontal && math.Abs(r.pos-pos) <= rulingTol {
+			if s, e := math.Max(r.start, start), math.Min(r.end, end); e > s {
+				spans = append(spans, [2]float64{s, e})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+
+	covered, reach := 0.0, start
+	for _, s := range spans {
+		if s[1] > reach {
+			covered += s[1] - math.Max(s[0], reach)
+			reach = s[1]
+		}
+	}
+	return covered / (end - start)
+}
+
+// fragment is a run of text in a line with no wide gap in it, usually all
+// the text of a cell on that line.
+type fragment struct {
+	bbox geometry.Bbox
+	text string
+	bold bool
+}
+
+func (f fragment) center() geometry.Point {
+	return f.bbox.Center()
+}
+
+// lineFragments splits a line where the gap between spans is wide enough to
+// separate cells.
+func lineFragments(line schema.Line) []fragment {
+	var frags []fragment
+	for _, span := range line.Spans {
+		if strings.TrimSpace(span.Text) == "" {
+			if len(frags) > 0 {
+				frags[len(frags)-1].text += " "
+			}
+			continue
+		}
+		bold := span.Bold || strings.Contains(strings.ToLower(span.Font), "bold")
+		if n := len(frags); n > 0 && span.Bbox.X0()-frags[n-1].bbox.X1() <= span.FontSize*cellGapRatio {
+			last := &frags[n-1]
+			last.bbox = last.bbox.Union(span.Bbox)
+			last.text += span.Text
+			last.bold = last.bold && bold
+			continue
+		}
+		frags = append(frags, fragment{span.Bbox, span.Text, bold})
+	}
+	for i := range frags {
+		frags[i].text = strings.Join(strings.Fields(frags[i].text), " ")
+	}
+	return frags
+}
+
+func fragmentsInside(frags []fragment, bbox geometry.Bbox) []fragment {
+	var inside []fragment
+	for _, f := range frags {
+		if bbox.ContainsPoint(f.center()) {
+			inside = append(inside, f)
+		}
+	}
+	return inside
+}
+
+// groupRows groups fragments level with the first fragment of a row into
+// that row, top to bottom, each sorted left to right. Comparing against the
+// first fragment stops rows from creeping down through slightly offset cells.
+func groupRows(frags []fragment) [][]fragment {
+	sorted := append([]fragment{}, frags...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].bbox.Y0() < sorted[j].bbox.Y0() })
+
+	var rows [][]fragment
+	var first geometry.Bbox
+	for _, f := range sorted {
+		if len(rows) > 0 {
+			overlap := math.Min(first.Y1(), f.bbox.Y1()) - math.Max(first.Y0(), f.bbox.Y0())
+			if overlap > math.Min(first.Height(), f.bbox.Height())*0.4 {
+				rows[len(rows)-1] = append(rows[len(rows)-1], f)
+				continue
+			}
+		}
+		rows = append(rows, []fragment{f})
+		first = f.bbox
+	}
+	for i, row := range rows {
+		sort.SliceStable(row, func(i, j int) bool { return row[i].bbox.X0() < row[j].bbox.X0() })
+
+		// A bullet belongs to the text after it, it isn't a cell of its own.
+		// Dashes aren't bullets here, tables put them in empty cells
+		joined := row[:0]
+		for k := 0; k < len(row); k++ {
+			if k+1 < len(row) && isBullet(row[k].text) {
+				next := row[k+1]
+				row[k+1] = fragment{row[k].bbox.Union(next.bbox), row[k].text + " " + next.text, next.bold}
+				continue
+			}
+			joined = append(joined, row[k])
+		}
+		rows[i] = joined
+	}
+	return rows
+}
+
+func isBullet(text string) bool {
+	return utf8.RuneCountInString(text) == 1 && strings.ContainsAny(text, "•●○■□▪▫◦‣")
+}
+
+func rowBbox(row []fragment) geometry.Bbox {
+	bboxes := make([]geometry.Bbox, len(row))
+	for i, f := range row {
+		bboxes[i] = f.bbox
+	}
+	return geometry.MergeBboxes(bboxes)
+}
+
+// textColumns returns the x positions between the columns of rows of text,
+// found from the gaps running through the rows with the most cells.
+func textColumns(rows [][]fragment) []float64 {
+	most := 0
+	for _, row := range rows {
+		most = max(most, len(row))
+	}
+	var spans [][2]float64
+	for _, row := range rows {
+		if len(row) == most {
+			for _, f := range row {
+				spans = append(spans, [2]float64{f.bbox.X0(), f.bbox.X1()})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+
+	var bounds []float64
+	reach := math.Inf(-1)
+	for _, s := range spans {
+		if s[0] > reach && !math.IsInf(reach, -1) {
+			bounds = append(bounds, (reach+s[0])/2)
+		}
+		reach = math.Max(reach, s[1])
+	}
+	return bounds
+}
+
+// hasColumns reports whether rows of text are set in columns, with at least
+// half of the rows split into cells.
+func hasColumns(rows [][]fragment) bool {
+	split := 0
+	for _, row := range rows {
+		if len(row) >= 2 && !isMathRow(row) {
+			split++
+		}
+	}
+	return len(rows) >= 2 && split*2 >= len(rows) && len(textColumns(rows)) > 0
+}
+
+// isMathRow reports whether a row is a spaced out formula rather than cells,
+// with operators or brackets standing on their own.
+func isMathRow(row []fragment) bool {
+	for _, f := range row {
+		isMath := func(r rune) bool {
+			return unicode.Is(unicode.Sm, r) || unicode.In(r, unicode.Ps, unicode.Pe) || r == ',' || r == ';'
+		}
+		if f.text != "" && !strings.ContainsFunc(f.text, func(r rune) bool { return !isMath(r) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindTables returns the regions of a page holding tables: text inside a grid
+// of rulings or between horizontal rulings of the same width, and runs of
+// short text aligned in columns.
+func FindTables(page schema.Page) []geometry.Bbox {
+	var frags []fragment
+	for _, line := range page.NonblankLines() {
+		frags = append(frags, lineFragments(line)...)
+	}
+
+	var tables []geometry.Bbox
+	var stacked []geometry.Bbox
+	for _, cluster := range clusterRulings(findRulings(page.Drawings)) {
+		cluster = gridRulings(cluster)
+		if len(cluster) == 0 {
+			continue
+		}
+		bbox := rulingsBbox(cluster).Intersection(page.Bbox)
+		hs, vs := positions(cluster, true), positions(cluster, false)
+		switch {
+		case len(vs) == 0:
+			stacked = append(stacked, bbox)
+		case len(hs) >= 2 && len(vs) >= 3:
+			if len(fragmentsInside(frags, bbox)) >= 2 {
+				tables = append(tables, bbox)
+			}
+		case len(hs) >= 3 && len(vs) == 2:
+			// Framed boxes of text are ruled like this too
+			if hasColumns(groupRows(fragmentsInside(frags, bbox))) {
+				tables = append(tables, bbox)
+			}
+		}
+	}
+	tables = append(tables, stackedTables(stacked, frags)...)
+
+	// Unruled tables, from the text left over
+	var free []fragment
+	for _, f := range frags {
+		inTable := false
+		for _, table := range tables {
+			inTable = inTable || table.ContainsPoint(f.center())
+		}
+		if !inTable {
+			free = append(free, f)
+		}
+	}
+	return append(tables, alignedTables(groupRows(free))...)
+}
+
+// stackedTables finds tables ruled only between rows: runs of horizontal
+// rules of the same width with rows of cells between them.
+func stackedTables(rules []geometry.Bbox, frags []fragment) []geometry.Bbox {
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Y0() < rules[j].Y0() })
+	used := make([]bool, len(rules))
+
+	var tables []geometry.Bbox
+	for i, top := range rules {
+		if used[i] {
+			continue
+		}
+		var run []int
+		prev := top
+		for j := i + 1; j < len(rules); j++ {
+			r := rules[j]
+			if used[j] || math.Abs(r.X0()-top.X0()) > rulingTol*1.5 || math.Abs(r.X1()-top.X1()) > rulingTol*1.5 {
+				continue
+			}
+			between := geometry.Bbox{top.X0(), prev.Y1(), top.X1(), r.Y0()}
+			rows := groupRows(fragmentsInside(frags, between))
+			if len(rows) > 1 && !hasColumns(rows) {
+				break
+			}
+			run = append(run, j)
+			prev = r
+		}
+		if len(run) == 0 {
+			continue
+		}
+
+		bbox := geometry.Bbox{top.X0(), top.Y0(), top.X1(), prev.Y1()}
+		if rows := groupRows(fragmentsInside(frags, bbox)); hasColumns(rows) {
+			for _, j := range run {
+				used[j] = true
+			}
+			tables = append(tables, bbox)
+		}
+	}
+	return tables
+}
+
+// alignedTables finds runs of rows split into several short cells whose
+// columns line up.
+func alignedTables(rows [][]fragment) []geometry.Bbox {
+	isTableRow := func(row []fragment) bool {
+		if len(row) < minTextCols || isMathRow(row) {
+			return false
+		}
+		words := 0
+		for _, f := range row {
+			words += len(strings.Fields(f.text))
+		}
+		return float64(words)/float64(len(row)) <= maxCellWords
+	}
+
+	var tables []geometry.Bbox
+	for i := 0; i < len(rows); {
+		if !isTableRow(rows[i]) {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(rows) && isTableRow(rows[j]) {
+			prev, next := rowBbox(rows[j-1]), rowBbox(rows[j])
+			if next.Y0()-prev.Y1() > 2*math.Max(prev.Height(), next.Height()) {
+				break
+			}
+			j++
+		}
+
+		run := rows[i:j]
+		if len(run) >= minTextRows && len(textColumns(run))+1 >= minTextCols && numericShare(run) >= minNumericShare {
+			bboxes := make([]geometry.Bbox, len(run))
+			for k, row := range run {
+				bboxes[k] = rowBbox(row)
+			}
+			tables = append(tables, geometry.MergeBboxes(bboxes))
+		}
+		i = j
+	}
+	return tables
+}
+
+func numericShare(rows [][]fragment) float64 {
+	cells, numeric := 0, 0
+	for _, row := range rows {
+		for _, f := range row {
+			cells++
+			// Signs, currencies and brackets may lead a number
+			text := strings.TrimLeft(f.text, "+-−±$€£(<>~≈")
+			if r, _ := utf8.DecodeRuneInString(text); unicode.IsDigit(r) || r == '.' && strings.ContainsFunc(text, unicode.IsDigit) {
+				numeric++
+			}
+		}
+	}
+	if cells == 0 {
+		return 0
+	}
+	return float64(numeric) / float64(cells)
+}
@@ -0,0 +1,68 @@
+package tables
+
+import (
+	"testing"
+
+	"gorker/gorker/geometry"
+)
+
+func frag(text string, x0, y0, x1 float64) fragment {
+	return fragment{bbox: geometry.Bbox{x0, y0, x1, y0 + 10}, text: text}
+}
+
+func TestGroupRows(t *testing.T) {
+	frags := []fragment{
+		frag("Item", 50, 100, 80), frag("2023", 150, 100, 170), frag("2024", 250, 100, 270),
+		frag("Revenue", 50, 115, 90), frag("—", 155, 115, 165), frag("12", 255, 115, 265),
+		frag("Costs", 50, 130, 80), frag("4", 155, 130, 160), frag("-", 255, 130, 260),
+		frag("•", 50, 145, 54), frag("Other", 58, 145, 85), frag("1", 155, 145, 160), frag("2", 255, 145, 260),
+	}
+	want := [][]string{
+		{"Item", "2023", "2024"},
+		{"Revenue", "—", "12"},
+		{"Costs", "4", "-"},
+		{"• Other", "1", "2"},
+	}
+
+	rows := groupRows(frags)
+	if len(rows) != len(want) {
+		t.Fatalf("groupRows returned %d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		var got []string
+		for _, f := range row {
+			got = append(got, f.text)
+		}
+		if len(got) != len(want[i]) {
+			t.Errorf("row %d = %q, want %q", i, got, want[i])
+			continue
+		}
+		for j := range got {
+			if got[j] != want[i][j] {
+				t.Errorf("row %d = %q, want %q", i, got, want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestBuildTableDashCells(t *testing.T) {
+	frags := []fragment{
+		frag("Item", 50, 100, 80), frag("2023", 150, 100, 170), frag("2024", 250, 100, 270),
+		frag("Revenue", 50, 115, 90), frag("—", 155, 115, 165), frag("12", 255, 115, 265),
+		frag("Costs", 50, 130, 80), frag("4", 155, 130, 160), frag("–", 255, 130, 260),
+	}
+	table := buildTable(geometry.Bbox{45, 95, 275, 145}, frags, nil)
+	if table.rows != 3 || table.cols != 3 {
+		t.Fatalf("buildTable made a %dx%d table, want 3x3", table.rows, table.cols)
+	}
+	grid := make(map[[2]int]string)
+	for _, c := range table.cells {
+		grid[[2]int{c.row, c.col}] = c.text
+	}
+	for pos, text := range map[[2]int]string{{1, 0}: "Revenue", {1, 1}: "—", {1, 2}: "12", {2, 2}: "–"} {
+		if grid[pos] != text {
+			t.Errorf("cell %v = %q, want %q", pos, grid[pos], text)
+		}
+	}
+}
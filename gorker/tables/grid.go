@@ -0,0 +1,300 @@
+package tables
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"gorker/gorker/geometry"
+)
+
+// cell is a cell of a table, anchored at its top left grid position.
+type cell struct {
+	row, col         int
+	rowSpan, colSpan int
+	text             string
+	bold             bool
+}
+
+type table struct {
+	rows, cols int
+	// cells are in row major order, leaving out the grid positions covered
+	// by spanning cells.
+	cells []cell
+}
+
+// buildTable lays the text of a table region out on a grid. With rulings
+// running both ways the grid follows them and cells span wherever a ruling
+// is missing, otherwise it follows the rows and columns of the text, and
+// cells span the columns their text runs across.
+func buildTable(region geometry.Bbox, frags []fragment, rulings []ruling) table {
+	grow := geometry.Bbox{region.X0() - rulingTol, region.Y0() - rulingTol, region.X1() + rulingTol, region.Y1() + rulingTol}
+	var local []ruling
+	for _, r := range rulings {
+		if r.bbox().Distance(grow) == 0 {
+			local = append(local, r)
+		}
+	}
+	local = gridRulings(local)
+	hs, vs := positions(local, true), positions(local, false)
+	grid := len(hs) >= 2 && len(vs) >= 2
+
+	var xs []float64
+	var ruledX []bool
+	if grid {
+		xs, ruledX = withEdges(vs, region.X0(), region.X1())
+	} else {
+		xs = append(append([]float64{region.X0()}, textColumns(groupRows(frags))...), region.X1())
+		ruledX = make([]bool, len(xs))
+	}
+
+	bands, ruledBands := []float64{region.Y0(), region.Y1()}, []bool{false, false}
+	if grid {
+		bands, ruledBands = withEdges(hs, region.Y0(), region.Y1())
+	}
+	// Split bands holding several rows, as tables often rule only some
+	ys, ruledY := []float64{bands[0]}, []bool{ruledBands[0]}
+	for b := 0; b+1 < len(bands); b++ {
+		band := geometry.Bbox{region.X0(), bands[b], region.X1(), bands[b+1]}
+		rows := mergeWrapped(groupRows(fragmentsInside(frags, band)), xs)
+		for k := 1; k < len(rows); k++ {
+			ys = append(ys, (rowBbox(rows[k-1]).Y1()+rowBbox(rows[k]).Y0())/2)
+			ruledY = append(ruledY, false)
+		}
+		ys = append(ys, bands[b+1])
+		ruledY = append(ruledY, ruledBands[b+1])
+	}
+
+	// Drop rows and columns without text, such as those between double rules
+	rowUsed := make([]bool, len(ys)-1)
+	colUsed := make([]bool, len(xs)-1)
+	for _, f := range frags {
+		rowUsed[cellIndex(f.center().Y, ys)] = true
+		c0, c1 := columnSpan(f.bbox, xs)
+		for c := c0; c <= c1; c++ {
+			colUsed[c] = true
+		}
+	}
+	ys, ruledY = dropEmpty(ys, ruledY, rowUsed)
+	xs, ruledX = dropEmpty(xs, ruledX, colUsed)
+	rows, cols := len(ys)-1, len(xs)-1
+
+	parent := make([]int, rows*cols)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(r0, c0, r1, c1 int) {
+		parent[find(r0*cols+c0)] = find(r1*cols + c1)
+	}
+
+	// Cells run on across missing rulings
+	for r := 0; r < rows; r++ {
+		for c := 1; c < cols; c++ {
+			if ruledX[c] && coverage(local, false, xs[c], ys[r], ys[r+1]) < 0.5 {
+				union(r, c-1, r, c)
+			}
+		}
+	}
+	for c := 0; c < cols; c++ {
+		for r := 1; r < rows; r++ {
+			if ruledY[r] && coverage(local, true, ys[r], xs[c], xs[c+1]) < 0.5 {
+				union(r-1, c, r, c)
+			}
+		}
+	}
+	// and across the columns their text runs over
+	for _, f := range frags {
+		r := cellIndex(f.center().Y, ys)
+		c0, c1 := columnSpan(f.bbox, xs)
+		for c := c0 + 1; c <= c1; c++ {
+			union(r, c0, r, c)
+		}
+	}
+
+	// Each group of grid positions becomes one cell covering them
+	type rect struct{ r0, c0, r1, c1 int }
+	rects := make(map[int]*rect)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			root := find(r*cols + c)
+			if rc, ok := rects[root]; ok {
+				rc.r1, rc.c0, rc.c1 = max(rc.r1, r), min(rc.c0, c), max(rc.c1, c)
+			} else {
+				rects[root] = &rect{r, c, r, c}
+			}
+		}
+	}
+
+	t := table{rows: rows, cols: cols}
+	owner := make([]int, rows*cols)
+	for i := range owner {
+		owner[i] = -1
+	}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			if owner[r*cols+c] != -1 {
+				continue
+			}
+			rc := rects[find(r*cols+c)]
+			if rc.r0 != r || rc.c0 != c {
+				// A group that isn't a rectangle, keep the position on its own
+				rc = &rect{r, c, r, c}
+			}
+			for rr := rc.r0; rr <= rc.r1; rr++ {
+				for cc := rc.c0; cc <= rc.c1; cc++ {
+					if owner[rr*cols+cc] == -1 {
+						owner[rr*cols+cc] = len(t.cells)
+					}
+				}
+			}
+			t.cells = append(t.cells, cell{row: r, col: c, rowSpan: rc.r1 - rc.r0 + 1, colSpan: rc.c1 - rc.c0 + 1})
+		}
+	}
+
+	sorted := append([]fragment{}, frags...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if math.Abs(sorted[i].bbox.Y0()-sorted[j].bbox.Y0()) > rulingTol {
+			return sorted[i].bbox.Y0() < sorted[j].bbox.Y0()
+		}
+		return sorted[i].bbox.X0() < sorted[j].bbox.X0()
+	})
+	texts := make([][]string, len(t.cells))
+	bold := make([]bool, len(t.cells))
+	for i := range bold {
+		bold[i] = true
+	}
+	for _, f := range sorted {
+		c0, _ := columnSpan(f.bbox, xs)
+		i := owner[cellIndex(f.center().Y, ys)*cols+c0]
+		texts[i] = append(texts[i], f.text)
+		bold[i] = bold[i] && f.bold
+	}
+	for i := range t.cells {
+		t.cells[i].text = strings.Join(texts[i], " ")
+		t.cells[i].bold = len(texts[i]) > 0 && bold[i]
+	}
+	return t
+}
+
+// withEdges returns the ruled positions with the region's edges added where
+// no ruling marks them, and which of the positions are ruled.
+func withEdges(ruled []float64, lo, hi float64) ([]float64, []bool) {
+	var bounds []float64
+	var isRuled []bool
+	if ruled[0] > lo+rulingTol {
+		bounds, isRuled = append(bounds, lo), append(isRuled, false)
+	}
+	for _, pos := range ruled {
+		bounds, isRuled = append(bounds, pos), append(isRuled, true)
+	}
+	if ruled[len(ruled)-1] < hi-rulingTol {
+		bounds, isRuled = append(bounds, hi), append(isRuled, false)
+	}
+	return bounds, isRuled
+}
+
+// dropEmpty removes the unused cells between bounds by joining each to the
+// next one, or to the one before at the end.
+func dropEmpty(bounds []float64, ruled []bool, used []bool) ([]float64, []bool) {
+	keptBounds, keptRuled := []float64{bounds[0]}, []bool{ruled[0]}
+	for i, ok := range used {
+		switch {
+		case ok:
+			keptBounds, keptRuled = append(keptBounds, bounds[i+1]), append(keptRuled, ruled[i+1])
+		case i == len(used)-1:
+			if len(keptBounds) > 1 {
+				keptBounds[len(keptBounds)-1], keptRuled[len(keptRuled)-1] = bounds[i+1], ruled[i+1]
+			} else {
+				keptBounds, keptRuled = append(keptBounds, bounds[i+1]), append(keptRuled, ruled[i+1])
+			}
+		}
+	}
+	return keptBounds, keptRuled
+}
+
+// mergeWrapped joins a row with text in only one column to the row above,
+// when that row has text in the same column and the row follows it closely,
+// as the wrapped lines of a cell.
+func mergeWrapped(rows [][]fragment, xs []float64) [][]fragment {
+	var merged [][]fragment
+	for _, row := range rows {
+		if n := len(merged); n > 0 {
+			prev, cur := rowBbox(merged[n-1]), rowBbox(row)
+			c0, c1 := columnSpan(cur, xs)
+			prevHasText := false
+			for _, f := range merged[n-1] {
+				f0, f1 := columnSpan(f.bbox, xs)
+				prevHasText = prevHasText || (f0 <= c0 && f1 >= c1)
+			}
+			if c0 == c1 && prevHasText && cur.Y0()-prev.Y1() <= cur.Height()*0.5 {
+				merged[n-1] = append(merged[n-1], row...)
+				continue
+			}
+		}
+		merged = append(merged, row)
+	}
+	return merged
+}
+
+// cellIndex returns the cell between bounds holding pos, clamped to the
+// first and last cells.
+func cellIndex(pos float64, bounds []float64) int {
+	i := sort.SearchFloat64s(bounds[1:len(bounds)-1], pos)
+	return min(i, len(bounds)-2)
+}
+
+// columnSpan returns the first and last columns a box runs into, ignoring
+// slight overhangs.
+func columnSpan(b geometry.Bbox, xs []float64) (int, int) {
+	inset := math.Min(2, b.Width()/2)
+	return cellIndex(b.X0()+inset, xs), cellIndex(b.X1()-inset, xs)
+}
+
+// headerRows returns how many rows at the top of the table are its header:
+// the rows the first cells span, or the leading rows set in bold, and at
+// least one.
+func (t table) headerRows() int {
+	header := 1
+	for _, c := range t.cells {
+		if c.row == 0 {
+			header = max(header, c.rowSpan)
+		}
+	}
+
+	boldRows := 0
+	for r := 0; r < t.rows; r++ {
+		hasText, allBold := false, true
+		for _, c := range t.cells {
+			if c.row == r && c.text != "" {
+				hasText = true
+				allBold = allBold && c.bold
+			}
+		}
+		if !hasText || !allBold {
+			break
+		}
+		boldRows++
+	}
+	header = max(header, boldRows)
+	if header >= t.rows {
+		return 1
+	}
+	return header
+}
+
+func (t table) filledCells() int {
+	filled := 0
+	for _, c := range t.cells {
+		if c.text != "" {
+			filled++
+		}
+	}
+	return filled
+}
@@ -0,0 +1,96 @@
+package tables
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// markdown renders the table as a GitHub pipe table, or as HTML if it has
+// cells spanning rows or columns, which pipe tables can't express.
+func (t table) markdown() string {
+	for _, c := range t.cells {
+		if c.rowSpan > 1 || c.colSpan > 1 {
+			return t.html()
+		}
+	}
+
+	grid := make([][]string, t.rows)
+	for r := range grid {
+		grid[r] = make([]string, t.cols)
+	}
+	for _, c := range t.cells {
+		grid[c.row][c.col] = strings.ReplaceAll(c.text, "|", `\|`)
+	}
+
+	// Pipe tables have a single header row, so stack the header text
+	headerRows := t.headerRows()
+	header := make([]string, t.cols)
+	for c := range header {
+		var parts []string
+		for r := 0; r < headerRows; r++ {
+			if grid[r][c] != "" {
+				parts = append(parts, grid[r][c])
+			}
+		}
+		header[c] = strings.Join(parts, " ")
+	}
+	rows := append([][]string{header}, grid[headerRows:]...)
+
+	widths := make([]int, t.cols)
+	for c := range widths {
+		widths[c] = 3
+		for _, row := range rows {
+			widths[c] = max(widths[c], utf8.RuneCountInString(row[c]))
+		}
+	}
+
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		sb.WriteString("|")
+		for c, text := range row {
+			sb.WriteString(" " + text + strings.Repeat(" ", widths[c]-utf8.RuneCountInString(text)) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	writeRow(rows[0])
+	sb.WriteString("|")
+	for _, width := range widths {
+		sb.WriteString(strings.Repeat("-", width+2) + "|")
+	}
+	sb.WriteString("\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (t table) html() string {
+	headerRows := t.headerRows()
+	var sb strings.Builder
+	sb.WriteString("<table>\n")
+	for r := 0; r < t.rows; r++ {
+		sb.WriteString("<tr>")
+		for _, c := range t.cells {
+			if c.row != r {
+				continue
+			}
+			tag := "td"
+			if r < headerRows {
+				tag = "th"
+			}
+			sb.WriteString("<" + tag)
+			if c.rowSpan > 1 {
+				sb.WriteString(fmt.Sprintf(` rowspan="%d"`, c.rowSpan))
+			}
+			if c.colSpan > 1 {
+				sb.WriteString(fmt.Sprintf(` colspan="%d"`, c.colSpan))
+			}
+			sb.WriteString(">" + html.EscapeString(c.text) + "</" + tag + ">")
+		}
+		sb.WriteString("</tr>\n")
+	}
+	sb.WriteString("</table>")
+	return sb.String()
+}
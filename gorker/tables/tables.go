@@ -0,0 +1,123 @@
+package tables
+
+import (
+	"fmt"
+
+	"gorker/gorker/geometry"
+	"gorker/gorker/schema"
+	"gorker/gorker/settings"
+)
+
+// FormatTables replaces the lines in the table regions of every page with a
+// block holding the table as markdown, placed where the table's first line
+// was. It returns the number of tables.
+func FormatTables(pages []schema.Page) int {
+	count := 0
+	for i := range pages {
+		page := &pages[i]
+		if page.Layout == nil {
+			continue
+		}
+		var regions []geometry.Bbox
+		for _, l := range page.Layout.Bboxes {
+			if l.Label == "Table" {
+				regions = append(regions, geometry.RescaleBbox(page.Layout.ImageBbox, page.Bbox, l.Bbox))
+			}
+		}
+		if len(regions) == 0 {
+			continue
+		}
+
+		count += formatPageTables(page, regions, findRulings(page.Drawings))
+	}
+	return count
+}
+
+func formatPageTables(page *schema.Page, regions []geometry.Bbox, rulings []ruling) int {
+	lineTable := func(line schema.Line) int {
+		for i, region := range regions {
+			if line.IntersectionPct(region) > settings.BboxIntersectionThresh {
+				return i
+			}
+		}
+		return -1
+	}
+
+	frags := make([][]fragment, len(regions))
+	for _, block := range page.Blocks {
+		for _, line := range block.Lines {
+			if i := lineTable(line); i != -1 {
+				frags[i] = append(frags[i], lineFragments(line)...)
+			}
+		}
+	}
+
+	tableBlocks := make([]*schema.Block, len(regions))
+	count := 0
+	for i, region := range regions {
+		if len(frags[i]) == 0 {
+			continue
+		}
+		t := buildTable(region, frags[i], rulings)
+		// A single row or column, or text that didn't split into cells, reads
+		// fine as text
+		if t.rows < 2 || t.cols < 2 || t.filledCells() < 3 {
+			continue
+		}
+		tableBlocks[i] = &schema.Block{
+			Lines: []schema.Line{{
+				Spans: []schema.Span{{
+					Text:   t.markdown(),
+					Bbox:   region,
+					SpanID: fmt.Sprintf("%d_%d_table", page.Pnum, i),
+					Font:   "Table",
+					Source: schema.SourcePdfText,
+				}},
+				Bbox: region,
+			}},
+			Bbox:      region,
+			Pnum:      page.Pnum,
+			BlockType: "Table",
+		}
+		count++
+	}
+
+	var newBlocks []schema.Block
+	inserted := make([]bool, len(regions))
+	for _, block := range page.Blocks {
+		// Whatever is left of a table that couldn't be rebuilt is text
+		if block.BlockType == "Table" {
+			block.BlockType = "Text"
+		}
+
+		var kept []schema.Line
+		split := false
+		for _, line := range block.Lines {
+			i := lineTable(line)
+			if i == -1 || tableBlocks[i] == nil {
+				kept = append(kept, line)
+				continue
+			}
+			split = true
+			if inserted[i] {
+				continue
+			}
+			// Text before the table stays above it
+			if len(kept) > 0 {
+				newBlocks = append(newBlocks, schema.Block{Lines: kept, Bbox: schema.BboxFromLines(kept), Pnum: block.Pnum, BlockType: block.BlockType})
+				kept = nil
+			}
+			newBlocks = append(newBlocks, *tableBlocks[i])
+			inserted[i] = true
+		}
+
+		switch {
+		case !split:
+			newBlocks = append(newBlocks, block)
+		case len(kept) > 0:
+			newBlocks = append(newBlocks, schema.Block{Lines: kept, Bbox: schema.BboxFromLines(kept), Pnum: block.Pnum, BlockType: block.BlockType})
+		}
+	}
+	page.Blocks = newBlocks
+	return count
+}